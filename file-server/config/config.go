@@ -1,42 +1,239 @@
 package config
 
 import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/hex"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Port        string
-	StoragePath string
-	FileBaseURL string
-	JWTSecret   string
-	DBHost      string
-	DBPort      string
-	DBUser      string
-	DBName      string
-	DBPassword  string
-	DBSSLMode   string
-	ReplicaURL  string
+	Port             string
+	StoragePath      string
+	StorageBackend   string
+	FileBaseURL      string
+	JWTSecret        string
+	DBHost           string
+	DBPort           string
+	DBUser           string
+	DBName           string
+	DBPassword       string
+	DBSSLMode        string
+	ReplicaURLs      []string
 	ReplicaAuthToken string
+	// Quórum de escritura: réplicas que deben confirmar una subida o eliminación
+	ReplicaWriteQuorum  int
+	ReplicaHealthPeriod time.Duration
+	// Cola de replicación: intervalo del worker y límites del backoff exponencial
+	ReplicationInterval    time.Duration
+	ReplicationBaseBackoff time.Duration
+	ReplicationMaxBackoff  time.Duration
+	// Versiones conservadas por archivo: valor general y valores por proyecto
+	VersionRetention          int
+	VersionRetentionByProject map[string]int
+	// Papelera: tiempo que se conservan los archivos eliminados y frecuencia del purgador
+	TrashRetention     time.Duration
+	TrashPurgeInterval time.Duration
+	// Intervalo de la reconciliación con las réplicas (0 la desactiva)
+	ReconcileInterval time.Duration
+	// Verificación de integridad: intervalo (0 la desactiva), bytes leídos por
+	// segundo (0 sin límite) y reparación automática desde las réplicas
+	ScrubInterval  time.Duration
+	ScrubRateLimit int64
+	ScrubSelfHeal  bool
+	// Cuotas por defecto de usuarios y proyectos sin límites propios (0 sin límite)
+	QuotaUserBytes    int64
+	QuotaUserFiles    int64
+	QuotaProjectBytes int64
+	QuotaProjectFiles int64
+	// Política de subida de los proyectos sin política propia: tamaño máximo
+	// (0 sin límite) y tipos MIME permitidos (vacío admite todos) y bloqueados
+	UploadMaxSize          int64
+	UploadAllowedMimeTypes []string
+	UploadBlockedMimeTypes []string
+	// Clave HMAC de los enlaces firmados y vigencia máxima. Sin
+	// SIGNED_URL_SECRET la clave se deriva de JWT_SECRET (SignedURLSecretDerived)
+	SignedURLSecret        string
+	SignedURLSecretDerived bool
+	SignedURLMaxTTL        time.Duration
+	// Vigencia en caché (Cache-Control max-age) de los archivos públicos
+	PublicCacheMaxAge time.Duration
+	// Miniaturas: carpeta de la caché, lado máximo, píxeles máximos de la
+	// imagen original, miniaturas generadas al subir y generaciones simultáneas
+	ThumbnailPath      string
+	ThumbnailMaxSize   int
+	ThumbnailMaxPixels int
+	ThumbnailPresets   []string
+	ThumbnailWorkers   int
+	// Límites de una descarga de varios archivos (0 sin límite)
+	ArchiveMaxFiles int
+	ArchiveMaxSize  int64
+	// Límites al extraer un archivo comprimido subido (0 sin límite)
+	ExtractMaxEntries int
+	ExtractMaxSize    int64
+	// URL pública de la ruta /share de los enlaces compartidos
+	ShareBaseURL string
+	// Usuarios autorizados a usar los endpoints de administración
+	AdminUserIDs     []string
+	UploadTempPath   string
+	UploadSessionTTL time.Duration
+	S3Endpoint       string
+	S3Region         string
+	S3Bucket         string
+	S3AccessKey      string
+	S3SecretKey      string
+	S3PathStyle      bool
 }
 
 func LoadConfig() Config {
 	// Cargar variables desde .env (si existe)
 	_ = godotenv.Load()
 
+	storagePath := os.Getenv("STORAGE_PATH")
+	signedURLSecret, signedURLSecretDerived := signedURLSecret()
+
 	return Config{
-		Port:        os.Getenv("PORT"),
-		StoragePath: os.Getenv("STORAGE_PATH"),
-		FileBaseURL: os.Getenv("FILE_BASE_URL"),
-		JWTSecret:   os.Getenv("JWT_SECRET"),
-		DBHost:      os.Getenv("DB_HOST"),
-		DBPort:      os.Getenv("DB_PORT"),
-		DBUser:      os.Getenv("DB_USER"),
-		DBName:      os.Getenv("DB_NAME"),
-		DBPassword:  os.Getenv("DB_PASSWORD"),
-		DBSSLMode:   os.Getenv("DB_SSLMODE"),
-		ReplicaURL:  os.Getenv("REPLICA_URL"),
-		ReplicaAuthToken: os.Getenv("REPLICA_AUTH_TOKEN"),
+		Port:                      os.Getenv("PORT"),
+		StoragePath:               storagePath,
+		StorageBackend:            getEnv("STORAGE_BACKEND", "local"),
+		FileBaseURL:               os.Getenv("FILE_BASE_URL"),
+		JWTSecret:                 os.Getenv("JWT_SECRET"),
+		DBHost:                    os.Getenv("DB_HOST"),
+		DBPort:                    os.Getenv("DB_PORT"),
+		DBUser:                    os.Getenv("DB_USER"),
+		DBName:                    os.Getenv("DB_NAME"),
+		DBPassword:                os.Getenv("DB_PASSWORD"),
+		DBSSLMode:                 os.Getenv("DB_SSLMODE"),
+		ReplicaURLs:               getListEnv("REPLICA_URLS", os.Getenv("REPLICA_URL")),
+		ReplicaAuthToken:          os.Getenv("REPLICA_AUTH_TOKEN"),
+		ReplicaWriteQuorum:        getIntEnv("REPLICA_WRITE_QUORUM", 0),
+		ReplicaHealthPeriod:       getDurationEnv("REPLICA_HEALTH_INTERVAL", 30*time.Second),
+		ReplicationInterval:       getDurationEnv("REPLICATION_INTERVAL", 10*time.Second),
+		ReplicationBaseBackoff:    getDurationEnv("REPLICATION_BASE_BACKOFF", 5*time.Second),
+		ReplicationMaxBackoff:     getDurationEnv("REPLICATION_MAX_BACKOFF", time.Hour),
+		VersionRetention:          getIntEnv("VERSION_RETENTION", 10),
+		VersionRetentionByProject: getIntMapEnv("VERSION_RETENTION_BY_PROJECT"),
+		TrashRetention:            getDurationEnv("TRASH_RETENTION", 30*24*time.Hour),
+		TrashPurgeInterval:        getDurationEnv("TRASH_PURGE_INTERVAL", time.Hour),
+		ReconcileInterval:         getDurationEnv("RECONCILE_INTERVAL", 6*time.Hour),
+		ScrubInterval:             getDurationEnv("SCRUB_INTERVAL", 24*time.Hour),
+		ScrubRateLimit:            int64(getIntEnv("SCRUB_RATE_LIMIT", 8*1024*1024)),
+		ScrubSelfHeal:             os.Getenv("SCRUB_SELF_HEAL") == "true",
+		QuotaUserBytes:            int64(getIntEnv("QUOTA_USER_BYTES", 0)),
+		QuotaUserFiles:            int64(getIntEnv("QUOTA_USER_FILES", 0)),
+		QuotaProjectBytes:         int64(getIntEnv("QUOTA_PROJECT_BYTES", 0)),
+		QuotaProjectFiles:         int64(getIntEnv("QUOTA_PROJECT_FILES", 0)),
+		UploadMaxSize:             int64(getIntEnv("UPLOAD_MAX_SIZE", 0)),
+		UploadAllowedMimeTypes:    getListEnv("UPLOAD_ALLOWED_MIME_TYPES", ""),
+		UploadBlockedMimeTypes:    getListEnv("UPLOAD_BLOCKED_MIME_TYPES", "text/html,application/xhtml+xml,image/svg+xml,text/xml,application/xml"),
+		SignedURLSecret:           signedURLSecret,
+		SignedURLSecretDerived:    signedURLSecretDerived,
+		SignedURLMaxTTL:           getDurationEnv("SIGNED_URL_MAX_TTL", 7*24*time.Hour),
+		PublicCacheMaxAge:         getDurationEnv("PUBLIC_CACHE_MAX_AGE", time.Hour),
+		ThumbnailPath:             getEnv("THUMBNAIL_PATH", filepath.Join(storagePath, ".thumbnails")),
+		ThumbnailMaxSize:          getIntEnv("THUMBNAIL_MAX_SIZE", 2048),
+		ThumbnailMaxPixels:        getIntEnv("THUMBNAIL_MAX_PIXELS", 50_000_000),
+		ThumbnailPresets:          getListEnv("THUMBNAIL_PRESETS", "256x256"),
+		ThumbnailWorkers:          getIntEnv("THUMBNAIL_WORKERS", 2),
+		ArchiveMaxFiles:           getIntEnv("ARCHIVE_MAX_FILES", 1000),
+		ArchiveMaxSize:            int64(getIntEnv("ARCHIVE_MAX_SIZE", 5<<30)),
+		ExtractMaxEntries:         getIntEnv("EXTRACT_MAX_ENTRIES", 1000),
+		ExtractMaxSize:            int64(getIntEnv("EXTRACT_MAX_SIZE", 1<<30)),
+		ShareBaseURL:              getEnv("SHARE_BASE_URL", strings.TrimSuffix(strings.TrimRight(os.Getenv("FILE_BASE_URL"), "/"), "/files")+"/share"),
+		AdminUserIDs:              getListEnv("ADMIN_USER_IDS", ""),
+		UploadTempPath:            getEnv("UPLOAD_TEMP_PATH", filepath.Join(storagePath, ".uploads")),
+		UploadSessionTTL:          getDurationEnv("UPLOAD_SESSION_TTL", 24*time.Hour),
+		S3Endpoint:                os.Getenv("S3_ENDPOINT"),
+		S3Region:                  os.Getenv("S3_REGION"),
+		S3Bucket:                  os.Getenv("S3_BUCKET"),
+		S3AccessKey:               os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey:               os.Getenv("S3_SECRET_KEY"),
+		S3PathStyle:               os.Getenv("S3_PATH_STYLE") != "false",
+	}
+}
+
+// signedURLSecretLabel distingue la clave derivada para los enlaces firmados
+// de cualquier otro uso de JWT_SECRET.
+const signedURLSecretLabel = "file-server signed-url v1"
+
+// signedURLSecret devuelve la clave de los enlaces firmados. Si no se define
+// SIGNED_URL_SECRET se deriva de JWT_SECRET con HKDF-SHA256, para no firmar los
+// enlaces con la misma clave que autentica los tokens; el segundo valor indica
+// que se usó la clave derivada.
+func signedURLSecret() (string, bool) {
+	if secret := os.Getenv("SIGNED_URL_SECRET"); secret != "" {
+		return secret, false
+	}
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		return "", false
+	}
+	key, err := hkdf.Key(sha256.New, []byte(jwtSecret), nil, signedURLSecretLabel, 32)
+	if err != nil {
+		return "", false
+	}
+	return hex.EncodeToString(key), true
+}
+
+// getEnv devuelve el valor de la variable de entorno o el valor por defecto.
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getDurationEnv interpreta la variable como time.Duration (p.ej. "24h").
+func getDurationEnv(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getIntEnv interpreta la variable como entero.
+func getIntEnv(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getListEnv interpreta la variable como lista separada por comas; si está
+// vacía se usa fallback con el mismo formato.
+func getListEnv(key, fallback string) []string {
+	raw := os.Getenv(key)
+	if raw == "" {
+		raw = fallback
+	}
+	values := []string{}
+	for _, value := range strings.Split(raw, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getIntMapEnv interpreta la variable como pares clave=entero separados por
+// comas (p.ej. "proyecto1=5,proyecto2=20"); los pares inválidos se ignoran.
+func getIntMapEnv(key string) map[string]int {
+	values := map[string]int{}
+	for _, pair := range getListEnv(key, "") {
+		name, raw, found := strings.Cut(pair, "=")
+		value, err := strconv.Atoi(strings.TrimSpace(raw))
+		if !found || err != nil {
+			continue
+		}
+		values[strings.TrimSpace(name)] = value
 	}
+	return values
 }
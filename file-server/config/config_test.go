@@ -0,0 +1,25 @@
+package config
+
+import "testing"
+
+func TestSignedURLSecret(t *testing.T) {
+	t.Setenv("JWT_SECRET", "clave-jwt")
+	t.Setenv("SIGNED_URL_SECRET", "clave-enlaces")
+	if secret, derived := signedURLSecret(); secret != "clave-enlaces" || derived {
+		t.Errorf("con SIGNED_URL_SECRET = %q, %v", secret, derived)
+	}
+
+	t.Setenv("SIGNED_URL_SECRET", "")
+	secret, derived := signedURLSecret()
+	if !derived || secret == "" || secret == "clave-jwt" {
+		t.Errorf("clave derivada = %q, %v", secret, derived)
+	}
+	if again, _ := signedURLSecret(); again != secret {
+		t.Error("la clave derivada debe ser la misma en cada arranque")
+	}
+
+	t.Setenv("JWT_SECRET", "")
+	if secret, derived := signedURLSecret(); secret != "" || derived {
+		t.Errorf("sin claves = %q, %v", secret, derived)
+	}
+}
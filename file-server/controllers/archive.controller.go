@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/services"
+	"github.com/t-saturn/file-server/utils"
+)
+
+// ArchiveFilesHandler descarga varios archivos en un ZIP o tar.gz generado al
+// vuelo. Se espera un JSON con una de las estructuras:
+// { "file_ids": ["<id>", "<id>"], "format": "zip" }
+// { "folder_id": "<id>", "format": "tar.gz" }
+// { "project": "informes", "name": "informes-2025" }
+func (fc *FileController) ArchiveFilesHandler(w http.ResponseWriter, r *http.Request) {
+	ip := r.RemoteAddr
+
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	var req models.ArchiveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error decodificando JSON: " + err.Error()})
+		return
+	}
+	if req.Format == "" {
+		req.Format = models.ArchiveFormatZip
+	}
+
+	// Todos los permisos se verifican antes de enviar el primer byte
+	entries, err := fc.ArchiveService.Collect(userID, req)
+	if err != nil {
+		status := archiveErrorStatus(err)
+		msg := err.Error()
+		if status == http.StatusInternalServerError {
+			msg = "Error preparando la descarga"
+		}
+		utils.Logger.WithError(err).WithFields(logrus.Fields{"event": "archive", "user_id": userID, "ip": ip}).Warn(msg)
+		_ = fc.FileService.LogRepo.LogEvent("archive", req.Project, "", ip, "failure", err.Error())
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": msg})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "archivos-" + time.Now().Format("20060102-150405")
+	}
+	filename := strings.NewReplacer("/", "_", "\\", "_", `"`, "").Replace(name) + "." + req.Format
+	contentType := "application/zip"
+	if req.Format == models.ArchiveFormatTarGz {
+		contentType = "application/gzip"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, filename, url.QueryEscape(filename)))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if err := fc.ArchiveService.Write(w, req.Format, entries); err != nil {
+		// La respuesta ya comenzó: el archivo queda incompleto y el cliente lo detecta como dañado
+		utils.Logger.WithError(err).WithFields(logrus.Fields{"event": "archive", "user_id": userID, "ip": ip}).Error("Descarga de archivos interrumpida")
+		_ = fc.FileService.LogRepo.LogEvent("archive", req.Project, "", ip, "failure", "Descarga interrumpida: "+err.Error())
+		return
+	}
+
+	utils.Logger.WithFields(logrus.Fields{
+		"event": "archive", "user_id": userID, "ip": ip, "format": req.Format, "files": len(entries),
+	}).Info("Descarga de archivos completada")
+	_ = fc.FileService.LogRepo.LogEvent("archive", req.Project, "", ip, "success", fmt.Sprintf("Descarga de %d archivos (%s)", len(entries), req.Format))
+}
+
+// archiveErrorStatus devuelve el código HTTP que corresponde a un error de descarga.
+func archiveErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrArchiveInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrArchiveTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrArchiveNotFound), errors.Is(err, services.ErrFolderNotFound), errors.Is(err, services.ErrProjectNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrArchiveForbidden), errors.Is(err, services.ErrFolderForbidden), errors.Is(err, services.ErrProjectForbidden):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
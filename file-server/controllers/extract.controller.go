@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/services"
+	"github.com/t-saturn/file-server/utils"
+)
+
+// ExtractUploadHandler sube un ZIP o tar.gz y lo extrae en el servidor: cada
+// archivo queda como un registro propio y cada directorio como una carpeta.
+// Se usa con POST /api/file/upload/{project}?extract=true y los mismos campos
+// que una subida normal ("file" e "is_public"), más "folder_id" opcional con
+// la carpeta de destino. Responde con el resultado de cada entrada.
+func (fc *FileController) ExtractUploadHandler(w http.ResponseWriter, r *http.Request) {
+	project := mux.Vars(r)["project"]
+	ip := r.RemoteAddr
+
+	ownerID, ok := r.Context().Value("user").(string)
+	if !ok || ownerID == "" {
+		msg := "No autorizado: No existe el owner_id en el token"
+		utils.Logger.WithFields(logrus.Fields{"event": "extract", "project": project, "ip": ip}).Error(msg)
+		_ = fc.FileService.LogRepo.LogEvent("extract", project, "", ip, "failure", msg)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": msg})
+		return
+	}
+
+	// Solo los administradores y editores del proyecto pueden subir archivos
+	if err := fc.ProjectService.RequireRole(project, ownerID, models.ProjectRoleAdmin, models.ProjectRoleEditor); err != nil {
+		msg := "No se puede subir al proyecto: " + err.Error()
+		utils.Logger.WithFields(logrus.Fields{"event": "extract", "project": project, "owner_id": ownerID, "ip": ip}).Error(msg)
+		_ = fc.FileService.LogRepo.LogEvent("extract", project, "", ip, "failure", msg)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(projectErrorStatus(err))
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": msg})
+		return
+	}
+
+	// Las cuotas se verifican aquí y de nuevo con cada entrada extraída
+	if _, err := fc.QuotaService.Allowance(ownerID, project, 1); err != nil {
+		msg := "Error verificando la cuota: " + err.Error()
+		if errors.Is(err, services.ErrQuotaExceeded) {
+			msg = "No se puede subir el archivo: " + err.Error()
+		}
+		utils.Logger.WithFields(logrus.Fields{"event": "extract", "project": project, "owner_id": ownerID, "ip": ip}).Error(msg)
+		_ = fc.FileService.LogRepo.LogEvent("extract", project, "", ip, "failure", msg)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(uploadErrorStatus(err))
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": msg})
+		return
+	}
+
+	// El archivo comprimido no puede superar el máximo de lo que se extrae
+	if maxBytes := fc.ExtractService.MaxBytes; maxBytes > 0 {
+		if r.ContentLength > maxBytes+multipartOverhead {
+			msg := fmt.Sprintf("No se puede subir el archivo: %v (%d bytes)", services.ErrExtractTooLarge, maxBytes)
+			_ = fc.FileService.LogRepo.LogEvent("extract", project, "", ip, "failure", msg)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": msg})
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes+multipartOverhead)
+	}
+
+	// Guardar la parte "file" en un archivo temporal para poder recorrerla
+	var archivePath string
+	originalName, fields, err := streamMultipartFile(r, func(filename string, data io.Reader) error {
+		var stageErr error
+		archivePath, stageErr = fc.ExtractService.Stage(data)
+		return stageErr
+	})
+	if archivePath != "" {
+		defer os.Remove(archivePath)
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		msg := "Error al leer el archivo: " + err.Error()
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		utils.Logger.WithFields(logrus.Fields{"event": "extract", "project": project, "ip": ip}).Error(msg)
+		_ = fc.FileService.LogRepo.LogEvent("extract", project, "", ip, "failure", msg)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": msg})
+		return
+	}
+
+	req := services.ExtractRequest{OwnerID: ownerID, Project: project, IsPublic: fields["is_public"] == "true"}
+	if folderID := strings.TrimSpace(fields["folder_id"]); folderID != "" {
+		req.FolderID = &folderID
+	}
+
+	report, err := fc.ExtractService.Extract(archivePath, req)
+	if err != nil {
+		status := extractErrorStatus(err)
+		msg := "No se pudo extraer el archivo: " + err.Error()
+		utils.Logger.WithError(err).WithFields(logrus.Fields{"event": "extract", "project": project, "owner_id": ownerID, "ip": ip}).Error(msg)
+		_ = fc.FileService.LogRepo.LogEvent("extract", project, "", ip, "failure", msg)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": msg})
+		return
+	}
+
+	// Generar las miniaturas en segundo plano
+	for _, entry := range report.Entries {
+		if entry.File != nil {
+			fc.ThumbnailService.Enqueue(entry.File)
+		}
+	}
+
+	msg := fmt.Sprintf("Archivo %s extraído: %d creados, %d omitidos, %d con error", originalName, report.Created, report.Skipped, report.Failed)
+	utils.Logger.WithFields(logrus.Fields{
+		"event": "extract", "project": project, "owner_id": ownerID, "ip": ip, "file_name": originalName,
+		"created": report.Created, "skipped": report.Skipped, "failed": report.Failed, "truncated": report.Truncated,
+	}).Info(msg)
+	_ = fc.FileService.LogRepo.LogEvent("extract", project, "", ip, "success", msg)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"report": report, "message": msg})
+}
+
+// extractErrorStatus devuelve el código HTTP que corresponde a un error de
+// extracción.
+func extractErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrExtractUnsupported):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, services.ErrExtractTooLarge), errors.Is(err, services.ErrExtractTooMany):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrFolderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrFolderForbidden):
+		return http.StatusForbidden
+	default:
+		return uploadErrorStatus(err)
+	}
+}
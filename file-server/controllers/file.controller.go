@@ -2,18 +2,19 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/url"
 	"path"
 	"path/filepath"
-	"strings"
-	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"github.com/t-saturn/file-server/database"
 	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/services"
 	"github.com/t-saturn/file-server/utils"
 )
 
@@ -45,34 +46,92 @@ func (fc *FileController) UploadFileHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	file, header, err := r.FormFile("file")
+	// Solo los administradores y editores del proyecto pueden subir archivos
+	if err := fc.ProjectService.RequireRole(project, ownerID, models.ProjectRoleAdmin, models.ProjectRoleEditor); err != nil {
+		msg := "No se puede subir al proyecto: " + err.Error()
+		utils.Logger.WithFields(logrus.Fields{"event": "upload", "project": project, "owner_id": ownerID, "ip": ip}).Error(msg)
+		_ = fc.FileService.LogRepo.LogEvent("upload", project, "", ip, "failure", msg)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(projectErrorStatus(err))
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": msg})
+		return
+	}
+
+	// Verificar las cuotas antes de que los datos lleguen al disco
+	remaining, err := fc.checkUploadQuota(r, ownerID, project, 1)
 	if err != nil {
-		msg := "Error al leer el archivo: " + err.Error()
+		status := http.StatusInternalServerError
+		msg := "Error verificando la cuota: " + err.Error()
+		if errors.Is(err, services.ErrQuotaExceeded) {
+			status = http.StatusRequestEntityTooLarge
+			msg = "No se puede subir el archivo: " + err.Error()
+		}
+		utils.Logger.WithFields(logrus.Fields{"event": "upload", "project": project, "owner_id": ownerID, "ip": ip}).Error(msg)
+		_ = fc.FileService.LogRepo.LogEvent("upload", project, "", ip, "failure", msg)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": msg})
+		return
+	}
+
+	// Aplicar la política de subida del proyecto (tamaño máximo y tipos MIME)
+	policy, err := fc.checkUploadPolicy(w, r, project)
+	if err != nil {
+		status := http.StatusInternalServerError
+		msg := "Error obteniendo la política de subida: " + err.Error()
+		if errors.Is(err, services.ErrFileTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+			msg = "No se puede subir el archivo: " + err.Error()
+		}
 		utils.Logger.WithFields(logrus.Fields{"event": "upload", "project": project, "ip": ip}).Error(msg)
 		_ = fc.FileService.LogRepo.LogEvent("upload", project, "", ip, "failure", msg)
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(status)
 		json.NewEncoder(w).Encode(map[string]interface{}{"error": msg})
 		return
 	}
-	defer file.Close()
 
-	isPublic := r.FormValue("is_public") == "true"
-	newFileName := uuid.New().String() + filepath.Ext(header.Filename)
-	relativePath, err := fc.FileService.UploadFile(project, newFileName, file)
+	// Transmitir la parte "file" directamente al almacenamiento
+	var relativePath string
+	var metadata models.FileMetadata
+	var saveErr error
+	originalName, fields, err := streamMultipartFile(r, func(filename string, data io.Reader) error {
+		content, policyErr := fc.PolicyService.Enforce(policy, filename, data)
+		if policyErr != nil {
+			saveErr = policyErr
+			return saveErr
+		}
+		newFileName := uuid.New().String() + filepath.Ext(filename)
+		relativePath, metadata, saveErr = fc.FileService.UploadFile(project, newFileName, services.LimitReader(content, remaining))
+		return saveErr
+	})
+	if saveErr != nil {
+		msg := "Error al guardar el archivo: " + saveErr.Error()
+		utils.Logger.WithFields(logrus.Fields{"event": "upload", "project": project, "ip": ip}).Error(msg)
+		_ = fc.FileService.LogRepo.LogEvent("upload", project, "", ip, "failure", msg)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(uploadErrorStatus(saveErr))
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": msg})
+		return
+	}
 	if err != nil {
-		msg := "Error al guardar el archivo: " + err.Error()
+		// El contenido pudo guardarse antes de que fallara el resto del formulario
+		fc.FileService.DiscardBlob(filepath.ToSlash(relativePath))
+		msg := "Error al leer el archivo: " + err.Error()
 		utils.Logger.WithFields(logrus.Fields{"event": "upload", "project": project, "ip": ip}).Error(msg)
 		_ = fc.FileService.LogRepo.LogEvent("upload", project, "", ip, "failure", msg)
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]interface{}{"error": msg})
 		return
 	}
 
+	isPublic := fields["is_public"] == "true"
+
 	normalizedPath := filepath.ToSlash(relativePath)
 	u, err := url.Parse(fc.FileBaseURL)
 	if err != nil {
+		fc.FileService.DiscardBlob(normalizedPath)
 
 		msg := "Error construyendo URL base: " + err.Error()
 
@@ -87,9 +146,10 @@ func (fc *FileController) UploadFileHandler(w http.ResponseWriter, r *http.Reque
 
 	u.Path = path.Join(u.Path, normalizedPath)
 
-	// Crear registro del archivo mediante FileService
-	fileRecord, err := fc.FileService.CreateFileRecord(header.Filename, normalizedPath, ownerID, isPublic)
+	// Crear registro del archivo y asignar permiso de "owner" mediante FileService
+	fileRecord, err := fc.FileService.CreateOwnedFileRecord(originalName, normalizedPath, ownerID, isPublic, metadata)
 	if err != nil {
+		fc.FileService.DiscardBlob(normalizedPath)
 		msg := "Error insertando metadatos: " + err.Error()
 		utils.Logger.WithError(err).Error(msg)
 		_ = fc.FileService.LogRepo.LogEvent("upload", project, "", ip, "failure", msg)
@@ -99,25 +159,9 @@ func (fc *FileController) UploadFileHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Asignar permiso de "owner"
-	_, err = database.InsertFilePermissionRecord(fc.FileService.LogRepo.DB, fileRecord.ID, ownerID, "owner")
-	if err != nil {
-
-		msg := "Error asignando permisos de propietario del archivo"
-
-		utils.Logger.WithError(err).Error(msg)
-		_ = fc.FileService.LogRepo.LogEvent("upload", project, "", ip, "failure", msg)
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{"error": msg})
-		return
-
-	}
-
 	utils.Logger.WithFields(logrus.Fields{
 		"event": "upload", "project": project, "ip": ip,
-		"file_name": header.Filename, "file_id": fileRecord.ID, "is_public": isPublic,
+		"file_name": originalName, "file_id": fileRecord.ID, "is_public": isPublic,
 	}).Info("Archivo subido exitosamente")
 
 	_ = fc.FileService.LogRepo.LogEvent(
@@ -129,6 +173,9 @@ func (fc *FileController) UploadFileHandler(w http.ResponseWriter, r *http.Reque
 		"Archivo subido exitosamente",
 	)
 
+	// Generar las miniaturas en segundo plano
+	fc.ThumbnailService.Enqueue(fileRecord)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{"file": fileRecord, "message": "Archivo subido exitosamente"})
@@ -158,7 +205,8 @@ func (fc *FileController) UpdateFileHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	allowed, role, err := database.CheckUserFilePermission(fc.FileService.LogRepo.DB, fileID, userID)
+	// El rol combina el permiso sobre el archivo con el rol en su proyecto
+	role, err := fc.FileService.FileRole(fileRecord, userID)
 	if err != nil {
 
 		w.Header().Set("Content-Type", "application/json")
@@ -166,7 +214,7 @@ func (fc *FileController) UpdateFileHandler(w http.ResponseWriter, r *http.Reque
 		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error verificando permisos"})
 		return
 	}
-	if !allowed || (role != "owner" && role != "editor") {
+	if role != "owner" && role != "editor" {
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusForbidden)
@@ -174,44 +222,77 @@ func (fc *FileController) UpdateFileHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	file, header, err := r.FormFile("file")
-	if err != nil {
+	// El nuevo contenido se guarda en el mismo proyecto; la validación de la
+	// ruta queda a cargo del backend de almacenamiento.
+	project := services.FileProject(fileRecord)
 
+	// El nuevo contenido cuenta para la cuota del propietario del archivo
+	remaining, err := fc.checkUploadQuota(r, fileRecord.OwnerID, project, 0)
+	if err != nil {
+		status := http.StatusInternalServerError
+		msg := "Error verificando la cuota"
+		if errors.Is(err, services.ErrQuotaExceeded) {
+			status = http.StatusRequestEntityTooLarge
+			msg = "No se puede actualizar el archivo: " + err.Error()
+		}
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error leyendo archivo"})
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": msg})
 		return
 	}
-	defer file.Close()
-
-	directory := filepath.Dir(fileRecord.URL)
-	newFileName := uuid.New().String() + filepath.Ext(header.Filename)
-	cleanDir := filepath.Clean(directory)
-	if strings.Contains(cleanDir, "..") {
 
+	// El nuevo contenido debe cumplir la política de subida del proyecto
+	policy, err := fc.checkUploadPolicy(w, r, project)
+	if err != nil {
+		status := http.StatusInternalServerError
+		msg := "Error obteniendo la política de subida"
+		if errors.Is(err, services.ErrFileTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+			msg = "No se puede actualizar el archivo: " + err.Error()
+		}
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Directorio no válido"})
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": msg})
 		return
 	}
 
-	project := cleanDir
-	if project == "." {
-		project = ""
+	// Transmitir el nuevo contenido directamente al almacenamiento
+	var newPath string
+	var metadata models.FileMetadata
+	var saveErr error
+	originalName, _, err := streamMultipartFile(r, func(filename string, data io.Reader) error {
+		content, policyErr := fc.PolicyService.Enforce(policy, filename, data)
+		if policyErr != nil {
+			saveErr = policyErr
+			return saveErr
+		}
+		newFileName := uuid.New().String() + filepath.Ext(filename)
+		newPath, metadata, saveErr = fc.FileService.UploadFile(project, newFileName, services.LimitReader(content, remaining))
+		return saveErr
+	})
+	if saveErr != nil {
+		status := uploadErrorStatus(saveErr)
+		msg := "Error al subir el nuevo archivo"
+		if status == http.StatusRequestEntityTooLarge || status == http.StatusUnsupportedMediaType {
+			msg = "No se puede actualizar el archivo: " + saveErr.Error()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": msg})
+		return
 	}
-	newPath, err := fc.FileService.UploadFile(project, newFileName, file)
 	if err != nil {
+		fc.FileService.DiscardBlob(filepath.ToSlash(newPath))
 
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error al subir el nuevo archivo"})
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error leyendo archivo"})
 		return
 	}
+	// El backend rechaza rutas que escapan de su raíz
 	normalizedPath := filepath.ToSlash(newPath)
-	finalPath := filepath.Join(fc.FileService.StoragePath, normalizedPath)
-	absStoragePath, _ := filepath.Abs(fc.FileService.StoragePath)
-	absFinalPath, _ := filepath.Abs(finalPath)
-	if !strings.HasPrefix(absFinalPath, absStoragePath) {
+	if _, err := fc.FileService.Storage.Stat(normalizedPath); err != nil {
+		fc.FileService.DiscardBlob(normalizedPath)
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -219,12 +300,10 @@ func (fc *FileController) UpdateFileHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	now := time.Now()
-	err = fc.FileService.LogRepo.DB.Model(&models.File{}).
-		Where("id = ? AND deleted_at IS NULL", fileID).
-		Updates(map[string]interface{}{"original_name": header.Filename, "url": normalizedPath, "updated_at": now}).
-		Error
+	// Registrar el nuevo contenido como una versión; la anterior se conserva en el historial
+	fileRecord, err = fc.FileService.AddFileVersion(fileID, originalName, normalizedPath, userID, metadata)
 	if err != nil {
+		fc.FileService.DiscardBlob(normalizedPath)
 
 		utils.Logger.WithFields(logrus.Fields{
 			"event":   "update",
@@ -247,23 +326,20 @@ func (fc *FileController) UpdateFileHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	fileRecord.OriginalName = header.Filename
-	fileRecord.URL = normalizedPath
-	fileRecord.UpdatedAt = now
-
 	utils.Logger.WithFields(logrus.Fields{
 		"event": "update_file", "file_id": fileID, "user_id": userID, "ip": ip,
-		"role": role, "new_file_name": header.Filename,
+		"role": role, "new_file_name": originalName,
 	}).Info("Archivo actualizado exitosamente")
 
 	_ = fc.FileService.LogRepo.LogEvent("update", project, fileRecord.URL, ip, "success", "Archivo actualizado exitosamente")
+	fc.ThumbnailService.Enqueue(fileRecord)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{"file": fileRecord, "message": "Archivo actualizado exitosamente"})
 }
 
-// DeleteFileHandler elimina un archivo por su ID.
+// DeleteFileHandler mueve un archivo a la papelera por su ID.
 func (fc *FileController) DeleteFileHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	fileID := vars["id"]
@@ -300,7 +376,7 @@ func (fc *FileController) DeleteFileHandler(w http.ResponseWriter, r *http.Reque
 			"message": "Error eliminando el archivo",
 		}
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(replicationErrorStatus(err))
 		json.NewEncoder(w).Encode(response)
 
 		return
@@ -311,51 +387,149 @@ func (fc *FileController) DeleteFileHandler(w http.ResponseWriter, r *http.Reque
 		"file_id": fileID,
 		"user_id": userID,
 		"ip":      ip,
-	}).Info("Archivo eliminado exitosamente")
+	}).Info("Archivo movido a la papelera")
 
-	_ = fc.FileService.LogRepo.LogEvent("delete", "", "file id: "+fileID, ip, "success", "Archivo eliminado correctamente")
+	_ = fc.FileService.LogRepo.LogEvent("delete", "", "file id: "+fileID, ip, "success", "Archivo movido a la papelera")
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"id":      fileID,
-		"message": "Archivo eliminado correctamente",
+		"message": "Archivo movido a la papelera",
 	})
 }
 
-// InternalUploadFileHandler maneja la carga de archivos replicados internamente.
+// InternalUploadFileHandler guarda un archivo replicado desde el primario en
+// la misma ruta relativa (parámetro "path"), sin generar un nombre nuevo.
 func (fc *FileController) InternalUploadFileHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	project := vars["project"]
+	relativePath := r.URL.Query().Get("path")
+	if relativePath == "" {
+		http.Error(w, "Falta la ruta del archivo replicado", http.StatusBadRequest)
+		return
+	}
 
-	file, header, err := r.FormFile("file")
+	var saveErr error
+	_, _, err := streamMultipartFile(r, func(filename string, data io.Reader) error {
+		saveErr = fc.FileService.StoreReplicatedFile(relativePath, data)
+		return saveErr
+	})
+	if saveErr != nil {
+		utils.Logger.WithError(saveErr).WithFields(logrus.Fields{"event": "replica_upload", "project": project, "path": relativePath}).Error("Error al guardar el archivo replicado")
+		http.Error(w, "Error al guardar el archivo replicado: "+saveErr.Error(), http.StatusInternalServerError)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error al leer el archivo: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer file.Close()
 
-	newFileName := uuid.New().String() + filepath.Ext(header.Filename)
-	_, err = fc.FileService.UploadFile(project, newFileName, file)
-	if err != nil {
-		http.Error(w, "Error al guardar el archivo replicado: "+err.Error(), http.StatusInternalServerError)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Archivo replicado exitosamente", "path": relativePath})
+}
+
+// InternalDeleteFileHandler elimina de la réplica el contenido de la ruta
+// indicada en el parámetro "path".
+func (fc *FileController) InternalDeleteFileHandler(w http.ResponseWriter, r *http.Request) {
+	relativePath := r.URL.Query().Get("path")
+	if relativePath == "" {
+		http.Error(w, "Falta la ruta del archivo replicado", http.StatusBadRequest)
+		return
+	}
+
+	if err := fc.FileService.DeleteReplicatedFile(relativePath); err != nil {
+		utils.Logger.WithError(err).WithFields(logrus.Fields{"event": "replica_delete", "path": relativePath}).Error("Error al eliminar el archivo replicado")
+		http.Error(w, "Error al eliminar el archivo replicado: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Archivo replicado exitosamente"})
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Archivo replicado eliminado exitosamente"})
 }
 
-// InternalDeleteFileHandler maneja la eliminación de archivos replicados internamente.
-func (fc *FileController) InternalDeleteFileHandler(w http.ResponseWriter, r *http.Request) {
+// InternalSyncFileRecordHandler guarda en la réplica el registro del archivo
+// enviado por el primario, con el mismo ID y la misma ruta relativa.
+func (fc *FileController) InternalSyncFileRecordHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	fileID := vars["id"]
 
-	err := fc.FileService.RemoveFile(fileID, "") // No hay requestorID para eliminación interna
-	if err != nil {
-		http.Error(w, "Error al eliminar el archivo replicado: "+err.Error(), http.StatusInternalServerError)
+	var replicated models.ReplicatedFile
+	if err := json.NewDecoder(r.Body).Decode(&replicated); err != nil {
+		http.Error(w, "Registro replicado inválido: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if replicated.File.ID != fileID {
+		http.Error(w, "El ID del registro no coincide con la ruta", http.StatusBadRequest)
+		return
+	}
+
+	if err := fc.FileService.ApplyReplicatedRecord(&replicated); err != nil {
+		utils.Logger.WithError(err).WithFields(logrus.Fields{"event": "replica_record", "file_id": fileID}).Error("Error al guardar el registro replicado")
+		http.Error(w, "Error al guardar el registro replicado: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Archivo replicado eliminado exitosamente"})
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Registro replicado exitosamente", "id": fileID})
+}
+
+// InternalPurgeFileRecordHandler elimina de la réplica el registro de un
+// archivo purgado en el primario.
+func (fc *FileController) InternalPurgeFileRecordHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	fileID := vars["id"]
+
+	if err := fc.FileService.PurgeReplicatedRecord(fileID); err != nil {
+		utils.Logger.WithError(err).WithFields(logrus.Fields{"event": "replica_purge", "file_id": fileID}).Error("Error al eliminar el registro replicado")
+		http.Error(w, "Error al eliminar el registro replicado: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Registro replicado eliminado exitosamente", "id": fileID})
+}
+
+// streamMultipartFile recorre el cuerpo multipart parte por parte, sin
+// cargarlo en memoria ni en archivos temporales. La parte "file" se entrega a
+// save en cuanto aparece; los demás campos se devuelven junto al nombre
+// original del archivo.
+func streamMultipartFile(r *http.Request, save func(filename string, data io.Reader) error) (string, map[string]string, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return "", nil, err
+	}
+
+	filename := ""
+	fields := map[string]string{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, err
+		}
+
+		if part.FormName() == "file" && filename == "" {
+			filename = part.FileName()
+			if err := save(filename, part); err != nil {
+				part.Close()
+				return "", nil, err
+			}
+		} else if part.FileName() == "" {
+			// Los campos de texto son pequeños; se limita su tamaño por seguridad
+			value, err := io.ReadAll(io.LimitReader(part, 1<<20))
+			if err != nil {
+				part.Close()
+				return "", nil, err
+			}
+			fields[part.FormName()] = string(value)
+		}
+		part.Close()
+	}
+
+	if filename == "" {
+		return "", nil, http.ErrMissingFile
+	}
+	return filename, fields, nil
 }
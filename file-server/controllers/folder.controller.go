@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/services"
+	"github.com/t-saturn/file-server/utils"
+	"gorm.io/gorm"
+)
+
+// CreateFolderHandler crea una carpeta. Se espera un JSON con la estructura:
+// { "name": "Informes", "parent_id": "uuid" } (parent_id omitido para la raíz).
+func (fc *FileController) CreateFolderHandler(w http.ResponseWriter, r *http.Request) {
+	ip := r.RemoteAddr
+
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	var req models.FolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error decodificando JSON: " + err.Error()})
+		return
+	}
+
+	folder, err := fc.FolderService.CreateFolder(userID, req.Name, req.ParentID)
+	if err != nil {
+		fc.writeFolderError(w, err, "create_folder", userID, ip)
+		return
+	}
+
+	utils.Logger.WithFields(logrus.Fields{"event": "create_folder", "folder_id": folder.ID, "user_id": userID, "ip": ip}).Info("Carpeta creada")
+	_ = fc.FileService.LogRepo.LogEvent("create_folder", "", "folder id: "+folder.ID, ip, "success", "Carpeta creada")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"folder": folder, "message": "Carpeta creada"})
+}
+
+// ListFolderHandler devuelve el contenido de una carpeta ("root" para la raíz)
+// paginado con los parámetros "limit" (máximo 200) y "offset".
+func (fc *FileController) ListFolderHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	ip := r.RemoteAddr
+
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	var folderID *string
+	if id := vars["id"]; id != "root" {
+		folderID = &id
+	}
+
+	limit, offset := 50, 0
+	if value, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && value > 0 && value <= 200 {
+		limit = value
+	}
+	if value, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && value >= 0 {
+		offset = value
+	}
+
+	contents, err := fc.FolderService.ListContents(folderID, userID, limit, offset)
+	if err != nil {
+		fc.writeFolderError(w, err, "list_folder", userID, ip)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contents)
+}
+
+// UpdateFolderHandler renombra una carpeta: { "name": "Nuevo nombre" }.
+func (fc *FileController) UpdateFolderHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	folderID := vars["id"]
+	ip := r.RemoteAddr
+
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	var req models.FolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error decodificando JSON: " + err.Error()})
+		return
+	}
+
+	folder, err := fc.FolderService.RenameFolder(folderID, userID, req.Name)
+	if err != nil {
+		fc.writeFolderError(w, err, "rename_folder", userID, ip)
+		return
+	}
+
+	_ = fc.FileService.LogRepo.LogEvent("rename_folder", "", "folder id: "+folder.ID, ip, "success", "Carpeta renombrada")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"folder": folder, "message": "Carpeta renombrada"})
+}
+
+// MoveFolderHandler mueve una carpeta: { "parent_id": "uuid" } (omitido para la raíz).
+func (fc *FileController) MoveFolderHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	folderID := vars["id"]
+	ip := r.RemoteAddr
+
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	var req models.FolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error decodificando JSON: " + err.Error()})
+		return
+	}
+
+	folder, err := fc.FolderService.MoveFolder(folderID, userID, req.ParentID)
+	if err != nil {
+		fc.writeFolderError(w, err, "move_folder", userID, ip)
+		return
+	}
+
+	_ = fc.FileService.LogRepo.LogEvent("move_folder", "", "folder id: "+folder.ID, ip, "success", "Carpeta movida")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"folder": folder, "message": "Carpeta movida"})
+}
+
+// DeleteFolderHandler elimina una carpeta vacía; con ?recursive=true mueve
+// sus archivos a la papelera y elimina también las subcarpetas.
+func (fc *FileController) DeleteFolderHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	folderID := vars["id"]
+	ip := r.RemoteAddr
+
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	recursive := r.URL.Query().Get("recursive") == "true"
+	if err := fc.FolderService.DeleteFolder(folderID, userID, recursive); err != nil {
+		fc.writeFolderError(w, err, "delete_folder", userID, ip)
+		return
+	}
+
+	utils.Logger.WithFields(logrus.Fields{"event": "delete_folder", "folder_id": folderID, "user_id": userID, "ip": ip, "recursive": recursive}).Info("Carpeta eliminada")
+	_ = fc.FileService.LogRepo.LogEvent("delete_folder", "", "folder id: "+folderID, ip, "success", "Carpeta eliminada")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": folderID, "message": "Carpeta eliminada"})
+}
+
+// MoveFileToFolderHandler mueve un archivo a una carpeta sin mover su
+// contenido: { "folder_id": "uuid" } (omitido para la raíz).
+func (fc *FileController) MoveFileToFolderHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	fileID := vars["id"]
+	ip := r.RemoteAddr
+
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	var req models.FolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error decodificando JSON: " + err.Error()})
+		return
+	}
+
+	fileRecord, err := fc.FolderService.MoveFile(fileID, userID, req.FolderID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"message": "Archivo no encontrado"})
+			return
+		}
+		fc.writeFolderError(w, err, "move_file", userID, ip)
+		return
+	}
+
+	_ = fc.FileService.LogRepo.LogEvent("move_file", "", "file id: "+fileID, ip, "success", "Archivo movido de carpeta")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"file": fileRecord, "message": "Archivo movido de carpeta"})
+}
+
+// writeFolderError registra el error y responde con el código HTTP que corresponde.
+func (fc *FileController) writeFolderError(w http.ResponseWriter, err error, event, userID, ip string) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrFolderNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrFolderForbidden):
+		status = http.StatusForbidden
+	case errors.Is(err, services.ErrFolderNameTaken), errors.Is(err, services.ErrFolderNotEmpty):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrFolderInvalid), errors.Is(err, services.ErrFolderCycle):
+		status = http.StatusBadRequest
+	}
+
+	utils.Logger.WithError(err).WithFields(logrus.Fields{"event": event, "user_id": userID, "ip": ip}).Error("Error en la operación de carpetas")
+	_ = fc.FileService.LogRepo.LogEvent(event, "", "", ip, "failure", err.Error())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": err.Error()})
+}
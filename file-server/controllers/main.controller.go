@@ -1,17 +1,44 @@
 package controllers
 
 import (
+	"time"
+
 	"github.com/t-saturn/file-server/services"
 )
 
 type FileController struct {
-	FileService *services.FileService
-	FileBaseURL string
+	FileService      *services.FileService
+	UploadService    *services.UploadService
+	ReconcileService *services.ReconcileService
+	FolderService    *services.FolderService
+	QuotaService     *services.QuotaService
+	PolicyService    *services.UploadPolicyService
+	ProjectService   *services.ProjectService
+	SignedURLService *services.SignedURLService
+	ShareService     *services.ShareService
+	ThumbnailService *services.ThumbnailService
+	ArchiveService   *services.ArchiveService
+	ExtractService   *services.ExtractService
+	FileBaseURL      string
+	// Vigencia en caché de los archivos públicos (Cache-Control)
+	PublicCacheMaxAge time.Duration
 }
 
-func NewFileController(fs *services.FileService, fileBaseURL string) *FileController {
+func NewFileController(fs *services.FileService, us *services.UploadService, rs *services.ReconcileService, fos *services.FolderService, qs *services.QuotaService, ps *services.UploadPolicyService, prs *services.ProjectService, ss *services.SignedURLService, shs *services.ShareService, ts *services.ThumbnailService, as *services.ArchiveService, es *services.ExtractService, fileBaseURL string, publicCacheMaxAge time.Duration) *FileController {
 	return &FileController{
-		FileService: fs,
-		FileBaseURL: fileBaseURL,
+		FileService:       fs,
+		UploadService:     us,
+		ReconcileService:  rs,
+		FolderService:     fos,
+		QuotaService:      qs,
+		PolicyService:     ps,
+		ProjectService:    prs,
+		SignedURLService:  ss,
+		ShareService:      shs,
+		ThumbnailService:  ts,
+		ArchiveService:    as,
+		ExtractService:    es,
+		FileBaseURL:       fileBaseURL,
+		PublicCacheMaxAge: publicCacheMaxAge,
 	}
 }
@@ -141,6 +141,7 @@ func (fc *FileController) AddFilePermissionHandler(w http.ResponseWriter, r *htt
 
 		return
 	}
+	fc.FileService.SyncFileRecord(fileRecord)
 
 	// Obtener los permisos actualizados del archivo
 	permissions, err := database.GetFilePermissions(fc.FileService.LogRepo.DB, fileID)
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/services"
+	"github.com/t-saturn/file-server/utils"
+)
+
+// GetUploadPolicyHandler devuelve la política de subida vigente de un proyecto
+// para que los clientes validen los archivos antes de enviarlos.
+func (fc *FileController) GetUploadPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	project := mux.Vars(r)["project"]
+
+	policy, err := fc.PolicyService.Policy(project)
+	if err != nil {
+		utils.Logger.WithError(err).WithField("project", project).Error("Error obteniendo la política de subida")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error obteniendo la política de subida"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"policy": policy})
+}
+
+// UpdateUploadPolicyHandler define la política de subida de un proyecto (solo administradores).
+// Se espera un JSON con la estructura:
+// { "max_size": 52428800, "allowed_mime_types": ["image/*", "application/pdf"], "blocked_mime_types": ["image/svg+xml"] }
+func (fc *FileController) UpdateUploadPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	project := mux.Vars(r)["project"]
+	ip := r.RemoteAddr
+	adminID, _ := r.Context().Value("user").(string)
+
+	var req models.UploadPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error decodificando JSON: " + err.Error()})
+		return
+	}
+
+	policy, err := fc.PolicyService.SetPolicy(project, req)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidPolicy) {
+			status = http.StatusBadRequest
+		}
+		utils.Logger.WithError(err).WithFields(logrus.Fields{"event": "upload_policy", "project": project, "ip": ip}).Error("Error actualizando la política de subida")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": err.Error()})
+		return
+	}
+
+	utils.Logger.WithFields(logrus.Fields{
+		"event": "upload_policy", "project": project, "admin_id": adminID, "ip": ip,
+		"max_size": policy.MaxSize, "allowed": policy.AllowedMimeTypes, "blocked": policy.BlockedMimeTypes,
+	}).Info("Política de subida actualizada")
+	_ = fc.FileService.LogRepo.LogEvent("upload_policy", project, "", ip, "success", "Política de subida actualizada")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"policy": policy, "message": "Política de subida actualizada"})
+}
+
+// DeleteUploadPolicyHandler elimina la política propia de un proyecto, que
+// vuelve a usar la de la configuración (solo administradores).
+func (fc *FileController) DeleteUploadPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	project := mux.Vars(r)["project"]
+	ip := r.RemoteAddr
+
+	deleted, err := fc.PolicyService.DeletePolicy(project)
+	if err != nil {
+		utils.Logger.WithError(err).WithFields(logrus.Fields{"event": "upload_policy", "project": project, "ip": ip}).Error("Error eliminando la política de subida")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error eliminando la política de subida"})
+		return
+	}
+	if !deleted {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "El proyecto no tiene política propia"})
+		return
+	}
+
+	_ = fc.FileService.LogRepo.LogEvent("upload_policy", project, "", ip, "success", "Política de subida eliminada")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Política de subida eliminada"})
+}
+
+// checkUploadPolicy obtiene la política del proyecto, rechaza los cuerpos que
+// declaran un tamaño mayor al permitido y limita la lectura del cuerpo con
+// http.MaxBytesReader para los que no lo declaran.
+func (fc *FileController) checkUploadPolicy(w http.ResponseWriter, r *http.Request, project string) (*models.UploadPolicy, error) {
+	policy, err := fc.PolicyService.Policy(project)
+	if err != nil {
+		return nil, err
+	}
+	if policy.MaxSize > 0 {
+		if r.ContentLength > policy.MaxSize+multipartOverhead {
+			return nil, fmt.Errorf("%w (%d bytes)", services.ErrFileTooLarge, policy.MaxSize)
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, policy.MaxSize+multipartOverhead)
+	}
+	return policy, nil
+}
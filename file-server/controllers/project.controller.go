@@ -0,0 +1,255 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/services"
+	"github.com/t-saturn/file-server/utils"
+)
+
+// CreateProjectHandler crea un proyecto del que el usuario queda como administrador.
+// Se espera un JSON con la estructura: { "name": "informes", "description": "..." }
+func (fc *FileController) CreateProjectHandler(w http.ResponseWriter, r *http.Request) {
+	ip := r.RemoteAddr
+
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	var req models.ProjectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error decodificando JSON: " + err.Error()})
+		return
+	}
+
+	project, err := fc.ProjectService.CreateProject(req.Name, req.Description, userID)
+	if err != nil {
+		fc.writeProjectError(w, err, "create_project", req.Name, userID, ip)
+		return
+	}
+
+	utils.Logger.WithFields(logrus.Fields{"event": "create_project", "project": project.Name, "user_id": userID, "ip": ip}).Info("Proyecto creado")
+	_ = fc.FileService.LogRepo.LogEvent("create_project", project.Name, "", ip, "success", "Proyecto creado")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"project": project, "message": "Proyecto creado"})
+}
+
+// ListProjectsHandler lista los proyectos de los que el usuario es miembro.
+func (fc *FileController) ListProjectsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	projects, err := fc.ProjectService.ListProjects(userID)
+	if err != nil {
+		fc.writeProjectError(w, err, "list_projects", "", userID, r.RemoteAddr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"projects": projects})
+}
+
+// GetProjectHandler devuelve un proyecto y el rol del usuario en él.
+func (fc *FileController) GetProjectHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["project"]
+
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	project, err := fc.ProjectService.GetProject(name, userID)
+	if err != nil {
+		fc.writeProjectError(w, err, "get_project", name, userID, r.RemoteAddr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"project": project})
+}
+
+// UpdateProjectHandler cambia la descripción de un proyecto (solo administradores del proyecto).
+// Se espera un JSON con la estructura: { "description": "..." }
+func (fc *FileController) UpdateProjectHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["project"]
+	ip := r.RemoteAddr
+
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	var req models.ProjectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error decodificando JSON: " + err.Error()})
+		return
+	}
+
+	project, err := fc.ProjectService.UpdateProject(name, req.Description, userID)
+	if err != nil {
+		fc.writeProjectError(w, err, "update_project", name, userID, ip)
+		return
+	}
+
+	_ = fc.FileService.LogRepo.LogEvent("update_project", name, "", ip, "success", "Proyecto actualizado")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"project": project, "message": "Proyecto actualizado"})
+}
+
+// ListProjectMembersHandler lista los miembros de un proyecto (cualquier miembro).
+func (fc *FileController) ListProjectMembersHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["project"]
+
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	members, err := fc.ProjectService.Members(name, userID)
+	if err != nil {
+		fc.writeProjectError(w, err, "list_project_members", name, userID, r.RemoteAddr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"members": members})
+}
+
+// SetProjectMemberHandler agrega un miembro o cambia su rol (solo administradores del proyecto).
+// Se espera un JSON con la estructura: { "user_id": "<id>", "role": "editor" }
+func (fc *FileController) SetProjectMemberHandler(w http.ResponseWriter, r *http.Request) {
+	fc.setProjectMember(w, r, false)
+}
+
+// AssignProjectMemberHandler agrega un miembro o cambia su rol en cualquier
+// proyecto (solo administradores del servidor). Permite asignar el primer
+// administrador de los proyectos creados antes de que existieran los miembros.
+func (fc *FileController) AssignProjectMemberHandler(w http.ResponseWriter, r *http.Request) {
+	fc.setProjectMember(w, r, true)
+}
+
+// setProjectMember procesa el alta o el cambio de rol de un miembro; asServerAdmin
+// omite la verificación del rol de quien lo pide.
+func (fc *FileController) setProjectMember(w http.ResponseWriter, r *http.Request, asServerAdmin bool) {
+	name := mux.Vars(r)["project"]
+	ip := r.RemoteAddr
+
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	var req models.ProjectMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error decodificando JSON: " + err.Error()})
+		return
+	}
+
+	var member *models.ProjectMember
+	var err error
+	if asServerAdmin {
+		member, err = fc.ProjectService.AssignMember(name, req.UserID, req.Role)
+	} else {
+		member, err = fc.ProjectService.SetMember(name, userID, req.UserID, req.Role)
+	}
+	if err != nil {
+		fc.writeProjectError(w, err, "project_member", name, userID, ip)
+		return
+	}
+
+	utils.Logger.WithFields(logrus.Fields{
+		"event": "project_member", "project": name, "user_id": userID, "ip": ip,
+		"member_id": member.UserID, "role": member.Role,
+	}).Info("Miembro del proyecto actualizado")
+	_ = fc.FileService.LogRepo.LogEvent("project_member", name, "member: "+member.UserID, ip, "success", "Miembro del proyecto actualizado: "+member.Role)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"member": member, "message": "Miembro del proyecto actualizado"})
+}
+
+// RemoveProjectMemberHandler quita a un miembro del proyecto (administradores
+// del proyecto, o el propio miembro para abandonarlo).
+func (fc *FileController) RemoveProjectMemberHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name, memberID := vars["project"], vars["user_id"]
+	ip := r.RemoteAddr
+
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	if err := fc.ProjectService.RemoveMember(name, userID, memberID); err != nil {
+		fc.writeProjectError(w, err, "project_member", name, userID, ip)
+		return
+	}
+
+	_ = fc.FileService.LogRepo.LogEvent("project_member", name, "member: "+memberID, ip, "success", "Miembro eliminado del proyecto")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Miembro eliminado del proyecto"})
+}
+
+// projectErrorStatus devuelve el código HTTP que corresponde a un error de proyectos.
+func projectErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrProjectNotFound), errors.Is(err, services.ErrMemberNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrProjectForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrProjectExists), errors.Is(err, services.ErrLastProjectAdmin):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrProjectInvalid):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeProjectError registra el error y responde con el código que le corresponde.
+func (fc *FileController) writeProjectError(w http.ResponseWriter, err error, event, project, userID, ip string) {
+	utils.Logger.WithError(err).WithFields(logrus.Fields{"event": event, "project": project, "user_id": userID, "ip": ip}).Error("Error en la operación de proyectos")
+	_ = fc.FileService.LogRepo.LogEvent(event, project, "", ip, "failure", err.Error())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(projectErrorStatus(err))
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": err.Error()})
+}
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/services"
+	"github.com/t-saturn/file-server/utils"
+)
+
+// multipartOverhead tolera los encabezados y separadores del cuerpo multipart
+// al comparar Content-Length con los bytes disponibles de la cuota.
+const multipartOverhead = 16 << 10
+
+// GetQuotaHandler devuelve el uso y los límites de almacenamiento del usuario.
+func (fc *FileController) GetQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	fc.writeQuotaUsage(w, models.QuotaScopeUser, userID)
+}
+
+// GetProjectQuotaHandler devuelve el uso y los límites de almacenamiento de un proyecto.
+func (fc *FileController) GetProjectQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	// Solo los miembros del proyecto ven su uso
+	project := mux.Vars(r)["project"]
+	if err := fc.ProjectService.RequireRole(project, userID, models.ProjectRoleAdmin, models.ProjectRoleEditor, models.ProjectRoleViewer); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(projectErrorStatus(err))
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": err.Error()})
+		return
+	}
+
+	fc.writeQuotaUsage(w, models.QuotaScopeProject, project)
+}
+
+// GetQuotaAdminHandler devuelve la cuota de cualquier usuario o proyecto (solo administradores).
+func (fc *FileController) GetQuotaAdminHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	fc.writeQuotaUsage(w, vars["scope"], vars["subject"])
+}
+
+// UpdateQuotaHandler cambia los límites de un usuario o proyecto (solo administradores).
+// Se espera un JSON con la estructura: { "max_bytes": 10737418240, "max_files": 1000 }.
+func (fc *FileController) UpdateQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	scope, subject := vars["scope"], vars["subject"]
+	ip := r.RemoteAddr
+	adminID, _ := r.Context().Value("user").(string)
+
+	var req models.UpdateQuotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error decodificando JSON: " + err.Error()})
+		return
+	}
+
+	usage, err := fc.QuotaService.SetLimits(scope, subject, req.MaxBytes, req.MaxFiles)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidQuota) {
+			status = http.StatusBadRequest
+		}
+		utils.Logger.WithError(err).WithFields(logrus.Fields{"event": "quota", "scope": scope, "subject": subject, "ip": ip}).Error("Error actualizando la cuota")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": err.Error()})
+		return
+	}
+
+	utils.Logger.WithFields(logrus.Fields{
+		"event": "quota", "scope": scope, "subject": subject, "admin_id": adminID, "ip": ip,
+		"max_bytes": usage.MaxBytes, "max_files": usage.MaxFiles,
+	}).Info("Cuota actualizada")
+	_ = fc.FileService.LogRepo.LogEvent("quota", "", scope+": "+subject, ip, "success", "Cuota actualizada")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"quota": usage, "message": "Cuota actualizada"})
+}
+
+// writeQuotaUsage responde con el uso de la cuota indicada.
+func (fc *FileController) writeQuotaUsage(w http.ResponseWriter, scope, subject string) {
+	usage, err := fc.QuotaService.Usage(scope, subject)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidQuota) {
+			status = http.StatusBadRequest
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"quota": usage})
+}
+
+// checkUploadQuota verifica la cuota del propietario y del proyecto antes de
+// leer el cuerpo de la solicitud y devuelve los bytes disponibles (-1 sin
+// límite) para cortar la transmisión si el cuerpo no declara su tamaño.
+func (fc *FileController) checkUploadQuota(r *http.Request, ownerID, project string, addFiles int64) (int64, error) {
+	remaining, err := fc.QuotaService.Allowance(ownerID, project, addFiles)
+	if err != nil {
+		return 0, err
+	}
+	if remaining >= 0 && r.ContentLength > remaining+multipartOverhead {
+		return 0, fmt.Errorf("%w: el archivo (%d bytes) supera los %d bytes disponibles", services.ErrQuotaExceeded, r.ContentLength, remaining)
+	}
+	return remaining, nil
+}
+
+// uploadErrorStatus devuelve 413 si se excedió la cuota o el tamaño máximo,
+// 415 si el tipo de archivo no está permitido y, si no, el código que
+// corresponde al error de replicación.
+func uploadErrorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, services.ErrQuotaExceeded), errors.Is(err, services.ErrFileTooLarge), errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrMimeTypeNotAllowed):
+		return http.StatusUnsupportedMediaType
+	default:
+		return replicationErrorStatus(err)
+	}
+}
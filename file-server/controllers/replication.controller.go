@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/t-saturn/file-server/services"
+	"github.com/t-saturn/file-server/utils"
+)
+
+// ReplicationQueueHandler expone la profundidad de la cola de replicación.
+func (fc *FileController) ReplicationQueueHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := fc.FileService.Replication.Stats()
+	if err != nil {
+		utils.Logger.WithError(err).Error("Error obteniendo el estado de la cola de replicación")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error obteniendo el estado de la cola de replicación"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"queue":        stats,
+		"replicas":     fc.FileService.ReplicaSvc.Status(),
+		"write_quorum": fc.FileService.Replication.WriteQuorum,
+	})
+}
+
+// InternalManifestHandler devuelve la raíz de Merkle de cada carpeta
+// (parámetro opcional "prefix" para limitar el recorrido).
+func (fc *FileController) InternalManifestHandler(w http.ResponseWriter, r *http.Request) {
+	folders, err := fc.ReconcileService.BuildTree(r.URL.Query().Get("prefix"))
+	if err != nil {
+		utils.Logger.WithError(err).Error("Error construyendo el manifiesto")
+		http.Error(w, "Error construyendo el manifiesto: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"folders": folders})
+}
+
+// InternalManifestFolderHandler devuelve la ruta, el tamaño y el SHA-256 de
+// los archivos de una carpeta.
+func (fc *FileController) InternalManifestFolderHandler(w http.ResponseWriter, r *http.Request) {
+	folder := r.URL.Query().Get("folder")
+	if folder == "" {
+		http.Error(w, "Falta la carpeta", http.StatusBadRequest)
+		return
+	}
+
+	entries, err := fc.ReconcileService.FolderEntries(folder)
+	if err != nil {
+		utils.Logger.WithError(err).WithField("folder", folder).Error("Error construyendo el manifiesto de la carpeta")
+		http.Error(w, "Error construyendo el manifiesto: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"folder": folder, "entries": entries})
+}
+
+// InternalHealthHandler responde a los chequeos de salud del primario.
+func (fc *FileController) InternalHealthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok"})
+}
+
+// replicationErrorStatus devuelve 503 cuando la operación falló por no alcanzar
+// el quórum de réplicas, y 500 para cualquier otro error.
+func replicationErrorStatus(err error) int {
+	if errors.Is(err, services.ErrReplicationQuorum) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/t-saturn/file-server/database"
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/services"
+	"github.com/t-saturn/file-server/utils"
+)
+
+// ListFilesHandler lista los archivos que el usuario puede ver, con filtros,
+// orden y paginación por cursor. Parámetros admitidos:
+//
+//	owner            ID del propietario ("me" para los propios)
+//	project          proyecto del archivo
+//	shared=true      solo archivos de otros usuarios compartidos con el usuario
+//	public           true/false
+//	mime_type        tipo exacto ("application/pdf") o principal ("image/*")
+//	min_size         tamaño mínimo en bytes
+//	max_size         tamaño máximo en bytes
+//	created_after    fecha RFC 3339 o YYYY-MM-DD (inclusive)
+//	created_before   fecha RFC 3339 o YYYY-MM-DD (exclusiva)
+//	q                texto contenido en el nombre
+//	status           estado de integridad: ok, corrupt o missing
+//	sort             created_at (por defecto), updated_at, name o size
+//	order            desc (por defecto) o asc
+//	limit            tamaño de página (por defecto 50, máximo 200)
+//	cursor           next_cursor devuelto por la página anterior
+func (fc *FileController) ListFilesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	filter, err := parseFileFilter(r.URL.Query(), userID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": err.Error()})
+		return
+	}
+
+	page, err := fc.FileService.ListFiles(userID, filter, r.URL.Query().Get("cursor"))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCursor) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"message": "Cursor inválido para este listado"})
+			return
+		}
+		utils.Logger.WithError(err).WithField("user_id", userID).Error("Error listando archivos")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error listando archivos"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"files":       page.Files,
+		"next_cursor": page.NextCursor,
+		"limit":       filter.Limit,
+	})
+}
+
+// parseFileFilter construye el filtro del listado a partir de los parámetros de la URL.
+func parseFileFilter(query url.Values, userID string) (*models.FileFilter, error) {
+	filter := &models.FileFilter{
+		OwnerID:    query.Get("owner"),
+		Project:    query.Get("project"),
+		MimeType:   query.Get("mime_type"),
+		Name:       query.Get("q"),
+		Status:     query.Get("status"),
+		Sort:       "created_at",
+		Descending: true,
+		Limit:      50,
+	}
+	if filter.OwnerID == "me" {
+		filter.OwnerID = userID
+	}
+
+	switch filter.Status {
+	case "", models.FileStatusOK, models.FileStatusCorrupt, models.FileStatusMissing:
+	default:
+		return nil, fmt.Errorf("status inválido: use ok, corrupt o missing")
+	}
+
+	if value := query.Get("sort"); value != "" {
+		if _, ok := database.FileSortColumns[value]; !ok {
+			return nil, fmt.Errorf("sort inválido: use created_at, updated_at, name o size")
+		}
+		filter.Sort = value
+	}
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		filter.Descending = false
+	default:
+		return nil, fmt.Errorf("order inválido: use asc o desc")
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 200 {
+			return nil, fmt.Errorf("limit debe estar entre 1 y 200")
+		}
+		filter.Limit = limit
+	}
+
+	if value := query.Get("shared"); value != "" {
+		shared, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("shared debe ser true o false")
+		}
+		filter.SharedWithMe = shared
+	}
+	if value := query.Get("public"); value != "" {
+		public, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("public debe ser true o false")
+		}
+		filter.IsPublic = &public
+	}
+
+	var err error
+	if filter.MinSize, err = parseSizeParam(query, "min_size"); err != nil {
+		return nil, err
+	}
+	if filter.MaxSize, err = parseSizeParam(query, "max_size"); err != nil {
+		return nil, err
+	}
+	if filter.CreatedAfter, err = parseDateParam(query, "created_after"); err != nil {
+		return nil, err
+	}
+	if filter.CreatedBefore, err = parseDateParam(query, "created_before"); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// parseSizeParam lee un tamaño en bytes no negativo; nil si el parámetro no está.
+func parseSizeParam(query url.Values, name string) (*int64, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("%s debe ser un número de bytes no negativo", name)
+	}
+	return &size, nil
+}
+
+// parseDateParam lee una fecha RFC 3339 o YYYY-MM-DD; nil si el parámetro no está.
+func parseDateParam(query url.Values, name string) (*time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("%s debe tener el formato RFC 3339 o YYYY-MM-DD", name)
+}
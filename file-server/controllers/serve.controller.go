@@ -2,15 +2,23 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"mime"
 	"net/http"
 	"net/url"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"github.com/t-saturn/file-server/database"
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/services"
+	"github.com/t-saturn/file-server/services/storage"
 	"github.com/t-saturn/file-server/utils"
 )
 
@@ -105,9 +113,29 @@ func (fc *FileController) ServeFileHandler(w http.ResponseWriter, r *http.Reques
 			return
 	}
 
-	// Construir la ruta física absoluta
-	filePath := filepath.Join(fc.FileService.StoragePath, fileRecord.URL)
-	
+	// Parámetro opcional para servir una versión anterior
+	if rawVersion := r.URL.Query().Get("version"); rawVersion != "" {
+			version, err := strconv.Atoi(rawVersion)
+			var fileVersion *models.FileVersion
+			if err == nil {
+					fileVersion, err = fc.FileService.GetFileVersion(fileID, version)
+			}
+			if err != nil {
+					response := map[string]interface{}{
+							"message": "Versión no encontrada",
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusNotFound)
+					json.NewEncoder(w).Encode(response)
+					return
+			}
+			fileRecord.URL = fileVersion.URL
+			fileRecord.OriginalName = fileVersion.OriginalName
+			fileRecord.MimeType = fileVersion.MimeType
+			fileRecord.Checksum = fileVersion.Checksum
+			fileRecord.UpdatedAt = fileVersion.CreatedAt
+	}
+
 	// Asegurar que tenemos un nombre de archivo válido
 	filename := fileRecord.OriginalName
 	if filename == "" {
@@ -118,12 +146,18 @@ func (fc *FileController) ServeFileHandler(w http.ResponseWriter, r *http.Reques
 			}
 	}
 	
-	// Determinar el tipo de contenido
-	contentType := mime.TypeByExtension(filepath.Ext(filename))
+	// Determinar el tipo de contenido: el detectado al subir el archivo o,
+	// para registros anteriores a la detección, el de la extensión
+	contentType := fileRecord.MimeType
+	if contentType == "" {
+			contentType = mime.TypeByExtension(filepath.Ext(filename))
+	}
 	if contentType == "" {
 			contentType = "application/octet-stream"
 	}
 	w.Header().Set("Content-Type", contentType)
+	// Evitar que el navegador reinterprete el contenido con otro tipo
+	w.Header().Set("X-Content-Type-Options", "nosniff")
 
 	// Si el archivo es público, podemos servirlo directamente
 	if fileRecord.IsPublic {
@@ -155,47 +189,26 @@ func (fc *FileController) ServeFileHandler(w http.ResponseWriter, r *http.Reques
 					"Acceso a archivo público exitoso",
 			)
 
-			http.ServeFile(w, r, filePath)
+			fc.setCacheControl(w, true)
+			fc.serveStoredFile(w, r, fileRecord, filename)
 			return
 	}
 
-	// Verificar autenticación
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-			msg := "Archivo privado requiere autenticación"
-			utils.Logger.WithFields(logrus.Fields{
+	// Un enlace firmado (parámetro "signature") reemplaza al token
+	access := fc.authorizePrivateFile(r, fileRecord)
+	if access.Status != http.StatusOK {
+			entry := utils.Logger.WithFields(logrus.Fields{
 					"event":   "access",
 					"file_id": fileID,
 					"ip":      ip,
-			}).Warn(msg)
-
-			_ = fc.FileService.LogRepo.LogEvent(
-					"access",
-					"",
-					"file_id: "+fileID,
-					ip,
-					"failure",
-					msg,
-			)
-
-			response := map[string]interface{}{
-					"message": msg,
+			})
+			if access.UserID != "" {
+					entry = entry.WithField("user_id", access.UserID)
 			}
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(response)
-			return
-	}
-
-	// Obtener userID del contexto (si el middleware de auth lo procesó)
-	userID, ok := r.Context().Value("user").(string)
-	if !ok || userID == "" {
-			msg := "Token inválido"
-			utils.Logger.WithFields(logrus.Fields{
-					"event":   "access",
-					"file_id": fileID,
-					"ip":      ip,
-			}).Warn(msg)
+			if access.Err != nil {
+					entry = entry.WithError(access.Err)
+			}
+			entry.Warn(access.Message)
 
 			_ = fc.FileService.LogRepo.LogEvent(
 					"access",
@@ -203,34 +216,14 @@ func (fc *FileController) ServeFileHandler(w http.ResponseWriter, r *http.Reques
 					"file_id: "+fileID,
 					ip,
 					"failure",
-					msg,
+					access.Message,
 			)
 
 			response := map[string]interface{}{
-					"message": msg,
-			}
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(response)
-			return
-	}
-
-	// Verificar permiso
-	allowed, err := fc.FileService.CheckPermission(fileRecord, userID)
-	if err != nil || !allowed {
-			msg := "Acceso denegado"
-			utils.Logger.WithFields(logrus.Fields{
-					"event":   "access",
-					"file_id": fileID,
-					"user_id": userID,
-					"ip":      ip,
-			}).Warn(msg)
-
-			response := map[string]interface{}{
-					"message": msg,
+					"message": access.Message,
 			}
 			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusForbidden)
+			w.WriteHeader(access.Status)
 			json.NewEncoder(w).Encode(response)
 			return
 	}
@@ -247,12 +240,19 @@ func (fc *FileController) ServeFileHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Registrar acceso exitoso
-	utils.Logger.WithFields(logrus.Fields{
+	fields := logrus.Fields{
 			"event":   "access",
 			"file_id": fileID,
-			"user_id": userID,
+			"user_id": access.UserID,
 			"ip":      ip,
-	}).Info("Acceso a archivo exitoso")
+	}
+	msg := "Acceso a archivo exitoso"
+	if access.Signed != nil {
+			fields["signed"] = true
+			fields["single_use"] = access.Signed.Nonce != ""
+			msg = "Acceso a archivo con enlace firmado"
+	}
+	utils.Logger.WithFields(fields).Info(msg)
 
 	_ = fc.FileService.LogRepo.LogEvent(
 			"access",
@@ -260,10 +260,266 @@ func (fc *FileController) ServeFileHandler(w http.ResponseWriter, r *http.Reques
 			"file_id: "+fileID,
 			ip,
 			"success",
-			"Acceso a archivo exitoso",
+			msg,
 	)
 
-	http.ServeFile(w, r, filePath)
+	fc.setCacheControl(w, false)
+	fc.serveStoredFile(w, r, fileRecord, filename)
+}
+
+// fileAccess es el resultado de autorizar el acceso a un archivo privado.
+type fileAccess struct {
+	// Status es 200 si el acceso está permitido; si no, el código de error
+	Status  int
+	Message string
+	Err     error
+	UserID  string
+	// Signed es el enlace firmado usado, o nil si se autorizó con el token
+	Signed *services.SignedURL
+}
+
+// authorizePrivateFile aplica las reglas de acceso a un archivo privado: un
+// enlace firmado válido (parámetro "signature") reemplaza al token; si no, el
+// token debe pertenecer a un usuario con permiso sobre el archivo. La usan
+// ServeFileHandler y ServeThumbnailHandler.
+func (fc *FileController) authorizePrivateFile(r *http.Request, fileRecord *models.File) fileAccess {
+	if r.URL.Query().Get("signature") != "" {
+		signed, err := fc.verifySignedURL(r, fileRecord)
+		if err != nil {
+			msg := "Enlace firmado inválido"
+			if errors.Is(err, services.ErrSignedURLExpired) || errors.Is(err, services.ErrSignedURLUsed) {
+				msg = err.Error()
+			}
+			return fileAccess{Status: http.StatusForbidden, Message: msg, Err: err}
+		}
+		return fileAccess{Status: http.StatusOK, UserID: signed.UserID, Signed: signed}
+	}
+
+	if r.Header.Get("Authorization") == "" {
+		return fileAccess{Status: http.StatusUnauthorized, Message: "Archivo privado requiere autenticación"}
+	}
+	// El middleware de autenticación deja el usuario en el contexto
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		return fileAccess{Status: http.StatusUnauthorized, Message: "Token inválido"}
+	}
+	allowed, err := fc.FileService.CheckPermission(fileRecord, userID)
+	if err != nil || !allowed {
+		return fileAccess{Status: http.StatusForbidden, Message: "Acceso denegado", Err: err, UserID: userID}
+	}
+	return fileAccess{Status: http.StatusOK, UserID: userID}
+}
+
+// serveStoredFile transmite el contenido desde el backend de almacenamiento.
+// El ETag se deriva del SHA-256 guardado y Last-Modified de la fecha del
+// registro, por lo que ambos coinciden entre el primario y las réplicas y no
+// dependen del backend ni de la fecha del archivo en disco. http.ServeContent
+// se encarga de las peticiones Range (incluidas las de varios rangos) y
+// condicionales. Si la copia local falta o no se puede leer, el archivo se
+// sirve desde una réplica y la copia local se repara en segundo plano.
+func (fc *FileController) serveStoredFile(w http.ResponseWriter, r *http.Request, fileRecord *models.File, filename string) {
+	path := fileRecord.URL
+	modTime := fileRecord.UpdatedAt.UTC().Truncate(time.Second)
+	if fileRecord.Checksum != "" {
+		w.Header().Set("ETag", `"`+fileRecord.Checksum+`"`)
+	}
+
+	content, err := fc.FileService.Storage.Open(path)
+	if err == nil {
+		defer content.Close()
+		http.ServeContent(w, r, filename, modTime, content)
+		return
+	}
+
+	utils.Logger.WithError(err).WithField("path", path).Warn("Copia local no disponible, se intenta leer desde una réplica")
+	if replicaErr := fc.serveFromReplica(w, r, path, modTime); replicaErr == nil {
+		go fc.FileService.RepairFromReplica(path)
+		return
+	} else if !errors.Is(replicaErr, storage.ErrNotExist) {
+		utils.Logger.WithError(replicaErr).WithField("path", path).Error("No se pudo leer el archivo desde las réplicas")
+	}
+
+	status := http.StatusInternalServerError
+	msg := "Error leyendo el archivo"
+	if errors.Is(err, storage.ErrNotExist) {
+		status = http.StatusNotFound
+		msg = "Archivo no encontrado"
+	}
+	utils.Logger.WithError(err).WithField("path", path).Error(msg)
+
+	// Descartar las cabeceras de contenido ya preparadas para el archivo
+	w.Header().Del("Content-Disposition")
+	w.Header().Del("ETag")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": msg})
+}
+
+// setCacheControl indica si la respuesta puede guardarse en cachés
+// compartidas: los archivos públicos durante PublicCacheMaxAge; los privados,
+// los enlaces firmados y los enlaces públicos con límites, nunca.
+func (fc *FileController) setCacheControl(w http.ResponseWriter, public bool) {
+	if public && fc.PublicCacheMaxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(fc.PublicCacheMaxAge.Seconds())))
+		return
+	}
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("Vary", "Authorization")
+}
+
+// serveFromReplica reenvía al cliente la respuesta de una réplica, incluidas
+// las respuestas parciales (206) a peticiones Range. Las condiciones
+// (If-None-Match, If-Modified-Since, If-Range...) se evalúan aquí con el ETag
+// y la fecha del registro, ya que los de la réplica dependen de su disco.
+// Solo devuelve error si todavía no se escribió nada en la respuesta.
+func (fc *FileController) serveFromReplica(w http.ResponseWriter, r *http.Request, path string, modTime time.Time) error {
+	etag := w.Header().Get("ETag")
+	if status := checkPreconditions(r, etag, modTime); status != 0 {
+		writeNotModified(w, status, modTime)
+		return nil
+	}
+	rangeHeader := r.Header.Get("Range")
+	if rangeHeader != "" && !ifRangeMatches(r, etag, modTime) {
+		rangeHeader = ""
+	}
+
+	resp, replicaURL, err := fc.FileService.ReadFromReplica(path, rangeHeader)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	for _, header := range []string{"Content-Length", "Content-Range", "Accept-Ranges"} {
+		if value := resp.Header.Get(header); value != "" {
+			w.Header().Set(header, value)
+		}
+	}
+	// Las respuestas de varios rangos llevan su propio tipo con el separador
+	if contentType := resp.Header.Get("Content-Type"); strings.HasPrefix(contentType, "multipart/byteranges") {
+		w.Header().Set("Content-Type", contentType)
+	}
+	if !modTime.IsZero() {
+		w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+	}
+	w.WriteHeader(resp.StatusCode)
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		// La respuesta ya comenzó: solo queda registrar el corte
+		utils.Logger.WithError(err).WithFields(logrus.Fields{"path": path, "replica": replicaURL}).Warn("Transferencia desde la réplica interrumpida")
+	}
+	return nil
+}
+
+// checkPreconditions evalúa las cabeceras condicionales como http.ServeContent
+// (RFC 7232) y devuelve 304 o 412 si la respuesta no debe incluir el
+// contenido, o 0 si debe servirse.
+func checkPreconditions(r *http.Request, etag string, modTime time.Time) int {
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		if !etagListMatches(ifMatch, etag, false) {
+			return http.StatusPreconditionFailed
+		}
+	} else if since, err := http.ParseTime(r.Header.Get("If-Unmodified-Since")); err == nil && !modTime.IsZero() {
+		if modTime.After(since) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	safe := r.Method == http.MethodGet || r.Method == http.MethodHead
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if etagListMatches(ifNoneMatch, etag, true) {
+			if safe {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && safe && !modTime.IsZero() {
+		if !modTime.After(since) {
+			return http.StatusNotModified
+		}
+	}
+	return 0
+}
+
+// ifRangeMatches indica si la petición Range puede atenderse: sin If-Range, o
+// con un If-Range que coincide con el ETag (comparación fuerte) o la fecha.
+func ifRangeMatches(r *http.Request, etag string, modTime time.Time) bool {
+	ifRange := r.Header.Get("If-Range")
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		return etag != "" && !strings.HasPrefix(ifRange, "W/") && ifRange == etag
+	}
+	since, err := http.ParseTime(ifRange)
+	return err == nil && !modTime.IsZero() && modTime.Equal(since)
+}
+
+// etagListMatches indica si alguna de las etiquetas de la cabecera (o "*")
+// coincide con etag. weak permite la comparación débil (If-None-Match).
+func etagListMatches(header, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		} else if strings.HasPrefix(candidate, "W/") {
+			continue
+		}
+		if candidate == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeNotModified responde 304 o 412 sin cuerpo, conservando ETag,
+// Last-Modified y Cache-Control.
+func writeNotModified(w http.ResponseWriter, status int, modTime time.Time) {
+	header := w.Header()
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+	header.Del("Content-Disposition")
+	if status == http.StatusNotModified && !modTime.IsZero() {
+		header.Set("Last-Modified", modTime.Format(http.TimeFormat))
+	}
+	w.WriteHeader(status)
+}
+
+// InternalReadFileHandler permite al primario leer el contenido guardado en la
+// ruta indicada en el parámetro "path" (con soporte de peticiones Range).
+func (fc *FileController) InternalReadFileHandler(w http.ResponseWriter, r *http.Request) {
+	relativePath := r.URL.Query().Get("path")
+	if relativePath == "" {
+		http.Error(w, "Falta la ruta del archivo", http.StatusBadRequest)
+		return
+	}
+
+	info, err := fc.FileService.Storage.Stat(relativePath)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotExist) {
+			http.Error(w, "Archivo no encontrado", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error leyendo el archivo: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	content, err := fc.FileService.Storage.Open(relativePath)
+	if err != nil {
+		http.Error(w, "Error leyendo el archivo: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, "", info.ModTime, content)
 }
 
 // isViewableInBrowser determina si un tipo de contenido generalmente puede
@@ -294,5 +550,9 @@ func isViewableInBrowser(contentType string) bool {
 			"application/vnd.openxmlformats-officedocument.wordprocessingml.document": true,
 	}
 	
+	// Comparar solo el tipo, sin parámetros como "; charset=utf-8"
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+			contentType = mediaType
+	}
 	return viewableTypes[contentType]
 }
\ No newline at end of file
@@ -0,0 +1,18 @@
+package controllers
+
+import "testing"
+
+func TestIsViewableInBrowser(t *testing.T) {
+	for contentType, want := range map[string]bool{
+		"text/plain":                true,
+		"text/plain; charset=utf-8": true,
+		"Text/HTML; charset=UTF-8":  true,
+		"application/pdf":           true,
+		"application/zip":           false,
+		"":                          false,
+	} {
+		if got := isViewableInBrowser(contentType); got != want {
+			t.Errorf("isViewableInBrowser(%q) = %v, se esperaba %v", contentType, got, want)
+		}
+	}
+}
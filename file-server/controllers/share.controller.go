@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/services"
+	"github.com/t-saturn/file-server/utils"
+)
+
+// CreateShareHandler crea un enlace público para un archivo (solo el propietario).
+// Se espera un JSON con la estructura (todos los campos son opcionales):
+// { "password": "secreto", "expires_at": "2025-12-31T23:59:59Z", "max_downloads": 10 }
+func (fc *FileController) CreateShareHandler(w http.ResponseWriter, r *http.Request) {
+	fileID := mux.Vars(r)["id"]
+	ip := r.RemoteAddr
+
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	var req models.ShareLinkRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error decodificando JSON: " + err.Error()})
+			return
+		}
+	}
+
+	share, shareURL, err := fc.ShareService.CreateShare(fileID, userID, req)
+	if err != nil {
+		fc.writeShareError(w, err, "create_share", fileID, ip)
+		return
+	}
+
+	utils.Logger.WithFields(logrus.Fields{
+		"event": "create_share", "file_id": fileID, "share_id": share.ID, "user_id": userID, "ip": ip,
+		"has_password": share.HasPassword, "expires_at": share.ExpiresAt, "max_downloads": share.MaxDownloads,
+	}).Info("Enlace público creado")
+	_ = fc.FileService.LogRepo.LogEvent("create_share", "", "file_id: "+fileID, ip, "success", "Enlace público creado: "+share.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"share":   share,
+		"url":     shareURL,
+		"message": "Enlace público creado; la URL no volverá a mostrarse",
+	})
+}
+
+// ListSharesHandler lista los enlaces públicos activos de un archivo (solo el propietario).
+func (fc *FileController) ListSharesHandler(w http.ResponseWriter, r *http.Request) {
+	fileID := mux.Vars(r)["id"]
+
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	shares, err := fc.ShareService.ListShares(fileID, userID)
+	if err != nil {
+		fc.writeShareError(w, err, "list_shares", fileID, r.RemoteAddr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"shares": shares})
+}
+
+// RevokeShareHandler revoca un enlace público de un archivo (solo el propietario).
+func (fc *FileController) RevokeShareHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	fileID, shareID := vars["id"], vars["share_id"]
+	ip := r.RemoteAddr
+
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	if err := fc.ShareService.RevokeShare(fileID, shareID, userID); err != nil {
+		fc.writeShareError(w, err, "revoke_share", fileID, ip)
+		return
+	}
+
+	_ = fc.FileService.LogRepo.LogEvent("revoke_share", "", "file_id: "+fileID, ip, "success", "Enlace público revocado: "+shareID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Enlace público revocado"})
+}
+
+// ServeShareHandler sirve el archivo de un enlace público sin autenticación.
+// La contraseña, si el enlace la tiene, se envía en el header
+// X-Share-Password o en el campo "password" de un formulario (POST).
+func (fc *FileController) ServeShareHandler(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+	ip := r.RemoteAddr
+
+	password := r.Header.Get("X-Share-Password")
+	if password == "" && r.Method == http.MethodPost {
+		password = r.FormValue("password")
+	}
+	share, fileRecord, err := fc.ShareService.OpenShare(token, password, func(file *models.File) bool {
+		return countsAsDownload(r, file)
+	})
+	if err != nil {
+		fc.writeShareError(w, err, "share_access", "", ip)
+		return
+	}
+
+	filename := setServeHeaders(w, fileRecord, r.URL.Query().Get("download") == "true")
+
+	utils.Logger.WithFields(logrus.Fields{
+		"event": "share_access", "file_id": fileRecord.ID, "share_id": share.ID, "ip": ip,
+	}).Info("Acceso a archivo por enlace público")
+	_ = fc.FileService.LogRepo.LogEvent("share_access", fileRecord.Project, "file_id: "+fileRecord.ID, ip, "success", "Acceso a archivo por enlace público: "+share.ID)
+
+	fc.setCacheControl(w, false)
+	fc.serveStoredFile(w, r, fileRecord, filename)
+}
+
+// countsAsDownload indica si la petición suma una descarga al enlace: toda
+// respuesta con contenido que llegue hasta el último byte del archivo (el
+// archivo completo, un rango abierto o de sufijo, o un If-Range que no
+// coincide). Las peticiones HEAD, las respuestas 304 o 412 y los rangos
+// intermedios de una descarga por partes no se cuentan, de modo que una
+// descarga reanudada suma una sola vez.
+func countsAsDownload(r *http.Request, file *models.File) bool {
+	if r.Method == http.MethodHead {
+		return false
+	}
+	etag := ""
+	if file.Checksum != "" {
+		etag = `"` + file.Checksum + `"`
+	}
+	modTime := file.UpdatedAt.UTC().Truncate(time.Second)
+	if checkPreconditions(r, etag, modTime) != 0 {
+		return false
+	}
+	rangeHeader := r.Header.Get("Range")
+	if rangeHeader == "" || !ifRangeMatches(r, etag, modTime) {
+		return true
+	}
+	return rangeReachesEnd(rangeHeader, file.Size)
+}
+
+// rangeReachesEnd indica si alguno de los rangos de la cabecera Range incluye
+// el último byte de un archivo de size bytes. Si el tamaño no se conoce o la
+// cabecera no se puede interpretar se asume que sí.
+func rangeReachesEnd(rangeHeader string, size int64) bool {
+	spec, ok := strings.CutPrefix(rangeHeader, "bytes=")
+	if !ok || size <= 0 {
+		return true
+	}
+	for _, part := range strings.Split(spec, ",") {
+		start, end, ok := strings.Cut(strings.TrimSpace(part), "-")
+		if !ok {
+			return true
+		}
+		// "bytes=N-" y "bytes=-N" siempre llegan al final
+		if strings.TrimSpace(start) == "" || strings.TrimSpace(end) == "" {
+			return true
+		}
+		last, err := strconv.ParseInt(strings.TrimSpace(end), 10, 64)
+		if err != nil || last >= size-1 {
+			return true
+		}
+	}
+	return false
+}
+
+// setServeHeaders prepara Content-Type y Content-Disposition igual que
+// ServeFileHandler y devuelve el nombre con el que se sirve el archivo.
+func setServeHeaders(w http.ResponseWriter, fileRecord *models.File, forceDownload bool) string {
+	filename := fileRecord.OriginalName
+	if filename == "" {
+		filename = "download" + filepath.Ext(fileRecord.URL)
+	}
+	contentType := fileRecord.MimeType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(filename))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	disposition := "inline"
+	if forceDownload || !isViewableInBrowser(contentType) {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, disposition, filename, url.QueryEscape(filename)))
+	return filename
+}
+
+// writeShareError registra el error y responde con el código que le corresponde.
+func (fc *FileController) writeShareError(w http.ResponseWriter, err error, event, fileID, ip string) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrShareNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrShareForbidden):
+		status = http.StatusForbidden
+	case errors.Is(err, services.ErrShareInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrShareUnavailable):
+		status = http.StatusGone
+	case errors.Is(err, services.ErrSharePasswordRequired), errors.Is(err, services.ErrSharePasswordInvalid):
+		status = http.StatusUnauthorized
+	}
+
+	utils.Logger.WithError(err).WithFields(logrus.Fields{"event": event, "file_id": fileID, "ip": ip}).Warn("Error en la operación de enlaces públicos")
+	_ = fc.FileService.LogRepo.LogEvent(event, "", "file_id: "+fileID, ip, "failure", err.Error())
+
+	message := err.Error()
+	if status == http.StatusInternalServerError {
+		message = "Error procesando el enlace"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":           message,
+		"password_required": errors.Is(err, services.ErrSharePasswordRequired),
+	})
+}
@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/t-saturn/file-server/models"
+)
+
+func TestCountsAsDownload(t *testing.T) {
+	updated := time.Date(2025, 3, 5, 10, 0, 0, 0, time.UTC)
+	file := &models.File{Size: 1000, Checksum: "abc", UpdatedAt: updated}
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    bool
+	}{
+		{"archivo completo", http.MethodGet, nil, true},
+		{"formulario con contraseña", http.MethodPost, nil, true},
+		{"HEAD", http.MethodHead, nil, false},
+		{"primer rango", http.MethodGet, map[string]string{"Range": "bytes=0-499"}, false},
+		{"rango intermedio", http.MethodGet, map[string]string{"Range": "bytes=500-998"}, false},
+		{"último rango", http.MethodGet, map[string]string{"Range": "bytes=500-999"}, true},
+		{"rango más allá del final", http.MethodGet, map[string]string{"Range": "bytes=0-5000"}, true},
+		{"rango abierto", http.MethodGet, map[string]string{"Range": "bytes=1-"}, true},
+		{"rango de sufijo", http.MethodGet, map[string]string{"Range": "bytes=-1000"}, true},
+		{"varios rangos hasta el final", http.MethodGet, map[string]string{"Range": "bytes=0-10,990-999"}, true},
+		{"varios rangos intermedios", http.MethodGet, map[string]string{"Range": "bytes=0-10,20-30"}, false},
+		{"rango inválido", http.MethodGet, map[string]string{"Range": "items=0-10"}, true},
+		{"If-Range coincide", http.MethodGet, map[string]string{"Range": "bytes=0-10", "If-Range": `"abc"`}, false},
+		{"If-Range no coincide", http.MethodGet, map[string]string{"Range": "bytes=0-10", "If-Range": `"otro"`}, true},
+		{"If-None-Match responde 304", http.MethodGet, map[string]string{"If-None-Match": `"abc"`}, false},
+		{"If-Modified-Since responde 304", http.MethodGet, map[string]string{"If-Modified-Since": updated.Format(http.TimeFormat)}, false},
+		{"If-Match responde 412", http.MethodGet, map[string]string{"If-Match": `"otro"`}, false},
+		{"If-None-Match de otra versión", http.MethodGet, map[string]string{"If-None-Match": `"viejo"`}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/share/token", nil)
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			if got := countsAsDownload(r, file); got != tt.want {
+				t.Errorf("countsAsDownload() = %v, se esperaba %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRangeReachesEndUnknownSize(t *testing.T) {
+	if !rangeReachesEnd("bytes=0-10", 0) {
+		t.Error("sin tamaño conocido todo rango debe contarse")
+	}
+}
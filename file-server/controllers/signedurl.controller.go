@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/services"
+	"github.com/t-saturn/file-server/utils"
+)
+
+// CreateSignedURLHandler genera un enlace de descarga firmado y con vencimiento
+// para un archivo al que el usuario tiene acceso. El enlace sirve en lugar del
+// token en GET /files/{id} (etiquetas <img>, reproductores, correos).
+// Se espera un JSON con la estructura:
+// { "expires_in": 3600, "single_use": false, "bind_ip": false, "version": 2, "download": true }
+func (fc *FileController) CreateSignedURLHandler(w http.ResponseWriter, r *http.Request) {
+	fileID := mux.Vars(r)["id"]
+	ip := r.RemoteAddr
+
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	var req models.SignedURLRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error decodificando JSON: " + err.Error()})
+			return
+		}
+	}
+	if req.IP != "" && net.ParseIP(req.IP) == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "ip no es una dirección válida"})
+		return
+	}
+
+	fileRecord, err := fc.FileService.GetFileRecordByID(fileID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Archivo no encontrado"})
+		return
+	}
+	allowed, err := fc.FileService.CheckPermission(fileRecord, userID)
+	if err != nil || !allowed {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Acceso denegado"})
+		return
+	}
+	if req.Version > 0 {
+		if _, err := fc.FileService.GetFileVersion(fileID, req.Version); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"message": "Versión no encontrada"})
+			return
+		}
+	}
+
+	query, expiresAt, err := fc.SignedURLService.Sign(fileID, userID, clientIP(r), req)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidSignedURL) {
+			status = http.StatusBadRequest
+		}
+		utils.Logger.WithError(err).WithFields(logrus.Fields{"event": "signed_url", "file_id": fileID, "ip": ip}).Error("Error generando el enlace firmado")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": err.Error()})
+		return
+	}
+
+	signedURL := strings.TrimRight(fc.FileBaseURL, "/") + "/" + fileID + "?" + query.Encode()
+
+	utils.Logger.WithFields(logrus.Fields{
+		"event": "signed_url", "file_id": fileID, "user_id": userID, "ip": ip,
+		"expires_at": expiresAt, "single_use": req.SingleUse, "ip_bound": query.Get("ip_bound") != "",
+	}).Info("Enlace firmado generado")
+	_ = fc.FileService.LogRepo.LogEvent("signed_url", fileRecord.Project, "file_id: "+fileID, ip, "success", "Enlace firmado generado")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"url":        signedURL,
+		"expires_at": expiresAt,
+		"single_use": req.SingleUse,
+	})
+}
+
+// verifySignedURL valida el enlace firmado de la solicitud: firma, vencimiento,
+// IP y que quien lo generó conserve el acceso al archivo. Los enlaces de un
+// solo uso se consumen aquí.
+func (fc *FileController) verifySignedURL(r *http.Request, fileRecord *models.File) (*services.SignedURL, error) {
+	signed, err := fc.SignedURLService.Verify(fileRecord.ID, r.URL.Query(), clientIP(r))
+	if err != nil {
+		return nil, err
+	}
+	// Revocar el acceso de quien generó el enlace también invalida el enlace
+	allowed, err := fc.FileService.CheckPermission(fileRecord, signed.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, services.ErrInvalidSignedURL
+	}
+	if err := fc.SignedURLService.Consume(fileRecord.ID, signed); err != nil {
+		return nil, err
+	}
+	return signed, nil
+}
+
+// clientIP devuelve la IP de la solicitud sin el puerto.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
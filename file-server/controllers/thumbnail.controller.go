@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/services"
+	"github.com/t-saturn/file-server/utils"
+)
+
+// ServeThumbnailHandler sirve una miniatura de una imagen con los mismos
+// permisos que ServeFileHandler (archivo público, enlace firmado o token).
+// Parámetros: w y h (en píxeles; uno puede omitirse), fit (cover, contain o
+// fill), format (jpeg, png o webp) y version.
+func (fc *FileController) ServeThumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	fileID := mux.Vars(r)["id"]
+	ip := r.RemoteAddr
+	query := r.URL.Query()
+
+	fileRecord, err := fc.FileService.GetFileRecordByID(fileID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Archivo no encontrado"})
+		return
+	}
+
+	if !fileRecord.IsPublic {
+		if access := fc.authorizePrivateFile(r, fileRecord); access.Status != http.StatusOK {
+			utils.Logger.WithFields(logrus.Fields{"event": "thumbnail", "file_id": fileID, "ip": ip}).Warn(access.Message)
+			_ = fc.FileService.LogRepo.LogEvent("thumbnail", "", "file_id: "+fileID, ip, "failure", access.Message)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(access.Status)
+			json.NewEncoder(w).Encode(map[string]interface{}{"message": access.Message})
+			return
+		}
+	}
+
+	if rawVersion := query.Get("version"); rawVersion != "" {
+		version, err := strconv.Atoi(rawVersion)
+		var fileVersion *models.FileVersion
+		if err == nil {
+			fileVersion, err = fc.FileService.GetFileVersion(fileID, version)
+		}
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"message": "Versión no encontrada"})
+			return
+		}
+		fileRecord.URL = fileVersion.URL
+		fileRecord.MimeType = fileVersion.MimeType
+		fileRecord.Checksum = fileVersion.Checksum
+		fileRecord.Version = fileVersion.Version
+		fileRecord.UpdatedAt = fileVersion.CreatedAt
+	}
+
+	width, errW := strconv.Atoi(defaultQuery(query.Get("w"), "0"))
+	height, errH := strconv.Atoi(defaultQuery(query.Get("h"), "0"))
+	if errW != nil || errH != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "w y h deben ser números enteros"})
+		return
+	}
+	spec := services.ThumbnailSpec{Width: width, Height: height, Fit: query.Get("fit"), Format: query.Get("format")}
+	if spec.Width == 0 && spec.Height == 0 {
+		spec.Width, spec.Height = 256, 256
+	}
+
+	thumbnailPath, spec, err := fc.ThumbnailService.Thumbnail(fileRecord, spec)
+	if err != nil {
+		status := http.StatusInternalServerError
+		msg := "Error generando la miniatura"
+		switch {
+		case errors.Is(err, services.ErrThumbnailInvalid):
+			status, msg = http.StatusBadRequest, err.Error()
+		case errors.Is(err, services.ErrThumbnailUnsupported):
+			status, msg = http.StatusUnsupportedMediaType, err.Error()
+		case errors.Is(err, services.ErrThumbnailTooLarge):
+			status, msg = http.StatusRequestEntityTooLarge, err.Error()
+		}
+		utils.Logger.WithError(err).WithFields(logrus.Fields{"event": "thumbnail", "file_id": fileID, "ip": ip}).Error(msg)
+		_ = fc.FileService.LogRepo.LogEvent("thumbnail", fileRecord.Project, "file_id: "+fileID, ip, "failure", err.Error())
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": msg})
+		return
+	}
+
+	content, err := os.Open(thumbnailPath)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error leyendo la miniatura"})
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", "image/"+spec.Format)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if fileRecord.Checksum != "" {
+		w.Header().Set("ETag", `"`+fileRecord.Checksum+"-"+strconv.Itoa(spec.Width)+"x"+strconv.Itoa(spec.Height)+"-"+spec.Fit+"."+spec.Format+`"`)
+	}
+	fc.setCacheControl(w, fileRecord.IsPublic)
+	http.ServeContent(w, r, "", fileRecord.UpdatedAt.UTC().Truncate(time.Second), content)
+}
+
+// defaultQuery devuelve value o, si está vacío, fallback.
+func defaultQuery(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/t-saturn/file-server/services"
+	"github.com/t-saturn/file-server/utils"
+)
+
+// ListTrashHandler devuelve los archivos del usuario que están en la papelera.
+// Admite los parámetros "limit" (máximo 200) y "offset".
+func (fc *FileController) ListTrashHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	limit, offset := 50, 0
+	if value, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && value > 0 && value <= 200 {
+		limit = value
+	}
+	if value, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && value >= 0 {
+		offset = value
+	}
+
+	files, total, err := fc.FileService.ListTrash(userID, limit, offset)
+	if err != nil {
+		utils.Logger.WithError(err).WithField("user_id", userID).Error("Error obteniendo la papelera")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error obteniendo la papelera"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"files":  files,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// RestoreTrashedFileHandler saca un archivo de la papelera.
+func (fc *FileController) RestoreTrashedFileHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	fileID := vars["id"]
+	ip := r.RemoteAddr
+
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	fileRecord, err := fc.FileService.RestoreFile(fileID, userID)
+	if err != nil {
+		status, msg := trashErrorResponse(err, "Error restaurando el archivo")
+		utils.Logger.WithError(err).WithFields(logrus.Fields{"event": "restore", "file_id": fileID, "user_id": userID, "ip": ip}).Error(msg)
+		_ = fc.FileService.LogRepo.LogEvent("restore", "", "file id: "+fileID, ip, "failure", msg)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": msg})
+		return
+	}
+
+	utils.Logger.WithFields(logrus.Fields{"event": "restore", "file_id": fileID, "user_id": userID, "ip": ip}).Info("Archivo restaurado de la papelera")
+	_ = fc.FileService.LogRepo.LogEvent("restore", services.FileProject(fileRecord), fileRecord.URL, ip, "success", "Archivo restaurado de la papelera")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"file": fileRecord, "message": "Archivo restaurado de la papelera"})
+}
+
+// PurgeTrashedFileHandler elimina definitivamente un archivo de la papelera
+// sin esperar a que venza la retención.
+func (fc *FileController) PurgeTrashedFileHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	fileID := vars["id"]
+	ip := r.RemoteAddr
+
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	if err := fc.FileService.PurgeTrashedFile(fileID, userID); err != nil {
+		status, msg := trashErrorResponse(err, "Error eliminando el archivo")
+		utils.Logger.WithError(err).WithFields(logrus.Fields{"event": "purge", "file_id": fileID, "user_id": userID, "ip": ip}).Error(msg)
+		_ = fc.FileService.LogRepo.LogEvent("purge", "", "file id: "+fileID, ip, "failure", msg)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": msg})
+		return
+	}
+
+	utils.Logger.WithFields(logrus.Fields{"event": "purge", "file_id": fileID, "user_id": userID, "ip": ip}).Info("Archivo eliminado definitivamente")
+	_ = fc.FileService.LogRepo.LogEvent("purge", "", "file id: "+fileID, ip, "success", "Archivo eliminado definitivamente")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": fileID, "message": "Archivo eliminado definitivamente"})
+}
+
+// trashErrorResponse traduce los errores de la papelera a un código HTTP y un mensaje.
+func trashErrorResponse(err error, fallback string) (int, string) {
+	switch {
+	case errors.Is(err, services.ErrTrashedFileNotFound):
+		return http.StatusNotFound, "Archivo no encontrado en la papelera"
+	case errors.Is(err, services.ErrReplicationQuorum):
+		return http.StatusServiceUnavailable, "No se alcanzó el quórum de réplicas, inténtalo más tarde"
+	default:
+		return replicationErrorStatus(err), fallback + ": " + err.Error()
+	}
+}
@@ -0,0 +1,272 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/services"
+	"github.com/t-saturn/file-server/utils"
+)
+
+// CreateUploadSessionHandler abre una sesión de subida reanudable para un proyecto.
+func (fc *FileController) CreateUploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	project := vars["project"]
+	ip := r.RemoteAddr
+
+	ownerID, ok := r.Context().Value("user").(string)
+	if !ok || ownerID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	// Se espera un JSON con la estructura: { "original_name": "video.mp4", "size": 1048576, "is_public": false }
+	var req struct {
+		OriginalName string `json:"original_name"`
+		Size         int64  `json:"size"`
+		IsPublic     bool   `json:"is_public"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error decodificando JSON: " + err.Error()})
+		return
+	}
+	if project == "" || req.OriginalName == "" || req.Size < 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "project, original_name y size son requeridos"})
+		return
+	}
+
+	// Solo los administradores y editores del proyecto pueden subir archivos
+	if err := fc.ProjectService.RequireRole(project, ownerID, models.ProjectRoleAdmin, models.ProjectRoleEditor); err != nil {
+		msg := "No se puede subir al proyecto: " + err.Error()
+		utils.Logger.WithFields(logrus.Fields{"event": "upload_session", "project": project, "owner_id": ownerID, "ip": ip}).Error(msg)
+		_ = fc.FileService.LogRepo.LogEvent("upload_session", project, "", ip, "failure", msg)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(projectErrorStatus(err))
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": msg})
+		return
+	}
+
+	// Rechazar la sesión si el tamaño declarado supera el máximo del proyecto;
+	// el tipo de contenido se verifica al finalizar
+	policy, err := fc.PolicyService.Policy(project)
+	if err == nil && policy.MaxSize > 0 && req.Size > policy.MaxSize {
+		err = fmt.Errorf("%w (%d bytes)", services.ErrFileTooLarge, policy.MaxSize)
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		msg := "Error obteniendo la política de subida"
+		if errors.Is(err, services.ErrFileTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+			msg = "No se puede subir el archivo: " + err.Error()
+		}
+		utils.Logger.WithError(err).WithFields(logrus.Fields{"event": "upload_session", "project": project, "ip": ip}).Error(msg)
+		_ = fc.FileService.LogRepo.LogEvent("upload_session", project, "", ip, "failure", msg)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": msg})
+		return
+	}
+
+	// Rechazar la sesión si el tamaño declarado no entra en las cuotas
+	remaining, err := fc.QuotaService.Allowance(ownerID, project, 1)
+	if err == nil && remaining >= 0 && req.Size > remaining {
+		err = fmt.Errorf("%w: el archivo (%d bytes) supera los %d bytes disponibles", services.ErrQuotaExceeded, req.Size, remaining)
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		msg := "Error verificando la cuota"
+		if errors.Is(err, services.ErrQuotaExceeded) {
+			status = http.StatusRequestEntityTooLarge
+			msg = "No se puede subir el archivo: " + err.Error()
+		}
+		utils.Logger.WithError(err).WithFields(logrus.Fields{"event": "upload_session", "project": project, "owner_id": ownerID, "ip": ip}).Error(msg)
+		_ = fc.FileService.LogRepo.LogEvent("upload_session", project, "", ip, "failure", msg)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": msg})
+		return
+	}
+
+	session, err := fc.UploadService.CreateSession(ownerID, project, req.OriginalName, req.Size, req.IsPublic)
+	if err != nil {
+		msg := "Error creando la sesión de subida: " + err.Error()
+		utils.Logger.WithFields(logrus.Fields{"event": "upload_session", "project": project, "ip": ip}).Error(msg)
+		_ = fc.FileService.LogRepo.LogEvent("upload_session", project, "", ip, "failure", msg)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error creando la sesión de subida"})
+		return
+	}
+
+	utils.Logger.WithFields(logrus.Fields{
+		"event": "upload_session", "project": project, "ip": ip,
+		"session_id": session.ID, "size": req.Size,
+	}).Info("Sesión de subida creada")
+	_ = fc.FileService.LogRepo.LogEvent("upload_session", project, "session id: "+session.ID, ip, "success", "Sesión de subida creada")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"session": session, "message": "Sesión de subida creada"})
+}
+
+// GetUploadSessionHandler devuelve el estado de la sesión y los rangos ya recibidos.
+func (fc *FileController) GetUploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID := mux.Vars(r)["session_id"]
+
+	ownerID, ok := r.Context().Value("user").(string)
+	if !ok || ownerID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	session, ranges, err := fc.UploadService.GetSession(sessionID, ownerID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(uploadSessionErrorStatus(err))
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"session": session, "received": ranges})
+}
+
+// UploadChunkHandler recibe un fragmento en el cuerpo de la petición. El
+// parámetro de consulta "offset" indica la posición del primer byte.
+func (fc *FileController) UploadChunkHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID := mux.Vars(r)["session_id"]
+	ip := r.RemoteAddr
+
+	ownerID, ok := r.Context().Value("user").(string)
+	if !ok || ownerID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "offset inválido"})
+		return
+	}
+
+	written, err := fc.UploadService.WriteChunk(sessionID, ownerID, offset, r.Body)
+	if err != nil {
+		utils.Logger.WithError(err).WithFields(logrus.Fields{
+			"event": "upload_chunk", "session_id": sessionID, "offset": offset, "ip": ip,
+		}).Error("Error escribiendo fragmento")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(uploadSessionErrorStatus(err))
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": err.Error()})
+		return
+	}
+
+	_, ranges, err := fc.UploadService.GetSession(sessionID, ownerID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(uploadSessionErrorStatus(err))
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"written": written, "received": ranges})
+}
+
+// CompleteUploadSessionHandler finaliza la sesión y crea el registro del archivo.
+func (fc *FileController) CompleteUploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID := mux.Vars(r)["session_id"]
+	ip := r.RemoteAddr
+
+	ownerID, ok := r.Context().Value("user").(string)
+	if !ok || ownerID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	fileRecord, err := fc.UploadService.Complete(sessionID, ownerID)
+	if err != nil {
+		msg := "Error finalizando la subida: " + err.Error()
+		utils.Logger.WithFields(logrus.Fields{"event": "upload", "session_id": sessionID, "ip": ip}).Error(msg)
+		_ = fc.FileService.LogRepo.LogEvent("upload", "", "session id: "+sessionID, ip, "failure", msg)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(uploadSessionErrorStatus(err))
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": msg})
+		return
+	}
+
+	utils.Logger.WithFields(logrus.Fields{
+		"event": "upload", "session_id": sessionID, "ip": ip,
+		"file_name": fileRecord.OriginalName, "file_id": fileRecord.ID, "is_public": fileRecord.IsPublic,
+	}).Info("Archivo subido exitosamente")
+	_ = fc.FileService.LogRepo.LogEvent("upload", "", fileRecord.URL, ip, "success", "Archivo subido exitosamente")
+	fc.ThumbnailService.Enqueue(fileRecord)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"file": fileRecord, "message": "Archivo subido exitosamente"})
+}
+
+// AbortUploadSessionHandler cancela una sesión pendiente y descarta los datos parciales.
+func (fc *FileController) AbortUploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID := mux.Vars(r)["session_id"]
+
+	ownerID, ok := r.Context().Value("user").(string)
+	if !ok || ownerID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	if err := fc.UploadService.Abort(sessionID, ownerID); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(uploadSessionErrorStatus(err))
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": sessionID, "message": "Sesión de subida cancelada"})
+}
+
+// uploadSessionErrorStatus traduce los errores de UploadService a códigos HTTP.
+func uploadSessionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrUploadSessionNotFound), errors.Is(err, services.ErrProjectNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrUploadSessionForbidden), errors.Is(err, services.ErrProjectForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrUploadSessionClosed), errors.Is(err, services.ErrUploadIncomplete):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrUploadChunkOutOfRange):
+		return http.StatusRequestedRangeNotSatisfiable
+	case errors.Is(err, services.ErrFileTooLarge), errors.Is(err, services.ErrQuotaExceeded):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrMimeTypeNotAllowed):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, services.ErrReplicationQuorum):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
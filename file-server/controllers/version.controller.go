@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/services"
+	"github.com/t-saturn/file-server/utils"
+)
+
+// GetFileVersionsHandler devuelve el historial de versiones de un archivo.
+func (fc *FileController) GetFileVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	fileID := vars["id"]
+
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	fileRecord, err := fc.FileService.GetFileRecordByID(fileID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Archivo no encontrado"})
+		return
+	}
+
+	allowed, err := fc.FileService.CheckPermission(fileRecord, userID)
+	if err != nil || !allowed {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No tienes permisos para acceder al archivo"})
+		return
+	}
+
+	versions, err := fc.FileService.GetFileVersions(fileID)
+	if err != nil {
+		utils.Logger.WithError(err).WithField("file_id", fileID).Error("Error obteniendo versiones")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error obteniendo versiones"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"file_id":         fileID,
+		"current_version": fileRecord.Version,
+		"max_versions":    fc.FileService.MaxVersionsFor(fileRecord),
+		"versions":        versions,
+	})
+}
+
+// RestoreFileVersionHandler publica una versión anterior como la versión vigente.
+func (fc *FileController) RestoreFileVersionHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	fileID := vars["id"]
+	ip := r.RemoteAddr
+
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	version, err := strconv.Atoi(vars["version"])
+	if err != nil || version < 1 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Versión inválida"})
+		return
+	}
+
+	current, err := fc.FileService.GetFileRecordByID(fileID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Archivo no encontrado"})
+		return
+	}
+
+	// Mismo criterio que la actualización del contenido: propietario o editor
+	role, err := fc.FileService.FileRole(current, userID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Error verificando permisos"})
+		return
+	}
+	if role != "owner" && role != "editor" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado para restaurar el archivo"})
+		return
+	}
+
+	fileRecord, err := fc.FileService.RestoreFileVersion(fileID, version, userID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		msg := "Error restaurando la versión"
+		if errors.Is(err, services.ErrFileVersionNotFound) {
+			status = http.StatusNotFound
+			msg = "Versión no encontrada"
+		}
+		utils.Logger.WithError(err).WithFields(logrus.Fields{"event": "restore_version", "file_id": fileID, "version": version, "ip": ip}).Error(msg)
+		_ = fc.FileService.LogRepo.LogEvent("restore_version", "", "file id: "+fileID, ip, "failure", msg)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": msg})
+		return
+	}
+
+	utils.Logger.WithFields(logrus.Fields{
+		"event": "restore_version", "file_id": fileID, "user_id": userID, "ip": ip,
+		"restored_version": version, "new_version": fileRecord.Version,
+	}).Info("Versión restaurada exitosamente")
+	_ = fc.FileService.LogRepo.LogEvent("restore_version", services.FileProject(fileRecord), fileRecord.URL, ip, "success", "Versión "+strconv.Itoa(version)+" restaurada")
+	fc.ThumbnailService.Enqueue(fileRecord)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"file": fileRecord, "message": "Versión restaurada exitosamente"})
+}
+
+// UpdateVersionRetentionHandler cambia cuántas versiones conserva un archivo.
+func (fc *FileController) UpdateVersionRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	fileID := vars["id"]
+	ip := r.RemoteAddr
+
+	userID, ok := r.Context().Value("user").(string)
+	if !ok || userID == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "No autorizado"})
+		return
+	}
+
+	var req models.UpdateVersionRetentionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MaxVersions < 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "Solicitud inválida"})
+		return
+	}
+
+	fileRecord, err := fc.FileService.UpdateVersionRetention(fileID, userID, req.MaxVersions)
+	if err != nil {
+		utils.Logger.WithError(err).WithFields(logrus.Fields{"event": "version_retention", "file_id": fileID, "ip": ip}).Error("Error actualizando la retención de versiones")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": err.Error()})
+		return
+	}
+
+	_ = fc.FileService.LogRepo.LogEvent("version_retention", services.FileProject(fileRecord), fileRecord.URL, ip, "success", "Retención de versiones actualizada")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"file":         fileRecord,
+		"max_versions": fc.FileService.MaxVersionsFor(fileRecord),
+		"message":      "Retención de versiones actualizada",
+	})
+}
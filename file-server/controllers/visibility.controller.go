@@ -90,6 +90,7 @@ func (fc *FileController) UpdateFileVisibilityHandler(w http.ResponseWriter, r *
 
 	// Actualizar el campo localmente para la respuesta
 	fileRecord.IsPublic = req.IsPublic
+	fc.FileService.SyncFileRecord(fileRecord)
 
 	// (Opcional) Registrar la operación
 	utils.Logger.WithFields(logrus.Fields{
@@ -10,14 +10,33 @@ import (
 	"gorm.io/gorm/clause"
 )
 
-// Migrate realiza la migración de los modelos File y FilePermission.
+// Migrate realiza la migración de los modelos de archivos, permisos, eventos, sesiones de subida y cuotas.
 func Migrate(db *gorm.DB) error {
 	// Habilitar la extensión pgcrypto para usar gen_random_uuid()
 	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS pgcrypto;").Error; err != nil {
 		return err
 	}
 	// Realizar las migraciones automáticas
-	if err := db.AutoMigrate(&models.File{}, &models.FilePermission{}, &models.EventLog{}); err != nil {
+	if err := db.AutoMigrate(
+		&models.File{},
+		&models.FilePermission{},
+		&models.EventLog{},
+		&models.UploadSession{},
+		&models.UploadChunk{},
+		&models.ReplicationTask{},
+		&models.FileVersion{},
+		&models.Folder{},
+		&models.Quota{},
+		&models.UploadPolicy{},
+		&models.Project{},
+		&models.ProjectMember{},
+		&models.SignedURLUse{},
+		&models.ShareLink{},
+	); err != nil {
+		return err
+	}
+	// Crear la versión inicial de los archivos anteriores al versionado
+	if err := BackfillFileVersions(db); err != nil {
 		return err
 	}
 	// Crear el índice único para file_permissions
@@ -27,11 +46,64 @@ func Migrate(db *gorm.DB) error {
 `).Error; err != nil {
 		return err
 	}
+	// Completar el proyecto de los archivos anteriores a la columna
+	if err := db.Exec(`
+		UPDATE files SET project = split_part(url, '/', 1)
+		WHERE project = '' AND position('/' in url) > 0
+`).Error; err != nil {
+		return err
+	}
+	// Quitar los parámetros (p.ej. "; charset=utf-8") de los tipos MIME ya guardados
+	for _, table := range []string{"files", "file_versions"} {
+		if err := db.Exec(`
+			UPDATE ` + table + ` SET mime_type = lower(trim(split_part(mime_type, ';', 1)))
+			WHERE mime_type LIKE '%;%'
+`).Error; err != nil {
+			return err
+		}
+	}
+	// Registrar como proyectos los usados por archivos anteriores, con sus propietarios como miembros
+	if err := BackfillProjects(db); err != nil {
+		return err
+	}
+	// Crear el índice único de los nombres de carpeta
+	if err := CreateFolderNameIndex(db); err != nil {
+		return err
+	}
+	if err := createFileListingIndexes(db); err != nil {
+		return err
+	}
+	// Recalcular el uso de las cuotas para corregir desvíos de los contadores
+	return RecalculateQuotaUsage(db)
+}
+
+// createFileListingIndexes crea los índices que usa el listado de archivos.
+// Los índices parciales excluyen la papelera y terminan en id para que la
+// paginación por cursor recorra el índice sin ordenar en memoria.
+func createFileListingIndexes(db *gorm.DB) error {
+	statements := []string{
+		// pg_trgm permite indexar la búsqueda por subcadena del nombre (ILIKE '%texto%')
+		`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+		`CREATE INDEX IF NOT EXISTS files_owner_created_idx ON files (owner_id, created_at, id) WHERE deleted_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS files_project_created_idx ON files (project, created_at, id) WHERE deleted_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS files_public_created_idx ON files (created_at, id) WHERE deleted_at IS NULL AND is_public`,
+		`CREATE INDEX IF NOT EXISTS files_created_idx ON files (created_at, id) WHERE deleted_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS files_updated_idx ON files (updated_at, id) WHERE deleted_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS files_name_idx ON files (original_name, id) WHERE deleted_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS files_size_idx ON files (size, id) WHERE deleted_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS files_mime_type_idx ON files (mime_type text_pattern_ops) WHERE deleted_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS files_name_trgm_idx ON files USING gin (original_name gin_trgm_ops) WHERE deleted_at IS NULL`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // InsertFileRecord inserta un nuevo registro de archivo.
-func InsertFileRecord(db *gorm.DB, originalName, url, ownerID string, isPublic bool) (*models.File, error) {
+func InsertFileRecord(db *gorm.DB, originalName, url, ownerID string, isPublic bool, metadata models.FileMetadata) (*models.File, error) {
 
 	// Generar el ID
 	id := uuid.NewString()
@@ -47,6 +119,11 @@ func InsertFileRecord(db *gorm.DB, originalName, url, ownerID string, isPublic b
 		FileUrl:      fileURL,
 		OwnerID:      ownerID,
 		IsPublic:     isPublic,
+		Project:      metadata.Project,
+		Size:         metadata.Size,
+		MimeType:     metadata.MimeType,
+		Checksum:     metadata.Checksum,
+		Version:      1,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
@@ -64,6 +141,41 @@ func GetFileRecordById(db *gorm.DB, id string) (*models.File, error) {
 	return &file, nil
 }
 
+// GetFileRecordIncludingDeleted obtiene un archivo por su ID aunque esté
+// marcado como eliminado (usado para propagar el borrado a las réplicas).
+func GetFileRecordIncludingDeleted(db *gorm.DB, id string) (*models.File, error) {
+	var file models.File
+	if err := db.Where("id = ?", id).First(&file).Error; err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// UpsertReplicatedFile guarda en la réplica el registro recibido del primario,
+// conservando su ID, y reemplaza sus permisos y versiones por los del primario.
+func UpsertReplicatedFile(db *gorm.DB, replicated *models.ReplicatedFile) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&replicated.File).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("file_id = ?", replicated.File.ID).Delete(&models.FilePermission{}).Error; err != nil {
+			return err
+		}
+		if len(replicated.Permissions) > 0 {
+			if err := tx.Create(&replicated.Permissions).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("file_id = ?", replicated.File.ID).Delete(&models.FileVersion{}).Error; err != nil {
+			return err
+		}
+		if len(replicated.Versions) > 0 {
+			return tx.Create(&replicated.Versions).Error
+		}
+		return nil
+	})
+}
+
 // UpdateFileIsPublic actualiza el estado público/privado de un archivo.
 func UpdateFileIsPublic(db *gorm.DB, fileID string, isPublic bool) error {
 	return db.Model(&models.File{}).
@@ -80,6 +192,80 @@ func DeleteFileRecord(db *gorm.DB, id string) error {
 		Error
 }
 
+// CountBlobReferences cuenta los archivos que usan la ruta relativa, ya sea
+// como contenido vigente o como versión anterior. Los archivos en la papelera
+// también cuentan, porque pueden restaurarse; solo la purga libera el blob.
+// Con excludeFileID se omiten las referencias de ese archivo.
+func CountBlobReferences(db *gorm.DB, url, excludeFileID string) (int64, error) {
+	var files int64
+	err := db.Model(&models.File{}).
+		Where("url = ? AND id <> ?", url, excludeFileID).
+		Count(&files).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var versions int64
+	err = db.Model(&models.FileVersion{}).
+		Where("url = ? AND file_id <> ?", url, excludeFileID).
+		Count(&versions).Error
+	return files + versions, err
+}
+
+// GetTrashedFiles obtiene los archivos de un propietario que están en la
+// papelera, del eliminado más recientemente al más antiguo.
+func GetTrashedFiles(db *gorm.DB, ownerID string, limit, offset int) ([]*models.File, int64, error) {
+	var files []*models.File
+	var total int64
+	query := db.Model(&models.File{}).Where("owner_id = ? AND deleted_at IS NOT NULL", ownerID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Order("deleted_at DESC").Limit(limit).Offset(offset).Find(&files).Error
+	return files, total, err
+}
+
+// GetTrashedFileById obtiene un archivo de la papelera por su ID.
+func GetTrashedFileById(db *gorm.DB, id string) (*models.File, error) {
+	var file models.File
+	if err := db.Where("id = ? AND deleted_at IS NOT NULL", id).First(&file).Error; err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// RestoreFileRecord saca un archivo de la papelera.
+func RestoreFileRecord(db *gorm.DB, id string) error {
+	return db.Model(&models.File{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Updates(map[string]interface{}{"deleted_at": nil, "updated_at": time.Now()}).
+		Error
+}
+
+// GetExpiredTrashedFiles obtiene los archivos que están en la papelera desde antes de before.
+func GetExpiredTrashedFiles(db *gorm.DB, before time.Time, limit int) ([]*models.File, error) {
+	var files []*models.File
+	err := db.Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+		Order("deleted_at ASC").
+		Limit(limit).
+		Find(&files).Error
+	return files, err
+}
+
+// PurgeFileRecord elimina definitivamente el registro de un archivo junto con
+// sus permisos y versiones.
+func PurgeFileRecord(db *gorm.DB, id string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("file_id = ?", id).Delete(&models.FileVersion{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("file_id = ?", id).Delete(&models.FilePermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&models.File{}).Error
+	})
+}
+
 // InsertFilePermissionRecord añade o actualiza un permiso para un archivo.
 func InsertFilePermissionRecord(db *gorm.DB, fileID, userID, role string) (*models.FilePermission, error) {
 	fp := models.FilePermission{
@@ -124,3 +310,35 @@ func CheckUserFilePermission(db *gorm.DB, fileID, userID string) (bool, string,
 	}
 	return true, fp.Role, nil
 }
+
+// GetFilesWithoutChecksum obtiene, ordenados por ID y a partir de afterID, los
+// archivos (incluidos los de la papelera) cuyo contenido aún no tiene checksum.
+func GetFilesWithoutChecksum(db *gorm.DB, afterID string, limit int) ([]*models.File, error) {
+	var files []*models.File
+	err := db.Where("checksum = '' AND id > ?", afterID).Order("id").Limit(limit).Find(&files).Error
+	return files, err
+}
+
+// UpdateFileMetadata guarda el tamaño, el tipo MIME y el checksum del contenido vigente.
+func UpdateFileMetadata(db *gorm.DB, fileID string, metadata models.FileMetadata) error {
+	return db.Model(&models.File{}).
+		Where("id = ?", fileID).
+		Updates(map[string]interface{}{"size": metadata.Size, "mime_type": metadata.MimeType, "checksum": metadata.Checksum}).
+		Error
+}
+
+// GetFilesForScrub obtiene, ordenados por ID y a partir de afterID, los
+// archivos no eliminados que deben verificarse.
+func GetFilesForScrub(db *gorm.DB, afterID string, limit int) ([]*models.File, error) {
+	var files []*models.File
+	err := db.Where("deleted_at IS NULL AND id > ?", afterID).Order("id").Limit(limit).Find(&files).Error
+	return files, err
+}
+
+// UpdateFileIntegrity guarda el resultado de la verificación de integridad de un archivo.
+func UpdateFileIntegrity(db *gorm.DB, fileID, status string, verifiedAt time.Time) error {
+	return db.Model(&models.File{}).
+		Where("id = ?", fileID).
+		Updates(map[string]interface{}{"status": status, "last_verified_at": verifiedAt}).
+		Error
+}
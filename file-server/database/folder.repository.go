@@ -0,0 +1,191 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/t-saturn/file-server/models"
+	"gorm.io/gorm"
+)
+
+// InsertFolder crea una carpeta.
+func InsertFolder(db *gorm.DB, ownerID, name string, parentID *string) (*models.Folder, error) {
+	folder := models.Folder{
+		ID:        uuid.NewString(),
+		Name:      name,
+		ParentID:  parentID,
+		OwnerID:   ownerID,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	err := db.Create(&folder).Error
+	return &folder, err
+}
+
+// CreateFolderNameIndex impide que un usuario tenga dos carpetas con el mismo
+// nombre dentro del mismo padre (la raíz se indexa como el UUID nulo). Antes se
+// renombran los duplicados que pudieran existir, conservando el más antiguo.
+func CreateFolderNameIndex(db *gorm.DB) error {
+	if err := db.Exec(`
+		UPDATE folders SET name = d.name || ' (' || left(d.id::text, 8) || ')', updated_at = now()
+		FROM (
+			SELECT id, name, row_number() OVER (
+				PARTITION BY owner_id, parent_id, name ORDER BY created_at, id
+			) AS n
+			FROM folders
+		) d
+		WHERE folders.id = d.id AND d.n > 1
+`).Error; err != nil {
+		return err
+	}
+	return db.Exec(`
+		CREATE UNIQUE INDEX IF NOT EXISTS folders_owner_parent_name_idx
+		ON folders (owner_id, COALESCE(parent_id, '00000000-0000-0000-0000-000000000000'::uuid), name)
+`).Error
+}
+
+// IsDuplicateKey indica si err es la violación de un índice único.
+func IsDuplicateKey(db *gorm.DB, err error) bool {
+	if translator, ok := db.Dialector.(gorm.ErrorTranslator); ok {
+		err = translator.Translate(err)
+	}
+	return errors.Is(err, gorm.ErrDuplicatedKey)
+}
+
+// GetFolderById obtiene una carpeta por su ID.
+func GetFolderById(db *gorm.DB, id string) (*models.Folder, error) {
+	var folder models.Folder
+	if err := db.Where("id = ?", id).First(&folder).Error; err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// folderScope filtra por carpeta padre; nil indica la raíz del usuario.
+func folderScope(db *gorm.DB, column string, folderID *string) *gorm.DB {
+	if folderID == nil {
+		return db.Where(column + " IS NULL")
+	}
+	return db.Where(column+" = ?", *folderID)
+}
+
+// FolderNameExists indica si el usuario ya tiene una carpeta con ese nombre
+// dentro del mismo padre, sin contar excludeID.
+func FolderNameExists(db *gorm.DB, ownerID string, parentID *string, name, excludeID string) (bool, error) {
+	var count int64
+	query := db.Model(&models.Folder{}).Where("owner_id = ? AND name = ? AND id::text <> ?", ownerID, name, excludeID)
+	err := folderScope(query, "parent_id", parentID).Count(&count).Error
+	return count > 0, err
+}
+
+// GetFolderByName obtiene la carpeta del usuario con ese nombre dentro del
+// padre indicado (nil para la raíz); devuelve nil si no existe.
+func GetFolderByName(db *gorm.DB, ownerID string, parentID *string, name string) (*models.Folder, error) {
+	var folders []*models.Folder
+	query := db.Where("owner_id = ? AND name = ?", ownerID, name)
+	if err := folderScope(query, "parent_id", parentID).Limit(1).Find(&folders).Error; err != nil {
+		return nil, err
+	}
+	if len(folders) == 0 {
+		return nil, nil
+	}
+	return folders[0], nil
+}
+
+// UpdateFolder cambia el nombre y la carpeta padre de una carpeta.
+func UpdateFolder(db *gorm.DB, id, name string, parentID *string) error {
+	return db.Model(&models.Folder{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"name": name, "parent_id": parentID, "updated_at": time.Now()}).
+		Error
+}
+
+// DeleteFolder elimina una carpeta.
+func DeleteFolder(db *gorm.DB, id string) error {
+	return db.Where("id = ?", id).Delete(&models.Folder{}).Error
+}
+
+// CountSubfolders cuenta las carpetas hijas directas de una carpeta del usuario.
+func CountSubfolders(db *gorm.DB, ownerID string, parentID *string) (int64, error) {
+	var count int64
+	query := db.Model(&models.Folder{}).Where("owner_id = ?", ownerID)
+	err := folderScope(query, "parent_id", parentID).Count(&count).Error
+	return count, err
+}
+
+// GetSubfolders obtiene las carpetas hijas directas, ordenadas por nombre.
+func GetSubfolders(db *gorm.DB, ownerID string, parentID *string, limit, offset int) ([]*models.Folder, error) {
+	var folders []*models.Folder
+	query := db.Where("owner_id = ?", ownerID)
+	err := folderScope(query, "parent_id", parentID).
+		Order("name ASC, id ASC").
+		Limit(limit).
+		Offset(offset).
+		Find(&folders).Error
+	return folders, err
+}
+
+// CountFolderFiles cuenta los archivos no eliminados del usuario en una carpeta.
+func CountFolderFiles(db *gorm.DB, ownerID string, folderID *string) (int64, error) {
+	var count int64
+	query := db.Model(&models.File{}).Where("owner_id = ? AND deleted_at IS NULL", ownerID)
+	err := folderScope(query, "folder_id", folderID).Count(&count).Error
+	return count, err
+}
+
+// GetFolderFiles obtiene los archivos no eliminados del usuario en una carpeta, ordenados por nombre.
+func GetFolderFiles(db *gorm.DB, ownerID string, folderID *string, limit, offset int) ([]*models.File, error) {
+	var files []*models.File
+	query := db.Where("owner_id = ? AND deleted_at IS NULL", ownerID)
+	err := folderScope(query, "folder_id", folderID).
+		Order("original_name ASC, id ASC").
+		Limit(limit).
+		Offset(offset).
+		Find(&files).Error
+	return files, err
+}
+
+// UpdateFileFolder mueve el registro de un archivo a otra carpeta.
+func UpdateFileFolder(db *gorm.DB, fileID string, folderID *string) error {
+	return db.Model(&models.File{}).
+		Where("id = ? AND deleted_at IS NULL", fileID).
+		Updates(map[string]interface{}{"folder_id": folderID, "updated_at": time.Now()}).
+		Error
+}
+
+// GetFolderSubtreeIDs obtiene el ID de la carpeta y de todas sus descendientes.
+func GetFolderSubtreeIDs(db *gorm.DB, id string) ([]string, error) {
+	var ids []string
+	err := db.Raw(`
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM folders WHERE id = ?
+			UNION ALL
+			SELECT f.id FROM folders f JOIN subtree s ON f.parent_id = s.id
+		)
+		SELECT id::text FROM subtree
+`, id).Scan(&ids).Error
+	return ids, err
+}
+
+// GetFoldersByIDs obtiene las carpetas indicadas.
+func GetFoldersByIDs(db *gorm.DB, ids []string) ([]*models.Folder, error) {
+	var folders []*models.Folder
+	err := db.Where("id IN ?", ids).Find(&folders).Error
+	return folders, err
+}
+
+// GetFilesInFolders obtiene los archivos no eliminados que están en alguna de las carpetas.
+func GetFilesInFolders(db *gorm.DB, folderIDs []string) ([]*models.File, error) {
+	var files []*models.File
+	err := db.Where("folder_id IN ? AND deleted_at IS NULL", folderIDs).Find(&files).Error
+	return files, err
+}
+
+// ClearFolderReferences deja en la raíz los archivos (incluidos los de la
+// papelera) que apuntan a carpetas eliminadas.
+func ClearFolderReferences(db *gorm.DB, folderIDs []string) error {
+	return db.Model(&models.File{}).
+		Where("folder_id IN ?", folderIDs).
+		Update("folder_id", nil).Error
+}
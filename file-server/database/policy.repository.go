@@ -0,0 +1,39 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/t-saturn/file-server/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetUploadPolicy obtiene la política de subida de un proyecto; nil si no tiene.
+func GetUploadPolicy(db *gorm.DB, project string) (*models.UploadPolicy, error) {
+	var policy models.UploadPolicy
+	err := db.Where("project = ?", project).First(&policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// SaveUploadPolicy crea o reemplaza la política de subida de un proyecto.
+func SaveUploadPolicy(db *gorm.DB, policy *models.UploadPolicy) error {
+	policy.UpdatedAt = time.Now()
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "project"}},
+		DoUpdates: clause.AssignmentColumns([]string{"max_size", "allowed_mime_types", "blocked_mime_types", "updated_at"}),
+	}).Create(policy).Error
+}
+
+// DeleteUploadPolicy elimina la política propia de un proyecto, que vuelve a
+// usar la de la configuración. Devuelve false si no existía.
+func DeleteUploadPolicy(db *gorm.DB, project string) (bool, error) {
+	result := db.Where("project = ?", project).Delete(&models.UploadPolicy{})
+	return result.RowsAffected > 0, result.Error
+}
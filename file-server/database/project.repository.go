@@ -0,0 +1,138 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/t-saturn/file-server/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// InsertProject crea el proyecto y registra a adminID como su administrador.
+// Devuelve false si ya existía un proyecto con ese nombre.
+func InsertProject(db *gorm.DB, project *models.Project, adminID string) (bool, error) {
+	created := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(project)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		created = true
+		_, err := UpsertProjectMember(tx, project.Name, adminID, models.ProjectRoleAdmin)
+		return err
+	})
+	return created, err
+}
+
+// GetProject obtiene un proyecto por su nombre; nil si no existe.
+func GetProject(db *gorm.DB, name string) (*models.Project, error) {
+	var project models.Project
+	err := db.Where("name = ?", name).First(&project).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+// GetUserProjects obtiene los proyectos de los que el usuario es miembro junto
+// con su rol, ordenados por nombre.
+func GetUserProjects(db *gorm.DB, userID string) ([]*models.UserProject, error) {
+	var projects []*models.UserProject
+	err := db.Table("projects").
+		Select("projects.*, m.role").
+		Joins("JOIN project_members m ON m.project = projects.name").
+		Where("m.user_id = ?", userID).
+		Order("projects.name").
+		Scan(&projects).Error
+	return projects, err
+}
+
+// UpdateProjectDescription cambia la descripción de un proyecto.
+func UpdateProjectDescription(db *gorm.DB, name, description string) error {
+	return db.Model(&models.Project{}).Where("name = ?", name).
+		Updates(map[string]interface{}{"description": description, "updated_at": time.Now()}).Error
+}
+
+// GetProjectMembers obtiene los miembros de un proyecto.
+func GetProjectMembers(db *gorm.DB, name string) ([]*models.ProjectMember, error) {
+	var members []*models.ProjectMember
+	err := db.Where("project = ?", name).Order("created_at").Find(&members).Error
+	return members, err
+}
+
+// GetProjectMemberRole obtiene el rol del usuario en el proyecto; "" si no es miembro.
+func GetProjectMemberRole(db *gorm.DB, name, userID string) (string, error) {
+	var member models.ProjectMember
+	err := db.Select("role").Where("project = ? AND user_id = ?", name, userID).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	return member.Role, err
+}
+
+// UpsertProjectMember agrega un miembro al proyecto o cambia su rol.
+func UpsertProjectMember(db *gorm.DB, name, userID, role string) (*models.ProjectMember, error) {
+	member := &models.ProjectMember{Project: name, UserID: userID, Role: role}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "project"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role", "updated_at"}),
+	}).Create(member).Error
+	return member, err
+}
+
+// DeleteProjectMember quita a un miembro del proyecto. Devuelve false si no lo era.
+func DeleteProjectMember(db *gorm.DB, name, userID string) (bool, error) {
+	result := db.Where("project = ? AND user_id = ?", name, userID).Delete(&models.ProjectMember{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// CountProjectAdmins cuenta los administradores de un proyecto.
+func CountProjectAdmins(db *gorm.DB, name string) (int64, error) {
+	var count int64
+	err := db.Model(&models.ProjectMember{}).
+		Where("project = ? AND role = ?", name, models.ProjectRoleAdmin).
+		Count(&count).Error
+	return count, err
+}
+
+// BackfillProjects registra los proyectos usados por archivos anteriores a la
+// tabla de proyectos y, en los que aún no tienen miembros, da el rol de editor
+// a los propietarios de sus archivos y el de administrador al del archivo más
+// antiguo, para que conserven el acceso que tenían antes de los roles.
+func BackfillProjects(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`
+			INSERT INTO projects (name, description, created_by, created_at, updated_at)
+			SELECT DISTINCT ON (project) project, '', owner_id, now(), now()
+			FROM files WHERE project <> ''
+			ORDER BY project, created_at, id
+			ON CONFLICT (name) DO NOTHING
+`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`
+			INSERT INTO project_members (project, user_id, role, created_at, updated_at)
+			SELECT f.project, f.owner_id,
+				CASE WHEN f.owner_id = (
+					SELECT oldest.owner_id FROM files oldest
+					WHERE oldest.project = f.project AND oldest.owner_id <> ''
+					ORDER BY oldest.created_at, oldest.id LIMIT 1
+				) THEN ? ELSE ? END,
+				now(), now()
+			FROM (SELECT DISTINCT project, owner_id FROM files WHERE project <> '' AND owner_id <> '') f
+			WHERE NOT EXISTS (SELECT 1 FROM project_members m WHERE m.project = f.project)
+			ON CONFLICT (project, user_id) DO NOTHING
+`, models.ProjectRoleAdmin, models.ProjectRoleEditor).Error
+	})
+}
+
+// GetProjectFiles obtiene los archivos no eliminados de un proyecto.
+func GetProjectFiles(db *gorm.DB, name string) ([]*models.File, error) {
+	var files []*models.File
+	err := db.Where("project = ? AND deleted_at IS NULL", name).Order("created_at").Find(&files).Error
+	return files, err
+}
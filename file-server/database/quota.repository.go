@@ -0,0 +1,93 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/t-saturn/file-server/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetQuota obtiene la cuota de un usuario o proyecto. Si aún no tiene registro
+// devuelve una cuota sin uso ni límites propios.
+func GetQuota(db *gorm.DB, scope, subject string) (*models.Quota, error) {
+	var quota models.Quota
+	err := db.Where("scope = ? AND subject = ?", scope, subject).First(&quota).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.Quota{Scope: scope, Subject: subject}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &quota, nil
+}
+
+// AddQuotaUsage suma (o resta, con valores negativos) bytes y archivos al uso
+// del propietario y del proyecto en una sola transacción.
+func AddQuotaUsage(db *gorm.DB, ownerID, project string, bytes, files int64) error {
+	if bytes == 0 && files == 0 {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, quota := range []models.Quota{
+			{Scope: models.QuotaScopeUser, Subject: ownerID},
+			{Scope: models.QuotaScopeProject, Subject: project},
+		} {
+			quota.UsedBytes, quota.UsedFiles, quota.UpdatedAt = bytes, files, time.Now()
+			if err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "scope"}, {Name: "subject"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"used_bytes": gorm.Expr("GREATEST(quotas.used_bytes + ?, 0)", bytes),
+					"used_files": gorm.Expr("GREATEST(quotas.used_files + ?, 0)", files),
+					"updated_at": quota.UpdatedAt,
+				}),
+			}).Create(&quota).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetQuotaLimits guarda los límites propios de un usuario o proyecto.
+func SetQuotaLimits(db *gorm.DB, scope, subject string, maxBytes, maxFiles *int64) (*models.Quota, error) {
+	quota := models.Quota{Scope: scope, Subject: subject, MaxBytes: maxBytes, MaxFiles: maxFiles, UpdatedAt: time.Now()}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "scope"}, {Name: "subject"}},
+		DoUpdates: clause.AssignmentColumns([]string{"max_bytes", "max_files", "updated_at"}),
+	}).Create(&quota).Error
+	if err != nil {
+		return nil, err
+	}
+	return GetQuota(db, scope, subject)
+}
+
+// RecalculateQuotaUsage vuelve a calcular el uso de todas las cuotas a partir
+// de los archivos y sus versiones, corrigiendo cualquier desvío de los contadores.
+func RecalculateQuotaUsage(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`UPDATE quotas SET used_bytes = 0, used_files = 0`).Error; err != nil {
+			return err
+		}
+		for scope, column := range map[string]string{
+			models.QuotaScopeUser:    "owner_id",
+			models.QuotaScopeProject: "project",
+		} {
+			if err := tx.Exec(`
+				INSERT INTO quotas (scope, subject, used_bytes, used_files, updated_at)
+				SELECT ?, f.`+column+`, COALESCE(SUM(v.bytes), 0), COUNT(*), now()
+				FROM files f
+				LEFT JOIN (
+					SELECT file_id, SUM(size) AS bytes FROM file_versions GROUP BY file_id
+				) v ON v.file_id = f.id::text
+				GROUP BY f.`+column+`
+				ON CONFLICT (scope, subject) DO UPDATE
+				SET used_bytes = excluded.used_bytes, used_files = excluded.used_files, updated_at = excluded.updated_at
+`, scope).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
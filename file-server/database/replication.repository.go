@@ -0,0 +1,108 @@
+package database
+
+import (
+	"time"
+
+	"github.com/t-saturn/file-server/models"
+	"gorm.io/gorm"
+)
+
+// InsertReplicationTask agrega una operación a la cola de replicación.
+// fileID solo se usa en las operaciones sobre el registro del archivo.
+func InsertReplicationTask(db *gorm.DB, replicaURL, operation, project, path, fileID string, nextAttemptAt time.Time) (*models.ReplicationTask, error) {
+	task := models.ReplicationTask{
+		ReplicaURL:    replicaURL,
+		Operation:     operation,
+		Project:       project,
+		Path:          path,
+		FileID:        fileID,
+		NextAttemptAt: nextAttemptAt,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	err := db.Create(&task).Error
+	return &task, err
+}
+
+// GetDueReplicationTasks obtiene las operaciones cuyo próximo intento ya venció.
+func GetDueReplicationTasks(db *gorm.DB, now time.Time, limit int) ([]*models.ReplicationTask, error) {
+	var tasks []*models.ReplicationTask
+	err := db.Where("next_attempt_at <= ?", now).
+		Order("next_attempt_at ASC, id ASC").
+		Limit(limit).
+		Find(&tasks).Error
+	return tasks, err
+}
+
+// ClaimReplicationTask reserva una operación vencida hasta leaseUntil para que
+// no se ejecute dos veces en paralelo. Devuelve false si ya fue reservada.
+func ClaimReplicationTask(db *gorm.DB, id uint, now, leaseUntil time.Time) (bool, error) {
+	result := db.Model(&models.ReplicationTask{}).
+		Where("id = ? AND next_attempt_at <= ?", id, now).
+		Update("next_attempt_at", leaseUntil)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// RecordReplicationFailure registra un intento fallido y programa el siguiente.
+func RecordReplicationFailure(db *gorm.DB, id uint, attempts int, lastError string, nextAttemptAt time.Time) error {
+	return db.Model(&models.ReplicationTask{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"attempts":        attempts,
+			"last_error":      lastError,
+			"next_attempt_at": nextAttemptAt,
+			"updated_at":      time.Now(),
+		}).Error
+}
+
+// DeleteReplicationTask elimina una operación completada.
+func DeleteReplicationTask(db *gorm.DB, id uint) error {
+	return db.Delete(&models.ReplicationTask{}, id).Error
+}
+
+// HasPendingReplicationTask indica si ya hay una operación pendiente para la
+// misma réplica y ruta.
+func HasPendingReplicationTask(db *gorm.DB, replicaURL, operation, path string) (bool, error) {
+	var count int64
+	err := db.Model(&models.ReplicationTask{}).
+		Where("replica_url = ? AND operation = ? AND path = ?", replicaURL, operation, path).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// DeleteReplicationTasksByPath descarta las operaciones pendientes de una ruta.
+func DeleteReplicationTasksByPath(db *gorm.DB, operation, path string) error {
+	return db.Where("operation = ? AND path = ?", operation, path).
+		Delete(&models.ReplicationTask{}).Error
+}
+
+// GetReplicationQueueStats calcula la profundidad de la cola de replicación.
+func GetReplicationQueueStats(db *gorm.DB) (*models.ReplicationQueueStats, error) {
+	stats := &models.ReplicationQueueStats{}
+	if err := db.Model(&models.ReplicationTask{}).Count(&stats.Pending).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Model(&models.ReplicationTask{}).Where("attempts > 0").Count(&stats.Failing).Error; err != nil {
+		return nil, err
+	}
+
+	var oldest models.ReplicationTask
+	err := db.Order("created_at ASC").First(&oldest).Error
+	if err == nil {
+		stats.OldestTask = &oldest.CreatedAt
+	} else if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	var lastFailed models.ReplicationTask
+	err = db.Where("attempts > 0").Order("updated_at DESC").First(&lastFailed).Error
+	if err == nil {
+		stats.LastFailure = lastFailed.LastError
+	} else if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return stats, nil
+}
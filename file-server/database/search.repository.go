@@ -0,0 +1,96 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"github.com/t-saturn/file-server/models"
+	"gorm.io/gorm"
+)
+
+// FileSortColumns relaciona los valores aceptados en el parámetro "sort" con
+// su columna en la tabla files.
+var FileSortColumns = map[string]string{
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+	"name":       "original_name",
+	"size":       "size",
+}
+
+// SearchFiles lista los archivos no eliminados que el usuario puede ver (propios,
+// compartidos con él, de sus proyectos o públicos) aplicando los filtros de filter. Devuelve como
+// máximo filter.Limit registros ordenados por filter.Sort y luego por id.
+func SearchFiles(db *gorm.DB, userID string, filter *models.FileFilter) ([]*models.File, error) {
+	column, ok := FileSortColumns[filter.Sort]
+	if !ok {
+		column = "created_at"
+	}
+
+	query := db.Model(&models.File{}).
+		Where("files.deleted_at IS NULL").
+		Where(`(files.owner_id = ? OR files.is_public OR EXISTS (
+			SELECT 1 FROM file_permissions p WHERE p.file_id = files.id::text AND p.user_id = ?) OR EXISTS (
+			SELECT 1 FROM project_members m WHERE m.project = files.project AND m.user_id = ?))`, userID, userID, userID)
+
+	if filter.OwnerID != "" {
+		query = query.Where("files.owner_id = ?", filter.OwnerID)
+	}
+	if filter.Project != "" {
+		query = query.Where("files.project = ?", filter.Project)
+	}
+	if filter.SharedWithMe {
+		query = query.Where(`files.owner_id <> ? AND EXISTS (
+			SELECT 1 FROM file_permissions p WHERE p.file_id = files.id::text AND p.user_id = ?)`, userID, userID)
+	}
+	if filter.IsPublic != nil {
+		query = query.Where("files.is_public = ?", *filter.IsPublic)
+	}
+	if filter.MimeType != "" {
+		// "image/*" filtra por tipo principal; cualquier otro valor es exacto
+		if prefix, found := strings.CutSuffix(filter.MimeType, "/*"); found {
+			query = query.Where("files.mime_type LIKE ?", escapeLike(prefix)+"/%")
+		} else {
+			query = query.Where("files.mime_type = ?", filter.MimeType)
+		}
+	}
+	if filter.MinSize != nil {
+		query = query.Where("files.size >= ?", *filter.MinSize)
+	}
+	if filter.MaxSize != nil {
+		query = query.Where("files.size <= ?", *filter.MaxSize)
+	}
+	if filter.CreatedAfter != nil {
+		query = query.Where("files.created_at >= ?", filter.CreatedAfter.UTC().Truncate(time.Microsecond))
+	}
+	if filter.CreatedBefore != nil {
+		query = query.Where("files.created_at < ?", filter.CreatedBefore.UTC().Truncate(time.Microsecond))
+	}
+	if filter.Status != "" {
+		query = query.Where("files.status = ?", filter.Status)
+	}
+	if filter.Name != "" {
+		query = query.Where("files.original_name ILIKE ?", "%"+escapeLike(filter.Name)+"%")
+	}
+
+	direction, comparison := "ASC", ">"
+	if filter.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	if filter.AfterID != "" {
+		// Comparación de filas: continúa justo después del último registro de la página anterior
+		query = query.Where("(files."+column+", files.id) "+comparison+" (?, ?)", filter.AfterValue, filter.AfterID)
+	}
+
+	var files []*models.File
+	err := query.
+		Order("files." + column + " " + direction).
+		Order("files.id " + direction).
+		Limit(filter.Limit).
+		Find(&files).Error
+	return files, err
+}
+
+// escapeLike escapa los comodines de LIKE para buscar el texto literal.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"time"
+
+	"github.com/t-saturn/file-server/models"
+	"gorm.io/gorm"
+)
+
+// InsertShareLink crea un enlace público.
+func InsertShareLink(db *gorm.DB, share *models.ShareLink) error {
+	return db.Create(share).Error
+}
+
+// GetShareLinkByTokenHash obtiene un enlace por el hash de su token.
+func GetShareLinkByTokenHash(db *gorm.DB, tokenHash string) (*models.ShareLink, error) {
+	var share models.ShareLink
+	if err := db.Where("token_hash = ?", tokenHash).First(&share).Error; err != nil {
+		return nil, err
+	}
+	return &share, nil
+}
+
+// GetActiveShareLinks obtiene los enlaces de un archivo que todavía pueden
+// usarse: no revocados, no vencidos y con descargas disponibles.
+func GetActiveShareLinks(db *gorm.DB, fileID string, now time.Time) ([]*models.ShareLink, error) {
+	var shares []*models.ShareLink
+	err := db.Where("file_id = ? AND revoked_at IS NULL", fileID).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Where("max_downloads IS NULL OR download_count < max_downloads").
+		Order("created_at DESC").
+		Find(&shares).Error
+	return shares, err
+}
+
+// RevokeShareLink revoca un enlace del archivo. Devuelve false si no existía o
+// ya estaba revocado.
+func RevokeShareLink(db *gorm.DB, fileID, shareID string, now time.Time) (bool, error) {
+	result := db.Model(&models.ShareLink{}).
+		Where("id = ? AND file_id = ? AND revoked_at IS NULL", shareID, fileID).
+		Update("revoked_at", now)
+	return result.RowsAffected > 0, result.Error
+}
+
+// TouchShareLink registra un acceso al enlace y, si countDownload es true,
+// suma una descarga. La condición se evalúa en la misma sentencia, de modo
+// que dos descargas simultáneas no superan el máximo. Devuelve false si el
+// enlace ya no puede usarse.
+func TouchShareLink(db *gorm.DB, shareID string, countDownload bool, now time.Time) (bool, error) {
+	updates := map[string]interface{}{"last_accessed_at": now}
+	if countDownload {
+		updates["download_count"] = gorm.Expr("download_count + 1")
+	}
+	result := db.Model(&models.ShareLink{}).
+		Where("id = ? AND revoked_at IS NULL", shareID).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Where("max_downloads IS NULL OR download_count < max_downloads").
+		Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
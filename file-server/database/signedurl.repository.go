@@ -0,0 +1,28 @@
+package database
+
+import (
+	"time"
+
+	"github.com/t-saturn/file-server/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ConsumeSignedURL registra el uso de un enlace de un solo uso. Devuelve false
+// si el enlace ya se había usado.
+func ConsumeSignedURL(db *gorm.DB, nonce, fileID string, expiresAt time.Time) (bool, error) {
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.SignedURLUse{
+		Nonce:     nonce,
+		FileID:    fileID,
+		ExpiresAt: expiresAt,
+		UsedAt:    time.Now(),
+	})
+	return result.RowsAffected > 0, result.Error
+}
+
+// DeleteExpiredSignedURLUses elimina los usos de enlaces ya vencidos, que no
+// pueden volver a aceptarse.
+func DeleteExpiredSignedURLUses(db *gorm.DB, now time.Time) (int64, error) {
+	result := db.Where("expires_at < ?", now).Delete(&models.SignedURLUse{})
+	return result.RowsAffected, result.Error
+}
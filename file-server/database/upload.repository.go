@@ -0,0 +1,87 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/t-saturn/file-server/models"
+	"gorm.io/gorm"
+)
+
+// InsertUploadSession crea una nueva sesión de subida reanudable.
+func InsertUploadSession(db *gorm.DB, ownerID, project, originalName string, totalSize int64, isPublic bool, expiresAt time.Time) (*models.UploadSession, error) {
+	session := models.UploadSession{
+		ID:           uuid.NewString(),
+		OwnerID:      ownerID,
+		Project:      project,
+		OriginalName: originalName,
+		TotalSize:    totalSize,
+		IsPublic:     isPublic,
+		Status:       "pending",
+		ExpiresAt:    expiresAt,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	err := db.Create(&session).Error
+	return &session, err
+}
+
+// GetUploadSessionById obtiene una sesión de subida por su ID.
+func GetUploadSessionById(db *gorm.DB, id string) (*models.UploadSession, error) {
+	var session models.UploadSession
+	if err := db.Where("id = ?", id).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// UpdateUploadSessionStatus cambia el estado de una sesión y, si se indica, el archivo resultante.
+func UpdateUploadSessionStatus(db *gorm.DB, id, status string, fileID *string) error {
+	updates := map[string]interface{}{"status": status, "updated_at": time.Now()}
+	if fileID != nil {
+		updates["file_id"] = *fileID
+	}
+	return db.Model(&models.UploadSession{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// InsertUploadChunk registra un fragmento recibido.
+func InsertUploadChunk(db *gorm.DB, sessionID string, offset, size int64) error {
+	chunk := models.UploadChunk{
+		SessionID: sessionID,
+		Offset:    offset,
+		Size:      size,
+		CreatedAt: time.Now(),
+	}
+	return db.Create(&chunk).Error
+}
+
+// GetUploadChunks obtiene los fragmentos de una sesión ordenados por offset.
+func GetUploadChunks(db *gorm.DB, sessionID string) ([]*models.UploadChunk, error) {
+	var chunks []*models.UploadChunk
+	err := db.Where("session_id = ?", sessionID).Order("start_offset ASC").Find(&chunks).Error
+	return chunks, err
+}
+
+// DeleteUploadChunks elimina los fragmentos registrados de una sesión.
+func DeleteUploadChunks(db *gorm.DB, sessionID string) error {
+	return db.Where("session_id = ?", sessionID).Delete(&models.UploadChunk{}).Error
+}
+
+// GetExpiredUploadSessions obtiene las sesiones pendientes cuya fecha de expiración ya pasó.
+func GetExpiredUploadSessions(db *gorm.DB, now time.Time) ([]*models.UploadSession, error) {
+	var sessions []*models.UploadSession
+	err := db.Where("status = ? AND expires_at < ?", "pending", now).Find(&sessions).Error
+	return sessions, err
+}
+
+// ClaimUploadSession marca una sesión pendiente como "finalizing" de forma
+// atómica. Devuelve false si otra petición ya la reclamó o no está pendiente.
+func ClaimUploadSession(db *gorm.DB, id string) (bool, error) {
+	result := db.Model(&models.UploadSession{}).
+		Where("id = ? AND status = ?", id, "pending").
+		Updates(map[string]interface{}{"status": "finalizing", "updated_at": time.Now()})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
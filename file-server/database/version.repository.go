@@ -0,0 +1,150 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/t-saturn/file-server/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// InsertFileVersion registra una versión de un archivo.
+func InsertFileVersion(db *gorm.DB, fileID string, version int, originalName, url, createdBy string, metadata models.FileMetadata) (*models.FileVersion, error) {
+	fv := models.FileVersion{
+		ID:           uuid.NewString(),
+		FileID:       fileID,
+		Version:      version,
+		OriginalName: originalName,
+		URL:          url,
+		Size:         metadata.Size,
+		MimeType:     metadata.MimeType,
+		Checksum:     metadata.Checksum,
+		CreatedBy:    createdBy,
+		CreatedAt:    time.Now(),
+	}
+	err := db.Create(&fv).Error
+	return &fv, err
+}
+
+// AddFileVersion registra un nuevo contenido como la versión vigente del
+// archivo: inserta la versión siguiente y actualiza url, nombre, metadatos y
+// número de versión del registro en una sola transacción.
+func AddFileVersion(db *gorm.DB, fileID, originalName, url, createdBy string, metadata models.FileMetadata) (*models.File, *models.FileVersion, error) {
+	var file models.File
+	var version *models.FileVersion
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Bloquear el registro para que dos actualizaciones no tomen el mismo número
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND deleted_at IS NULL", fileID).
+			First(&file).Error; err != nil {
+			return err
+		}
+
+		var last int
+		if err := tx.Model(&models.FileVersion{}).
+			Where("file_id = ?", fileID).
+			Select("COALESCE(MAX(version), 0)").
+			Scan(&last).Error; err != nil {
+			return err
+		}
+
+		var err error
+		version, err = InsertFileVersion(tx, fileID, last+1, originalName, url, createdBy, metadata)
+		if err != nil {
+			return err
+		}
+
+		file.OriginalName = originalName
+		file.URL = url
+		file.Size = metadata.Size
+		file.MimeType = metadata.MimeType
+		file.Checksum = metadata.Checksum
+		file.Status = models.FileStatusOK
+		file.Version = version.Version
+		file.UpdatedAt = time.Now()
+		return tx.Model(&models.File{}).
+			Where("id = ?", fileID).
+			Updates(map[string]interface{}{
+				"original_name": file.OriginalName,
+				"url":           file.URL,
+				"size":          file.Size,
+				"mime_type":     file.MimeType,
+				"checksum":      file.Checksum,
+				"status":        file.Status,
+				"version":       file.Version,
+				"updated_at":    file.UpdatedAt,
+			}).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &file, version, nil
+}
+
+// GetFileVersions obtiene el historial de versiones de un archivo, de la más reciente a la más antigua.
+func GetFileVersions(db *gorm.DB, fileID string) ([]*models.FileVersion, error) {
+	var versions []*models.FileVersion
+	err := db.Where("file_id = ?", fileID).Order("version DESC").Find(&versions).Error
+	return versions, err
+}
+
+// GetFileVersion obtiene una versión concreta de un archivo.
+func GetFileVersion(db *gorm.DB, fileID string, version int) (*models.FileVersion, error) {
+	var fv models.FileVersion
+	if err := db.Where("file_id = ? AND version = ?", fileID, version).First(&fv).Error; err != nil {
+		return nil, err
+	}
+	return &fv, nil
+}
+
+// GetPrunableFileVersions obtiene las versiones que exceden las keep más
+// recientes. La versión vigente nunca se incluye.
+func GetPrunableFileVersions(db *gorm.DB, fileID string, currentVersion, keep int) ([]*models.FileVersion, error) {
+	var versions []*models.FileVersion
+	err := db.Where("file_id = ? AND version <> ?", fileID, currentVersion).
+		Order("version DESC").
+		Offset(keep - 1).
+		Find(&versions).Error
+	return versions, err
+}
+
+// DeleteFileVersion elimina el registro de una versión.
+func DeleteFileVersion(db *gorm.DB, id string) error {
+	return db.Where("id = ?", id).Delete(&models.FileVersion{}).Error
+}
+
+// UpdateFileMaxVersions cambia la retención de versiones de un archivo (0 usa la del proyecto).
+func UpdateFileMaxVersions(db *gorm.DB, fileID string, maxVersions int) error {
+	return db.Model(&models.File{}).
+		Where("id = ? AND deleted_at IS NULL", fileID).
+		Updates(map[string]interface{}{"max_versions": maxVersions, "updated_at": time.Now()}).
+		Error
+}
+
+// BackfillFileVersions crea la versión 1 de los archivos que aún no tienen
+// historial (registros anteriores al versionado).
+func BackfillFileVersions(db *gorm.DB) error {
+	return db.Exec(`
+		INSERT INTO file_versions (id, file_id, version, original_name, url, size, mime_type, checksum, created_by, created_at)
+		SELECT gen_random_uuid(), f.id, f.version, f.original_name, f.url, f.size, f.mime_type, f.checksum, f.owner_id, f.updated_at
+		FROM files f
+		WHERE NOT EXISTS (SELECT 1 FROM file_versions v WHERE v.file_id = f.id)
+`).Error
+}
+
+// GetFileVersionsWithoutChecksum obtiene, ordenadas por ID y a partir de
+// afterID, las versiones cuyo contenido aún no tiene checksum.
+func GetFileVersionsWithoutChecksum(db *gorm.DB, afterID string, limit int) ([]*models.FileVersion, error) {
+	var versions []*models.FileVersion
+	err := db.Where("checksum = '' AND id > ?", afterID).Order("id").Limit(limit).Find(&versions).Error
+	return versions, err
+}
+
+// UpdateFileVersionMetadata guarda el tamaño, el tipo MIME y el checksum de una versión.
+func UpdateFileVersionMetadata(db *gorm.DB, id string, metadata models.FileMetadata) error {
+	return db.Model(&models.FileVersion{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"size": metadata.Size, "mime_type": metadata.MimeType, "checksum": metadata.Checksum}).
+		Error
+}
@@ -6,9 +6,11 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/t-saturn/file-server/config"
 	"github.com/t-saturn/file-server/database"
+	"github.com/t-saturn/file-server/models"
 	"github.com/t-saturn/file-server/routes"
 	"github.com/t-saturn/file-server/services"
 	"github.com/t-saturn/file-server/services/storage"
@@ -18,6 +20,7 @@ func main() {
 	// Definir banderas para los certificados SSL
 	certFile := flag.String("cert", "", "/certs/wildcard.crt")
 	keyFile := flag.String("key", "", "/certs/wildcard.key")
+	backfill := flag.Bool("backfill", false, "Completa tamaño, tipo MIME y checksum de los archivos existentes y termina")
 	flag.Parse()
 
 	// Cargar configuración
@@ -40,12 +43,79 @@ func main() {
 		panic("Error en la migración de modelos: " + err.Error())
 	}
 
+	// Seleccionar el backend de almacenamiento
+	var store storage.Storage
+	switch cfg.StorageBackend {
+	case "local":
+		store = storage.NewLocalStorage(cfg.StoragePath)
+	case "cas":
+		store = storage.NewContentAddressedStorage(cfg.StoragePath)
+	case "s3":
+		store = storage.NewS3Storage(storage.S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PathStyle: cfg.S3PathStyle,
+		}, cfg.UploadTempPath)
+	default:
+		panic("Backend de almacenamiento desconocido: " + cfg.StorageBackend)
+	}
+
 	// Inicializar servicios
-	replicaSvc := services.NewReplicaService(cfg.ReplicaURL, cfg.ReplicaAuthToken)
-	fileSvc := services.NewFileService(storage.NewLocalStorage(cfg.StoragePath), logRepo, replicaSvc, cfg.StoragePath)
+	replicaSvc := services.NewReplicaService(cfg.ReplicaURLs, cfg.ReplicaAuthToken)
+	replicationQueue := services.NewReplicationQueue(logRepo, store, replicaSvc, cfg.ReplicaWriteQuorum, cfg.ReplicationBaseBackoff, cfg.ReplicationMaxBackoff)
+	fileSvc := services.NewFileService(store, logRepo, replicaSvc, replicationQueue, services.VersionRetention{
+		Default:   cfg.VersionRetention,
+		ByProject: cfg.VersionRetentionByProject,
+	})
+
+	// Migración de metadatos: se ejecuta bajo demanda y no inicia el servidor
+	if *backfill {
+		updated, skipped, err := fileSvc.BackfillFileMetadata()
+		if err != nil {
+			log.Fatalf("Error completando los metadatos de archivos: %v", err)
+		}
+		log.Printf("Metadatos completados: %d registros actualizados, %d omitidos", updated, skipped)
+		return
+	}
+
+	replicaSvc.StartHealthChecks(cfg.ReplicaHealthPeriod)
+	replicationQueue.Start(cfg.ReplicationInterval)
+	fileSvc.StartTrashPurger(cfg.TrashRetention, cfg.TrashPurgeInterval)
+	policySvc := services.NewUploadPolicyService(fileSvc, models.UploadPolicy{
+		MaxSize:          cfg.UploadMaxSize,
+		AllowedMimeTypes: cfg.UploadAllowedMimeTypes,
+		BlockedMimeTypes: cfg.UploadBlockedMimeTypes,
+	})
+	quotaSvc := services.NewQuotaService(fileSvc, services.QuotaLimits{
+		UserBytes:    cfg.QuotaUserBytes,
+		UserFiles:    cfg.QuotaUserFiles,
+		ProjectBytes: cfg.QuotaProjectBytes,
+		ProjectFiles: cfg.QuotaProjectFiles,
+	})
+	projectSvc := services.NewProjectService(fileSvc)
+	uploadSvc := services.NewUploadService(fileSvc, policySvc, quotaSvc, projectSvc, cfg.UploadTempPath, cfg.UploadSessionTTL)
+	uploadSvc.StartCleanup(time.Hour)
+	reconcileSvc := services.NewReconcileService(store, logRepo, replicaSvc, replicationQueue)
+	reconcileSvc.Start(cfg.ReconcileInterval)
+	folderSvc := services.NewFolderService(fileSvc)
+	scrubSvc := services.NewScrubService(fileSvc, cfg.ScrubRateLimit, cfg.ScrubSelfHeal)
+	scrubSvc.Start(cfg.ScrubInterval)
+	if cfg.SignedURLSecretDerived {
+		log.Println("Advertencia: SIGNED_URL_SECRET no está definida; los enlaces firmados usan una clave derivada de JWT_SECRET")
+	}
+	signedURLSvc := services.NewSignedURLService(fileSvc, cfg.SignedURLSecret, cfg.SignedURLMaxTTL)
+	signedURLSvc.StartCleanup(time.Hour)
+	shareSvc := services.NewShareService(fileSvc, cfg.ShareBaseURL)
+	thumbnailSvc := services.NewThumbnailService(fileSvc, cfg.ThumbnailPath, cfg.ThumbnailMaxSize, int64(cfg.ThumbnailMaxPixels), cfg.ThumbnailPresets, cfg.ThumbnailWorkers)
+	thumbnailSvc.StartCleanup(24 * time.Hour)
+	archiveSvc := services.NewArchiveService(fileSvc, folderSvc, projectSvc, cfg.ArchiveMaxFiles, cfg.ArchiveMaxSize)
+	extractSvc := services.NewExtractService(fileSvc, folderSvc, quotaSvc, policySvc, cfg.UploadTempPath, cfg.ExtractMaxEntries, cfg.ExtractMaxSize)
 
 	// Configurar rutas
-	router := routes.SetupRoutes(fileSvc)
+	router := routes.SetupRoutes(fileSvc, uploadSvc, reconcileSvc, folderSvc, quotaSvc, policySvc, projectSvc, signedURLSvc, shareSvc, thumbnailSvc, archiveSvc, extractSvc)
 
 	addr := ":" + strings.TrimSpace(cfg.Port)
 	if *certFile != "" && *keyFile != "" {
@@ -0,0 +1,26 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"github.com/t-saturn/file-server/config"
+)
+
+// AdminMiddleware permite el paso solo a los usuarios listados en ADMIN_USER_IDS.
+// Debe ir después de AuthMiddleware, que deja el usuario en el contexto.
+func AdminMiddleware(cfg config.Config) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, _ := r.Context().Value("user").(string)
+			if userID == "" || !slices.Contains(cfg.AdminUserIDs, userID) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]interface{}{"message": "Se requieren permisos de administrador"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -4,17 +4,320 @@ import (
 	"time"
 )
 
-// File define la estructura de un archivo.
+// File define la estructura de un archivo. Status y LastVerifiedAt guardan el
+// resultado de la última verificación de integridad de su contenido.
 type File struct {
-	ID           string     `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	OriginalName string     `json:"original_name" gorm:"not null"`
-	URL          string     `json:"url" gorm:"not null"`
-	FileUrl      string     `json:"file_url" gorm:"not null"`
-	OwnerID      string     `json:"owner_id" gorm:"not null"`
-	IsPublic     bool       `json:"is_public" gorm:"default:false"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
-	DeletedAt    *time.Time `json:"deleted_at,omitempty" gorm:"index"`
+	ID             string     `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	OriginalName   string     `json:"original_name" gorm:"not null"`
+	URL            string     `json:"url" gorm:"not null"`
+	FileUrl        string     `json:"file_url" gorm:"not null"`
+	OwnerID        string     `json:"owner_id" gorm:"not null"`
+	IsPublic       bool       `json:"is_public" gorm:"default:false"`
+	Project        string     `json:"project" gorm:"not null;default:''"`
+	Size           int64      `json:"size" gorm:"not null;default:0"`
+	MimeType       string     `json:"mime_type" gorm:"not null;default:''"`
+	Checksum       string     `json:"checksum" gorm:"not null;default:''"`
+	Status         string     `json:"status" gorm:"not null;default:'ok';index"`
+	LastVerifiedAt *time.Time `json:"last_verified_at,omitempty"`
+	FolderID       *string    `json:"folder_id,omitempty" gorm:"type:uuid;index"`
+	Version        int        `json:"version" gorm:"not null;default:1"`
+	MaxVersions    int        `json:"max_versions" gorm:"not null;default:0"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty" gorm:"index"`
+}
+
+// Estados de integridad de un archivo (File.Status).
+const (
+	FileStatusOK      = "ok"
+	FileStatusCorrupt = "corrupt"
+	FileStatusMissing = "missing"
+)
+
+// ScrubSummary resume una pasada de verificación de integridad.
+type ScrubSummary struct {
+	Checked    int       `json:"checked"`
+	Corrupt    int       `json:"corrupt"`
+	Missing    int       `json:"missing"`
+	Repaired   int       `json:"repaired"`
+	Skipped    int       `json:"skipped"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// Alcances de una cuota de almacenamiento (Quota.Scope).
+const (
+	QuotaScopeUser    = "user"
+	QuotaScopeProject = "project"
+)
+
+// Quota guarda el uso de almacenamiento de un usuario o un proyecto y, si un
+// administrador los definió, sus límites propios. Un límite nulo usa el valor
+// por defecto de la configuración; 0 indica sin límite. Los bytes cuentan
+// todas las versiones conservadas, incluidas las de archivos en la papelera.
+type Quota struct {
+	Scope     string    `json:"scope" gorm:"primaryKey"`
+	Subject   string    `json:"subject" gorm:"primaryKey"`
+	MaxBytes  *int64    `json:"max_bytes"`
+	MaxFiles  *int64    `json:"max_files"`
+	UsedBytes int64     `json:"used_bytes" gorm:"not null;default:0"`
+	UsedFiles int64     `json:"used_files" gorm:"not null;default:0"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// QuotaUsage es el uso de una cuota junto con los límites vigentes (0 sin límite).
+type QuotaUsage struct {
+	Scope     string `json:"scope"`
+	Subject   string `json:"subject"`
+	UsedBytes int64  `json:"used_bytes"`
+	UsedFiles int64  `json:"used_files"`
+	MaxBytes  int64  `json:"max_bytes"`
+	MaxFiles  int64  `json:"max_files"`
+	// Custom indica que los límites fueron definidos por un administrador
+	Custom bool `json:"custom"`
+}
+
+// UpdateQuotaRequest estructura para que un administrador cambie los límites
+// de una cuota; null vuelve al valor por defecto y 0 quita el límite.
+type UpdateQuotaRequest struct {
+	MaxBytes *int64 `json:"max_bytes"`
+	MaxFiles *int64 `json:"max_files"`
+}
+
+// Roles de un miembro de proyecto (ProjectMember.Role). El administrador
+// gestiona los miembros, el editor sube y modifica archivos y el lector solo
+// accede a ellos.
+const (
+	ProjectRoleAdmin  = "admin"
+	ProjectRoleEditor = "editor"
+	ProjectRoleViewer = "viewer"
+)
+
+// Project es un proyecto de archivos. Su nombre es el {project} de las rutas
+// de subida y el primer segmento de la ruta de almacenamiento de sus archivos.
+type Project struct {
+	Name        string    `json:"name" gorm:"primaryKey"`
+	Description string    `json:"description"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ProjectMember da a un usuario acceso a todos los archivos de un proyecto,
+// además de los permisos que tenga sobre cada archivo.
+type ProjectMember struct {
+	Project   string    `json:"project" gorm:"primaryKey"`
+	UserID    string    `json:"user_id" gorm:"primaryKey;index"`
+	Role      string    `json:"role" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// UserProject es un proyecto junto con el rol que tiene el usuario en él.
+type UserProject struct {
+	Project
+	Role string `json:"role"`
+}
+
+// ProjectRequest estructura para crear un proyecto o cambiar su descripción.
+type ProjectRequest struct {
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description"`
+}
+
+// ProjectMemberRequest estructura para agregar un miembro o cambiar su rol.
+type ProjectMemberRequest struct {
+	UserID string `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+// Formatos de descarga de varios archivos (ArchiveRequest.Format).
+const (
+	ArchiveFormatZip   = "zip"
+	ArchiveFormatTarGz = "tar.gz"
+)
+
+// ArchiveRequest estructura para descargar varios archivos en un solo
+// archivo comprimido. Se indica una lista de archivos, una carpeta (con sus
+// subcarpetas) o un proyecto; Format es "zip" (por defecto) o "tar.gz".
+type ArchiveRequest struct {
+	FileIDs  []string `json:"file_ids,omitempty"`
+	FolderID *string  `json:"folder_id,omitempty"`
+	Project  string   `json:"project,omitempty"`
+	Format   string   `json:"format,omitempty"`
+	Name     string   `json:"name,omitempty"`
+}
+
+// Resultado de cada entrada al extraer un archivo comprimido (ExtractEntryResult.Status).
+const (
+	ExtractStatusCreated = "created"
+	ExtractStatusSkipped = "skipped"
+	ExtractStatusFailed  = "failed"
+)
+
+// ExtractEntryResult es el resultado de una entrada de un archivo comprimido
+// extraído en el servidor.
+type ExtractEntryResult struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	File   *File  `json:"file,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ExtractReport resume la extracción de un archivo comprimido. Truncated
+// indica que la extracción se detuvo al alcanzar un límite.
+type ExtractReport struct {
+	Format    string               `json:"format"`
+	Created   int                  `json:"created"`
+	Skipped   int                  `json:"skipped"`
+	Failed    int                  `json:"failed"`
+	Truncated bool                 `json:"truncated"`
+	Entries   []ExtractEntryResult `json:"entries"`
+}
+
+// ShareLink es un enlace público a un archivo identificado por un token
+// aleatorio. Solo se guarda el SHA-256 del token (TokenPrefix ayuda a
+// reconocerlo) y el hash bcrypt de la contraseña, si tiene. Los límites nulos
+// indican sin vencimiento o sin máximo de descargas.
+type ShareLink struct {
+	ID             string     `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	FileID         string     `json:"file_id" gorm:"not null;index"`
+	TokenHash      string     `json:"-" gorm:"not null;uniqueIndex"`
+	TokenPrefix    string     `json:"token_prefix"`
+	PasswordHash   string     `json:"-"`
+	HasPassword    bool       `json:"has_password" gorm:"not null;default:false"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	MaxDownloads   *int       `json:"max_downloads"`
+	DownloadCount  int        `json:"download_count" gorm:"not null;default:0"`
+	RevokedAt      *time.Time `json:"revoked_at"`
+	LastAccessedAt *time.Time `json:"last_accessed_at"`
+	CreatedBy      string     `json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// ShareLinkRequest estructura para crear un enlace público; todos los campos
+// son opcionales.
+type ShareLinkRequest struct {
+	Password     string     `json:"password,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	MaxDownloads *int       `json:"max_downloads,omitempty"`
+}
+
+// SignedURLRequest estructura para generar un enlace firmado de descarga.
+// ExpiresIn está en segundos; BindIP limita el enlace a la IP de quien lo pide
+// (o a IP si se indica); Version y Download equivalen a los parámetros
+// "version" y "download" de GET /files/{id}.
+type SignedURLRequest struct {
+	ExpiresIn int    `json:"expires_in"`
+	SingleUse bool   `json:"single_use"`
+	BindIP    bool   `json:"bind_ip"`
+	IP        string `json:"ip,omitempty"`
+	Version   int    `json:"version,omitempty"`
+	Download  bool   `json:"download,omitempty"`
+}
+
+// SignedURLUse registra el uso de un enlace firmado de un solo uso. Se conserva
+// hasta que el enlace vence.
+type SignedURLUse struct {
+	Nonce     string    `json:"nonce" gorm:"primaryKey"`
+	FileID    string    `json:"file_id" gorm:"not null"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"`
+	UsedAt    time.Time `json:"used_at"`
+}
+
+// UploadPolicy define las reglas de subida de un proyecto: tamaño máximo por
+// archivo en bytes (0 sin límite) y tipos MIME permitidos y bloqueados, que se
+// verifican sobre el contenido y no solo sobre la extensión. Los tipos admiten
+// comodines como "image/*"; una lista de permitidos vacía admite cualquier tipo
+// no bloqueado. Los proyectos sin política usan la de la configuración.
+type UploadPolicy struct {
+	Project          string    `json:"project" gorm:"primaryKey"`
+	MaxSize          int64     `json:"max_size" gorm:"not null;default:0"`
+	AllowedMimeTypes []string  `json:"allowed_mime_types" gorm:"type:jsonb;serializer:json"`
+	BlockedMimeTypes []string  `json:"blocked_mime_types" gorm:"type:jsonb;serializer:json"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	// Default indica que el proyecto no tiene política propia
+	Default bool `json:"default" gorm:"-"`
+}
+
+// UploadPolicyRequest estructura para que un administrador defina la política
+// de subida de un proyecto.
+type UploadPolicyRequest struct {
+	MaxSize          int64    `json:"max_size"`
+	AllowedMimeTypes []string `json:"allowed_mime_types"`
+	BlockedMimeTypes []string `json:"blocked_mime_types"`
+}
+
+// FileMetadata describe un contenido guardado: proyecto, tamaño en bytes, tipo
+// MIME detectado a partir de los primeros bytes y SHA-256 en hexadecimal.
+type FileMetadata struct {
+	Project  string
+	Size     int64
+	MimeType string
+	Checksum string
+}
+
+// FileFilter define los filtros, el orden y la página de un listado de
+// archivos. Los punteros nulos indican que el filtro no se aplica.
+type FileFilter struct {
+	OwnerID       string
+	Project       string
+	SharedWithMe  bool
+	IsPublic      *bool
+	MimeType      string
+	MinSize       *int64
+	MaxSize       *int64
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Name          string
+	Status        string
+	Sort          string
+	Descending    bool
+	Limit         int
+	// Posición a partir de la cual continúa el listado (paginación por cursor)
+	AfterValue interface{}
+	AfterID    string
+}
+
+// FileVersion guarda cada contenido que tuvo un archivo. La versión vigente
+// coincide con File.Version y File.URL; MaxVersions = 0 en el archivo indica
+// que se usa la retención por defecto de su proyecto.
+type FileVersion struct {
+	ID           string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	FileID       string    `json:"file_id" gorm:"not null;uniqueIndex:file_versions_file_id_version_idx"`
+	Version      int       `json:"version" gorm:"not null;uniqueIndex:file_versions_file_id_version_idx"`
+	OriginalName string    `json:"original_name" gorm:"not null"`
+	URL          string    `json:"url" gorm:"not null;index"`
+	Size         int64     `json:"size" gorm:"not null;default:0"`
+	MimeType     string    `json:"mime_type" gorm:"not null;default:''"`
+	Checksum     string    `json:"checksum" gorm:"not null;default:''"`
+	CreatedBy    string    `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// UpdateVersionRetentionRequest estructura para cambiar la retención de versiones de un archivo.
+type UpdateVersionRetentionRequest struct {
+	MaxVersions int `json:"max_versions"`
+}
+
+// Folder es una carpeta virtual del usuario. Las carpetas solo organizan los
+// registros de archivos: mover un archivo entre carpetas no mueve su contenido.
+// ParentID nulo indica una carpeta en la raíz.
+type Folder struct {
+	ID        string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	Name      string    `json:"name" gorm:"not null"`
+	ParentID  *string   `json:"parent_id" gorm:"type:uuid;index"`
+	OwnerID   string    `json:"owner_id" gorm:"not null;index"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// FolderRequest estructura para crear, renombrar o mover una carpeta y para
+// mover un archivo a una carpeta (folder_id nulo indica la raíz).
+type FolderRequest struct {
+	Name     string  `json:"name,omitempty"`
+	ParentID *string `json:"parent_id,omitempty"`
+	FolderID *string `json:"folder_id,omitempty"`
 }
 
 // FilePermission define los permisos asociados a un archivo.
@@ -45,3 +348,94 @@ type EventLog struct {
 	Message   string    `json:"message"`
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// UploadSession representa una subida reanudable por fragmentos.
+type UploadSession struct {
+	ID           string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	OwnerID      string    `json:"owner_id" gorm:"not null;index"`
+	Project      string    `json:"project" gorm:"not null"`
+	OriginalName string    `json:"original_name" gorm:"not null"`
+	TotalSize    int64     `json:"total_size" gorm:"not null"`
+	IsPublic     bool      `json:"is_public" gorm:"default:false"`
+	Status       string    `json:"status" gorm:"not null;default:'pending'"`
+	FileID       *string   `json:"file_id,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// UploadChunk registra un rango de bytes recibido dentro de una sesión de subida.
+type UploadChunk struct {
+	ID        uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	SessionID string    `json:"session_id" gorm:"not null;index"`
+	Offset    int64     `json:"offset" gorm:"column:start_offset;not null"`
+	Size      int64     `json:"size" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ByteRange describe un rango contiguo de bytes [Start, End).
+type ByteRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// ReplicationTask es una operación de replicación pendiente (outbox). Se
+// elimina cuando la réplica confirma la operación; mientras tanto registra los
+// intentos realizados y el último error.
+type ReplicationTask struct {
+	ID            uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	ReplicaURL    string    `json:"replica_url" gorm:"index"`
+	Operation     string    `json:"operation" gorm:"not null"`
+	Project       string    `json:"project"`
+	Path          string    `json:"path" gorm:"not null;index"`
+	FileID        string    `json:"file_id,omitempty"`
+	Attempts      int       `json:"attempts" gorm:"not null;default:0"`
+	LastError     string    `json:"last_error"`
+	NextAttemptAt time.Time `json:"next_attempt_at" gorm:"index"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// ReplicatedFile es el registro de un archivo tal como se envía a las réplicas:
+// mismo ID, misma ruta relativa, los permisos asociados y su historial de versiones.
+type ReplicatedFile struct {
+	File        File             `json:"file"`
+	Permissions []FilePermission `json:"permissions"`
+	Versions    []FileVersion    `json:"versions"`
+}
+
+// ManifestEntry describe un archivo guardado, tal como se compara entre el
+// primario y una réplica.
+type ManifestEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// ManifestFolder resume una carpeta (p.ej. <project>/<YYYY>/<MM>/<DD>) con la
+// raíz del árbol de Merkle calculado sobre sus archivos.
+type ManifestFolder struct {
+	Folder string `json:"folder"`
+	Root   string `json:"root"`
+	Files  int    `json:"files"`
+}
+
+// ReconcileSummary resume una pasada de reconciliación con una réplica.
+type ReconcileSummary struct {
+	ReplicaURL       string `json:"replica_url"`
+	FoldersChecked   int    `json:"folders_checked"`
+	FoldersDiffering int    `json:"folders_differing"`
+	Missing          int    `json:"missing"`
+	Mismatched       int    `json:"mismatched"`
+	Extra            int    `json:"extra"`
+	Enqueued         int    `json:"enqueued"`
+	Error            string `json:"error,omitempty"`
+}
+
+// ReplicationQueueStats resume el estado de la cola de replicación.
+type ReplicationQueueStats struct {
+	Pending     int64      `json:"pending"`
+	Failing     int64      `json:"failing"`
+	OldestTask  *time.Time `json:"oldest_task,omitempty"`
+	LastFailure string     `json:"last_failure,omitempty"`
+}
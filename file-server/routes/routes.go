@@ -28,11 +28,11 @@ func FileMiddleware(cfg config.Config, fileService *services.FileService) mux.Mi
 	}
 }
 
-func SetupRoutes(fileService *services.FileService) *mux.Router {
+func SetupRoutes(fileService *services.FileService, uploadService *services.UploadService, reconcileService *services.ReconcileService, folderService *services.FolderService, quotaService *services.QuotaService, policyService *services.UploadPolicyService, projectService *services.ProjectService, signedURLService *services.SignedURLService, shareService *services.ShareService, thumbnailService *services.ThumbnailService, archiveService *services.ArchiveService, extractService *services.ExtractService) *mux.Router {
 	cfg := config.LoadConfig()
 
 	// Creamos el controlador de archivos con el servicio, URL base, repositorio y ruta de almacenamiento.
-	fileController := controllers.NewFileController(fileService, cfg.FileBaseURL)
+	fileController := controllers.NewFileController(fileService, uploadService, reconcileService, folderService, quotaService, policyService, projectService, signedURLService, shareService, thumbnailService, archiveService, extractService, cfg.FileBaseURL, cfg.PublicCacheMaxAge)
 
 	router := mux.NewRouter()
 	router.Use(middlewares.CORSMiddleware)
@@ -41,12 +41,35 @@ func SetupRoutes(fileService *services.FileService) *mux.Router {
 	api := router.PathPrefix("/api").Subrouter()
 	api.Use(middlewares.AuthMiddleware(cfg, fileService.LogRepo))
 
-	// Endpoint para subir archivos.
+	// Endpoint para subir archivos (con ?extract=true se extrae un ZIP o tar.gz).
+	api.HandleFunc("/file/upload/{project}", fileController.ExtractUploadHandler).Methods("POST").Queries("extract", "true")
 	api.HandleFunc("/file/upload/{project}", fileController.UploadFileHandler).Methods("POST")
 	api.HandleFunc("/file/upload/{project}", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	}).Methods("OPTIONS")
 
+	// Endpoint con la política de subida vigente del proyecto.
+	api.HandleFunc("/file/upload/{project}/policy", fileController.GetUploadPolicyHandler).Methods("GET")
+
+	// Endpoints para subidas reanudables por fragmentos.
+	api.HandleFunc("/file/upload/{project}/sessions", fileController.CreateUploadSessionHandler).Methods("POST")
+	api.HandleFunc("/file/upload/sessions/{session_id}", fileController.GetUploadSessionHandler).Methods("GET")
+	api.HandleFunc("/file/upload/sessions/{session_id}", fileController.UploadChunkHandler).Methods("PUT")
+	api.HandleFunc("/file/upload/sessions/{session_id}", fileController.AbortUploadSessionHandler).Methods("DELETE")
+	api.HandleFunc("/file/upload/sessions/{session_id}/complete", fileController.CompleteUploadSessionHandler).Methods("POST")
+
+	// Endpoint para listar y buscar archivos.
+	api.HandleFunc("/files", fileController.ListFilesHandler).Methods("GET")
+	api.HandleFunc("/files", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("OPTIONS")
+
+	// Endpoint para descargar varios archivos en un ZIP o tar.gz.
+	api.HandleFunc("/files/archive", fileController.ArchiveFilesHandler).Methods("POST")
+	api.HandleFunc("/files/archive", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("OPTIONS")
+
 	// Endpoint para actualizar un archivo por su ID.
 	api.HandleFunc("/file/{id}", fileController.UpdateFileHandler).Methods("PUT")
 	api.HandleFunc("/file/{id}", func(w http.ResponseWriter, r *http.Request) {
@@ -71,6 +94,93 @@ func SetupRoutes(fileService *services.FileService) *mux.Router {
 		w.WriteHeader(http.StatusOK)
 	}).Methods("OPTIONS")
 
+	// Endpoints para el historial de versiones de un archivo.
+	api.HandleFunc("/file/{id}/versions", fileController.GetFileVersionsHandler).Methods("GET")
+	api.HandleFunc("/file/{id}/versions/retention", fileController.UpdateVersionRetentionHandler).Methods("PUT")
+	api.HandleFunc("/file/{id}/versions/{version}/restore", fileController.RestoreFileVersionHandler).Methods("POST")
+	api.HandleFunc("/file/{id}/versions", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("OPTIONS")
+
+	// Endpoint para generar enlaces de descarga firmados.
+	api.HandleFunc("/file/{id}/signed-url", fileController.CreateSignedURLHandler).Methods("POST")
+	api.HandleFunc("/file/{id}/signed-url", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("OPTIONS")
+
+	// Endpoints de enlaces públicos de un archivo.
+	api.HandleFunc("/file/{id}/shares", fileController.CreateShareHandler).Methods("POST")
+	api.HandleFunc("/file/{id}/shares", fileController.ListSharesHandler).Methods("GET")
+	api.HandleFunc("/file/{id}/shares/{share_id}", fileController.RevokeShareHandler).Methods("DELETE")
+	api.HandleFunc("/file/{id}/shares", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("OPTIONS")
+
+	// Endpoint para mover un archivo a otra carpeta.
+	api.HandleFunc("/file/{id}/folder", fileController.MoveFileToFolderHandler).Methods("PUT")
+	api.HandleFunc("/file/{id}/folder", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("OPTIONS")
+
+	// Endpoints de carpetas ("root" lista la raíz del usuario).
+	api.HandleFunc("/folders", fileController.CreateFolderHandler).Methods("POST")
+	api.HandleFunc("/folders/{id}", fileController.ListFolderHandler).Methods("GET")
+	api.HandleFunc("/folders/{id}", fileController.UpdateFolderHandler).Methods("PUT")
+	api.HandleFunc("/folders/{id}/move", fileController.MoveFolderHandler).Methods("PUT")
+	api.HandleFunc("/folders/{id}", fileController.DeleteFolderHandler).Methods("DELETE")
+	api.HandleFunc("/folders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("OPTIONS")
+
+	// Endpoints de proyectos y sus miembros.
+	api.HandleFunc("/projects", fileController.CreateProjectHandler).Methods("POST")
+	api.HandleFunc("/projects", fileController.ListProjectsHandler).Methods("GET")
+	api.HandleFunc("/projects", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("OPTIONS")
+	api.HandleFunc("/projects/{project}", fileController.GetProjectHandler).Methods("GET")
+	api.HandleFunc("/projects/{project}", fileController.UpdateProjectHandler).Methods("PUT")
+	api.HandleFunc("/projects/{project}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("OPTIONS")
+	api.HandleFunc("/projects/{project}/members", fileController.ListProjectMembersHandler).Methods("GET")
+	api.HandleFunc("/projects/{project}/members", fileController.SetProjectMemberHandler).Methods("PUT")
+	api.HandleFunc("/projects/{project}/members/{user_id}", fileController.RemoveProjectMemberHandler).Methods("DELETE")
+	api.HandleFunc("/projects/{project}/members", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("OPTIONS")
+
+	// Endpoints de la papelera.
+	api.HandleFunc("/trash", fileController.ListTrashHandler).Methods("GET")
+	api.HandleFunc("/trash/{id}/restore", fileController.RestoreTrashedFileHandler).Methods("POST")
+	api.HandleFunc("/trash/{id}", fileController.PurgeTrashedFileHandler).Methods("DELETE")
+	api.HandleFunc("/trash/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("OPTIONS")
+
+	// Endpoints para consultar el uso de las cuotas.
+	api.HandleFunc("/quota", fileController.GetQuotaHandler).Methods("GET")
+	api.HandleFunc("/quota/projects/{project}", fileController.GetProjectQuotaHandler).Methods("GET")
+	api.HandleFunc("/quota", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("OPTIONS")
+
+	// Endpoints de administración (solo usuarios de ADMIN_USER_IDS).
+	admin := api.PathPrefix("/admin").Subrouter()
+	admin.Use(middlewares.AdminMiddleware(cfg))
+	admin.HandleFunc("/quotas/{scope}/{subject}", fileController.GetQuotaAdminHandler).Methods("GET")
+	admin.HandleFunc("/quotas/{scope}/{subject}", fileController.UpdateQuotaHandler).Methods("PUT")
+	admin.HandleFunc("/quotas/{scope}/{subject}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("OPTIONS")
+	admin.HandleFunc("/projects/{project}/members", fileController.AssignProjectMemberHandler).Methods("PUT")
+	admin.HandleFunc("/policies/{project}", fileController.GetUploadPolicyHandler).Methods("GET")
+	admin.HandleFunc("/policies/{project}", fileController.UpdateUploadPolicyHandler).Methods("PUT")
+	admin.HandleFunc("/policies/{project}", fileController.DeleteUploadPolicyHandler).Methods("DELETE")
+	admin.HandleFunc("/policies/{project}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("OPTIONS")
+
 	// Endpoint para agregar permisos a un archivo.
 	api.HandleFunc("/file/{id}/permissions", fileController.AddFilePermissionHandler).Methods("POST")
 	api.HandleFunc("/file/{id}/permissions", func(w http.ResponseWriter, r *http.Request) {
@@ -89,10 +199,16 @@ func SetupRoutes(fileService *services.FileService) *mux.Router {
 		w.WriteHeader(http.StatusOK)
 	}).Methods("OPTIONS")
 
-	// Ruta para servir archivos (usa FileMiddleware para verificar JWT cuando sea necesario).
+	// Ruta para servir archivos (usa FileMiddleware para verificar JWT cuando sea
+	// necesario; los enlaces firmados no requieren token).
 	filesRouter := router.PathPrefix("/files").Subrouter()
 	filesRouter.Use(FileMiddleware(cfg, fileService))
 	filesRouter.HandleFunc("/{id}", fileController.ServeFileHandler).Methods("GET")
+	filesRouter.HandleFunc("/{id}/thumbnail", fileController.ServeThumbnailHandler).Methods("GET")
+
+	// Ruta pública de los enlaces compartidos (sin autenticación; POST para
+	// enviar la contraseña desde un formulario).
+	router.HandleFunc("/share/{token}", fileController.ServeShareHandler).Methods("GET", "HEAD", "POST")
 
 	// Ruta de bienvenida.
 	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -107,11 +223,28 @@ func SetupRoutes(fileService *services.FileService) *mux.Router {
 	internal := router.PathPrefix("/internal").Subrouter()
 	internal.Use(middlewares.ReplicaAuthMiddleware(cfg))
 
-	// Endpoint interno para subir archivos replicados
+	// Endpoint interno para subir archivos replicados (misma ruta que en el primario)
 	internal.HandleFunc("/upload/{project}", fileController.InternalUploadFileHandler).Methods("POST")
 
-	// Endpoint interno para eliminar archivos replicados
-	internal.HandleFunc("/delete/{id}", fileController.InternalDeleteFileHandler).Methods("DELETE")
+	// Endpoint interno de lectura usado por el primario cuando pierde su copia local
+	internal.HandleFunc("/read", fileController.InternalReadFileHandler).Methods("GET")
+
+	// Endpoint interno para eliminar archivos replicados por ruta
+	internal.HandleFunc("/delete", fileController.InternalDeleteFileHandler).Methods("DELETE")
+
+	// Endpoint interno para sincronizar el registro y los permisos de un archivo
+	internal.HandleFunc("/files/{id}", fileController.InternalSyncFileRecordHandler).Methods("PUT")
+	internal.HandleFunc("/files/{id}", fileController.InternalPurgeFileRecordHandler).Methods("DELETE")
+
+	// Endpoint interno de salud usado por el primario para detectar réplicas caídas
+	internal.HandleFunc("/health", fileController.InternalHealthHandler).Methods("GET")
+
+	// Endpoints internos de manifiestos para la reconciliación (anti-entropía)
+	internal.HandleFunc("/manifest", fileController.InternalManifestHandler).Methods("GET")
+	internal.HandleFunc("/manifest/folder", fileController.InternalManifestFolderHandler).Methods("GET")
+
+	// Endpoint interno con la profundidad de la cola de replicación
+	internal.HandleFunc("/replication/queue", fileController.ReplicationQueueHandler).Methods("GET")
 
 	return router
 }
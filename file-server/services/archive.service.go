@@ -0,0 +1,309 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/t-saturn/file-server/database"
+	"github.com/t-saturn/file-server/models"
+)
+
+// Errores devueltos por ArchiveService.
+var (
+	ErrArchiveInvalid   = errors.New("solicitud de descarga inválida")
+	ErrArchiveNotFound  = errors.New("archivo no encontrado")
+	ErrArchiveForbidden = errors.New("acceso denegado")
+	ErrArchiveTooLarge  = errors.New("la descarga supera el máximo permitido")
+)
+
+// ArchiveEntry es un archivo incluido en una descarga, con la ruta que tendrá
+// dentro del archivo comprimido.
+type ArchiveEntry struct {
+	Name string
+	File *models.File
+}
+
+// ArchiveService arma descargas de varios archivos en ZIP o tar.gz. El
+// contenido se transmite directamente a la respuesta, sin guardarlo en disco.
+type ArchiveService struct {
+	FileSvc    *FileService
+	FolderSvc  *FolderService
+	ProjectSvc *ProjectService
+	// Límites de una descarga (0 sin límite)
+	MaxFiles int
+	MaxBytes int64
+}
+
+// NewArchiveService crea una instancia de ArchiveService.
+func NewArchiveService(fileSvc *FileService, folderSvc *FolderService, projectSvc *ProjectService, maxFiles int, maxBytes int64) *ArchiveService {
+	return &ArchiveService{FileSvc: fileSvc, FolderSvc: folderSvc, ProjectSvc: projectSvc, MaxFiles: maxFiles, MaxBytes: maxBytes}
+}
+
+// Collect reúne los archivos de la solicitud verificando CheckPermission en
+// cada uno y devuelve las entradas con nombres únicos. Si falta algún archivo
+// o no hay permiso sobre él, la descarga completa se rechaza.
+func (as *ArchiveService) Collect(userID string, req models.ArchiveRequest) ([]ArchiveEntry, error) {
+	sources := 0
+	for _, set := range []bool{len(req.FileIDs) > 0, req.FolderID != nil, req.Project != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, fmt.Errorf("%w: indique file_ids, folder_id o project", ErrArchiveInvalid)
+	}
+	if req.Format != "" && req.Format != models.ArchiveFormatZip && req.Format != models.ArchiveFormatTarGz {
+		return nil, fmt.Errorf("%w: format debe ser zip o tar.gz", ErrArchiveInvalid)
+	}
+	if as.MaxFiles > 0 && len(req.FileIDs) > as.MaxFiles {
+		return nil, fmt.Errorf("%w: como máximo %d archivos", ErrArchiveTooLarge, as.MaxFiles)
+	}
+
+	db := as.FileSvc.LogRepo.DB
+	var files []*models.File
+	folderPaths := map[string]string{}
+	switch {
+	case len(req.FileIDs) > 0:
+		seen := map[string]bool{}
+		for _, fileID := range req.FileIDs {
+			if seen[fileID] {
+				continue
+			}
+			seen[fileID] = true
+			file, err := as.FileSvc.GetFileRecordByID(fileID)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrArchiveNotFound, fileID)
+			}
+			files = append(files, file)
+		}
+	case req.FolderID != nil:
+		folder, err := as.FolderSvc.GetFolder(*req.FolderID, userID)
+		if err != nil {
+			return nil, err
+		}
+		subtree, err := database.GetFolderSubtreeIDs(db, folder.ID)
+		if err != nil {
+			return nil, err
+		}
+		folders, err := database.GetFoldersByIDs(db, subtree)
+		if err != nil {
+			return nil, err
+		}
+		folderPaths = relativeFolderPaths(folder.ID, folders)
+		if files, err = database.GetFilesInFolders(db, subtree); err != nil {
+			return nil, err
+		}
+	default:
+		err := as.ProjectSvc.RequireRole(req.Project, userID, models.ProjectRoleAdmin, models.ProjectRoleEditor, models.ProjectRoleViewer)
+		if err != nil {
+			return nil, err
+		}
+		if files, err = database.GetProjectFiles(db, req.Project); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%w: no hay archivos para descargar", ErrArchiveInvalid)
+	}
+	if as.MaxFiles > 0 && len(files) > as.MaxFiles {
+		return nil, fmt.Errorf("%w: como máximo %d archivos", ErrArchiveTooLarge, as.MaxFiles)
+	}
+
+	entries := make([]ArchiveEntry, 0, len(files))
+	used := map[string]bool{}
+	var total int64
+	for _, file := range files {
+		allowed, err := as.FileSvc.CheckPermission(file, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, fmt.Errorf("%w: %s", ErrArchiveForbidden, file.ID)
+		}
+		total += file.Size
+		if as.MaxBytes > 0 && total > as.MaxBytes {
+			return nil, fmt.Errorf("%w: como máximo %d bytes", ErrArchiveTooLarge, as.MaxBytes)
+		}
+
+		name := archiveEntryName(file)
+		if file.FolderID != nil && folderPaths[*file.FolderID] != "" {
+			name = folderPaths[*file.FolderID] + "/" + name
+		}
+		entries = append(entries, ArchiveEntry{Name: uniqueEntryName(name, used), File: file})
+	}
+	return entries, nil
+}
+
+// Write transmite las entradas a w en el formato indicado. Si falla a mitad
+// de camino el archivo comprimido queda incompleto y el error se devuelve.
+func (as *ArchiveService) Write(w io.Writer, format string, entries []ArchiveEntry) error {
+	if format == models.ArchiveFormatTarGz {
+		return as.writeTarGz(w, entries)
+	}
+	return as.writeZip(w, entries)
+}
+
+// writeZip escribe las entradas como ZIP.
+func (as *ArchiveService) writeZip(w io.Writer, entries []ArchiveEntry) error {
+	zw := zip.NewWriter(w)
+	for _, entry := range entries {
+		content, _, err := as.openContent(entry.File.URL)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name, err)
+		}
+		header := &zip.FileHeader{Name: entry.Name, Method: zip.Deflate, Modified: entry.File.UpdatedAt}
+		// Las imágenes, videos y archivos comprimidos no ganan nada al comprimirse de nuevo
+		if !compressible(entry.File.MimeType) {
+			header.Method = zip.Store
+		}
+		dst, err := zw.CreateHeader(header)
+		if err == nil {
+			_, err = io.Copy(dst, content)
+		}
+		content.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name, err)
+		}
+	}
+	return zw.Close()
+}
+
+// writeTarGz escribe las entradas como tar comprimido con gzip. El tamaño de
+// cada entrada debe conocerse antes de escribir su contenido.
+func (as *ArchiveService) writeTarGz(w io.Writer, entries []ArchiveEntry) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, entry := range entries {
+		content, size, err := as.openContent(entry.File.URL)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name, err)
+		}
+		header := &tar.Header{
+			Name:    entry.Name,
+			Mode:    0644,
+			Size:    size,
+			ModTime: entry.File.UpdatedAt,
+			Format:  tar.FormatPAX,
+		}
+		err = tw.WriteHeader(header)
+		if err == nil {
+			_, err = io.CopyN(tw, content, size)
+		}
+		content.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// openContent abre el contenido guardado en relativePath y devuelve su
+// tamaño. Si la copia local no está disponible se lee desde una réplica.
+func (as *ArchiveService) openContent(relativePath string) (io.ReadCloser, int64, error) {
+	content, err := as.FileSvc.Storage.Open(relativePath)
+	if err == nil {
+		size, seekErr := content.Seek(0, io.SeekEnd)
+		if seekErr == nil {
+			_, seekErr = content.Seek(0, io.SeekStart)
+		}
+		if seekErr != nil {
+			content.Close()
+			return nil, 0, seekErr
+		}
+		return content, size, nil
+	}
+	resp, _, replicaErr := as.FileSvc.ReadFromReplica(relativePath, "")
+	if replicaErr != nil {
+		return nil, 0, fmt.Errorf("copia local: %v; réplicas: %w", err, replicaErr)
+	}
+	if resp.ContentLength < 0 {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("la réplica no informó el tamaño de %s", relativePath)
+	}
+	go as.FileSvc.RepairFromReplica(relativePath)
+	return resp.Body, resp.ContentLength, nil
+}
+
+// relativeFolderPaths arma la ruta de cada carpeta del subárbol relativa a
+// la carpeta raíz de la descarga (la raíz queda con ruta vacía).
+func relativeFolderPaths(rootID string, folders []*models.Folder) map[string]string {
+	byID := map[string]*models.Folder{}
+	for _, folder := range folders {
+		byID[folder.ID] = folder
+	}
+	paths := map[string]string{rootID: ""}
+	var resolve func(id string) string
+	resolve = func(id string) string {
+		if p, ok := paths[id]; ok {
+			return p
+		}
+		folder := byID[id]
+		if folder == nil || folder.ParentID == nil {
+			return ""
+		}
+		p := path.Join(resolve(*folder.ParentID), sanitizeEntryName(folder.Name))
+		paths[id] = p
+		return p
+	}
+	for _, folder := range folders {
+		resolve(folder.ID)
+	}
+	return paths
+}
+
+// archiveEntryName devuelve el nombre de la entrada a partir de original_name.
+func archiveEntryName(file *models.File) string {
+	name := sanitizeEntryName(file.OriginalName)
+	if name == "" {
+		name = file.ID + filepath.Ext(file.URL)
+	}
+	return name
+}
+
+// sanitizeEntryName evita que un nombre agregue directorios o salga de la
+// raíz del archivo comprimido.
+func sanitizeEntryName(name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_", "\x00", "").Replace(strings.TrimSpace(name))
+	if name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
+
+// uniqueEntryName agrega " (n)" antes de la extensión si el nombre ya se usó
+// (sin distinguir mayúsculas, como la mayoría de los sistemas de archivos).
+func uniqueEntryName(name string, used map[string]bool) string {
+	candidate := name
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for n := 1; used[strings.ToLower(candidate)]; n++ {
+		candidate = base + " (" + strconv.Itoa(n) + ")" + ext
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+// compressible indica si vale la pena comprimir un contenido con Deflate.
+func compressible(mimeType string) bool {
+	switch {
+	case strings.HasPrefix(mimeType, "image/") && mimeType != "image/svg+xml" && mimeType != "image/bmp",
+		strings.HasPrefix(mimeType, "video/"),
+		strings.HasPrefix(mimeType, "audio/"),
+		mimeType == "application/zip", mimeType == "application/x-gzip", mimeType == "application/gzip",
+		mimeType == "application/x-rar-compressed", mimeType == "application/x-7z-compressed":
+		return false
+	}
+	return true
+}
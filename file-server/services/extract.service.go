@@ -0,0 +1,394 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/t-saturn/file-server/models"
+)
+
+// Errores devueltos por ExtractService.
+var (
+	ErrExtractUnsupported = errors.New("el archivo no es un ZIP ni un tar.gz")
+	ErrExtractTooLarge    = errors.New("el contenido extraído supera el máximo permitido")
+	ErrExtractTooMany     = errors.New("el archivo comprimido supera el máximo de entradas")
+	ErrExtractUnsafePath  = errors.New("ruta de entrada insegura")
+)
+
+// ExtractRequest indica dónde se crean los archivos extraídos.
+type ExtractRequest struct {
+	OwnerID  string
+	Project  string
+	FolderID *string
+	IsPublic bool
+}
+
+// ExtractService extrae en el servidor archivos ZIP y tar.gz subidos,
+// creando un registro por cada archivo y una carpeta por cada directorio.
+// Las entradas pasan por la misma política y las mismas cuotas que una
+// subida individual. MaxEntries y MaxBytes protegen contra archivos
+// comprimidos que se expanden de forma desmedida; el tamaño se cuenta sobre
+// los bytes realmente descomprimidos, no sobre el que declara el archivo.
+type ExtractService struct {
+	FileSvc    *FileService
+	FolderSvc  *FolderService
+	QuotaSvc   *QuotaService
+	PolicySvc  *UploadPolicyService
+	TempPath   string
+	MaxEntries int
+	MaxBytes   int64
+}
+
+// NewExtractService crea una instancia de ExtractService.
+func NewExtractService(fileSvc *FileService, folderSvc *FolderService, quotaSvc *QuotaService, policySvc *UploadPolicyService, tempPath string, maxEntries int, maxBytes int64) *ExtractService {
+	os.MkdirAll(tempPath, os.ModePerm)
+	return &ExtractService{
+		FileSvc:    fileSvc,
+		FolderSvc:  folderSvc,
+		QuotaSvc:   quotaSvc,
+		PolicySvc:  policySvc,
+		TempPath:   tempPath,
+		MaxEntries: maxEntries,
+		MaxBytes:   maxBytes,
+	}
+}
+
+// Stage guarda el archivo comprimido subido en un archivo temporal (un ZIP
+// solo puede leerse con acceso aleatorio). El llamador debe eliminarlo.
+func (es *ExtractService) Stage(data io.Reader) (string, error) {
+	tmp, err := os.CreateTemp(es.TempPath, "extract-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(tmp, data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// Extract extrae el archivo comprimido guardado en archivePath. Los errores
+// de una entrada se informan en el reporte sin detener el resto; superar
+// MaxEntries o MaxBytes detiene la extracción y marca el reporte como
+// truncado. Solo devuelve error si el archivo no puede procesarse.
+func (es *ExtractService) Extract(archivePath string, req ExtractRequest) (*models.ExtractReport, error) {
+	if req.FolderID != nil {
+		if _, err := es.FolderSvc.GetFolder(*req.FolderID, req.OwnerID); err != nil {
+			return nil, err
+		}
+	}
+	policy, err := es.PolicySvc.Policy(req.Project)
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := detectArchiveFormat(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	run := &extraction{
+		svc:     es,
+		req:     req,
+		policy:  policy,
+		budget:  es.MaxBytes,
+		folders: map[string]*string{"": req.FolderID},
+		report:  &models.ExtractReport{Format: format, Entries: []models.ExtractEntryResult{}},
+	}
+	if format == models.ArchiveFormatZip {
+		err = run.zip(archivePath)
+	} else {
+		err = run.tarGz(archivePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return run.report, nil
+}
+
+// extraction guarda el estado de una extracción en curso.
+type extraction struct {
+	svc     *ExtractService
+	req     ExtractRequest
+	policy  *models.UploadPolicy
+	budget  int64
+	entries int
+	folders map[string]*string
+	report  *models.ExtractReport
+}
+
+// zip recorre las entradas de un ZIP. Los tamaños declarados se revisan
+// antes de empezar para rechazar enseguida las bombas evidentes.
+func (ex *extraction) zip(archivePath string) error {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrExtractUnsupported, err)
+	}
+	defer zr.Close()
+
+	if ex.svc.MaxEntries > 0 && len(zr.File) > ex.svc.MaxEntries {
+		return fmt.Errorf("%w (%d de %d)", ErrExtractTooMany, len(zr.File), ex.svc.MaxEntries)
+	}
+	var declared uint64
+	for _, file := range zr.File {
+		declared += file.UncompressedSize64
+	}
+	if ex.svc.MaxBytes > 0 && declared > uint64(ex.svc.MaxBytes) {
+		return fmt.Errorf("%w (%d bytes)", ErrExtractTooLarge, ex.svc.MaxBytes)
+	}
+
+	for _, file := range zr.File {
+		mode := file.Mode()
+		if !mode.IsRegular() && !mode.IsDir() {
+			if ex.next(file.Name, false, nil, "no es un archivo regular") {
+				break
+			}
+			continue
+		}
+		var content io.ReadCloser
+		if !mode.IsDir() {
+			if content, err = file.Open(); err != nil {
+				if ex.next(file.Name, false, nil, err.Error()) {
+					break
+				}
+				continue
+			}
+		}
+		stop := ex.next(file.Name, mode.IsDir(), content, "")
+		if content != nil {
+			content.Close()
+		}
+		if stop {
+			break
+		}
+	}
+	return nil
+}
+
+// tarGz recorre las entradas de un tar.gz en orden, sin conocer de antemano
+// cuántas son.
+func (ex *extraction) tarGz(archivePath string) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrExtractUnsupported, err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// Un tar dañado a mitad de camino conserva lo ya extraído
+			if ex.entries == 0 {
+				return fmt.Errorf("%w: %v", ErrExtractUnsupported, err)
+			}
+			ex.fail("", "archivo comprimido dañado: "+err.Error())
+			ex.report.Truncated = true
+			return nil
+		}
+		var stop bool
+		switch header.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			stop = ex.next(header.Name, false, tr, "")
+		case tar.TypeDir:
+			stop = ex.next(header.Name, true, nil, "")
+		case tar.TypeXGlobalHeader:
+			continue
+		default:
+			stop = ex.next(header.Name, false, nil, "no es un archivo regular")
+		}
+		if stop {
+			return nil
+		}
+	}
+}
+
+// next procesa una entrada y devuelve true si la extracción debe detenerse.
+// skipReason, si no está vacío, omite la entrada con ese motivo.
+func (ex *extraction) next(name string, isDir bool, content io.Reader, skipReason string) bool {
+	ex.entries++
+	if ex.svc.MaxEntries > 0 && ex.entries > ex.svc.MaxEntries {
+		ex.fail(name, fmt.Sprintf("%v (%d)", ErrExtractTooMany, ex.svc.MaxEntries))
+		ex.report.Truncated = true
+		return true
+	}
+
+	entryPath, err := cleanEntryPath(name)
+	if err != nil {
+		ex.fail(name, err.Error())
+		return false
+	}
+	if skipReason == "" && isMetadataEntry(entryPath) {
+		skipReason = "metadatos del sistema operativo"
+	}
+	if skipReason != "" {
+		ex.skip(name, skipReason)
+		return false
+	}
+	if isDir {
+		if _, err := ex.folder(entryPath); err != nil {
+			ex.fail(name, err.Error())
+		}
+		return false
+	}
+
+	file, err := ex.createFile(entryPath, content)
+	if err != nil {
+		ex.fail(name, err.Error())
+		if errors.Is(err, ErrExtractTooLarge) || errors.Is(err, ErrQuotaExceeded) {
+			ex.report.Truncated = true
+			return true
+		}
+		return false
+	}
+	ex.report.Created++
+	ex.report.Entries = append(ex.report.Entries, models.ExtractEntryResult{Path: name, Status: models.ExtractStatusCreated, File: file})
+	return false
+}
+
+// createFile guarda una entrada como un archivo nuevo en la carpeta que
+// corresponde a su ruta.
+func (ex *extraction) createFile(entryPath string, content io.Reader) (*models.File, error) {
+	folderID, err := ex.folder(path.Dir(entryPath))
+	if err != nil {
+		return nil, err
+	}
+	remaining, err := ex.svc.QuotaSvc.Allowance(ex.req.OwnerID, ex.req.Project, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := path.Base(entryPath)
+	data, err := ex.svc.PolicySvc.Enforce(ex.policy, filename, &budgetReader{reader: content, extraction: ex})
+	if err != nil {
+		return nil, err
+	}
+	relativePath, metadata, err := ex.svc.FileSvc.UploadFile(ex.req.Project, uuid.New().String()+filepath.Ext(filename), LimitReader(data, remaining))
+	if err != nil {
+		return nil, err
+	}
+	// El registro se crea ya dentro de su carpeta: si falla, no queda nada
+	file, err := ex.svc.FileSvc.CreateOwnedFileRecordInFolder(filename, filepath.ToSlash(relativePath), ex.req.OwnerID, ex.req.IsPublic, metadata, folderID)
+	if err != nil {
+		ex.svc.FileSvc.DiscardBlob(filepath.ToSlash(relativePath))
+		return nil, err
+	}
+	return file, nil
+}
+
+// folder devuelve la carpeta de un directorio del archivo comprimido,
+// creándola con sus carpetas padre si hace falta.
+func (ex *extraction) folder(dir string) (*string, error) {
+	if dir == "." {
+		dir = ""
+	}
+	if folderID, ok := ex.folders[dir]; ok {
+		return folderID, nil
+	}
+	parentID, err := ex.folder(path.Dir(dir))
+	if err != nil {
+		return nil, err
+	}
+	folderID, err := ex.svc.FolderSvc.EnsureFolderPath(ex.req.OwnerID, parentID, []string{path.Base(dir)})
+	if err != nil {
+		return nil, err
+	}
+	ex.folders[dir] = folderID
+	return folderID, nil
+}
+
+func (ex *extraction) skip(name, reason string) {
+	ex.report.Skipped++
+	ex.report.Entries = append(ex.report.Entries, models.ExtractEntryResult{Path: name, Status: models.ExtractStatusSkipped, Error: reason})
+}
+
+func (ex *extraction) fail(name, reason string) {
+	ex.report.Failed++
+	ex.report.Entries = append(ex.report.Entries, models.ExtractEntryResult{Path: name, Status: models.ExtractStatusFailed, Error: reason})
+}
+
+// budgetReader descuenta los bytes descomprimidos del presupuesto de la
+// extracción y falla con ErrExtractTooLarge al agotarlo.
+type budgetReader struct {
+	reader     io.Reader
+	extraction *extraction
+}
+
+func (br *budgetReader) Read(p []byte) (int, error) {
+	n, err := br.reader.Read(p)
+	if br.extraction.svc.MaxBytes > 0 {
+		br.extraction.budget -= int64(n)
+		if br.extraction.budget < 0 {
+			return n, fmt.Errorf("%w (%d bytes)", ErrExtractTooLarge, br.extraction.svc.MaxBytes)
+		}
+	}
+	return n, err
+}
+
+// cleanEntryPath normaliza la ruta de una entrada y rechaza las absolutas o
+// las que salen de la raíz con "..", para que ninguna entrada termine fuera
+// de la carpeta de destino (zip slip).
+func cleanEntryPath(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.ContainsRune(name, 0) || strings.HasPrefix(name, "/") ||
+		(len(name) >= 2 && name[1] == ':') {
+		return "", ErrExtractUnsafePath
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", ErrExtractUnsafePath
+		}
+	}
+	cleaned := path.Clean(name)
+	if cleaned == "." || cleaned == "" {
+		return "", ErrExtractUnsafePath
+	}
+	return cleaned, nil
+}
+
+// isMetadataEntry indica si la entrada son metadatos que agregan algunos
+// sistemas operativos al comprimir (__MACOSX, .DS_Store, Thumbs.db).
+func isMetadataEntry(entryPath string) bool {
+	base := path.Base(entryPath)
+	return strings.HasPrefix(entryPath, "__MACOSX/") || entryPath == "__MACOSX" ||
+		base == ".DS_Store" || base == "Thumbs.db"
+}
+
+// detectArchiveFormat identifica el formato por sus primeros bytes.
+func detectArchiveFormat(archivePath string) (string, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	head := make([]byte, 4)
+	n, _ := io.ReadFull(file, head)
+	switch {
+	case bytes.HasPrefix(head[:n], []byte("PK\x03\x04")), bytes.HasPrefix(head[:n], []byte("PK\x05\x06")):
+		return models.ArchiveFormatZip, nil
+	case bytes.HasPrefix(head[:n], []byte{0x1f, 0x8b}):
+		return models.ArchiveFormatTarGz, nil
+	}
+	return "", ErrExtractUnsupported
+}
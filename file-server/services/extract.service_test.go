@@ -0,0 +1,224 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/t-saturn/file-server/models"
+)
+
+func TestCleanEntryPath(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		err  bool
+	}{
+		{name: "fotos/2025/a.jpg", want: "fotos/2025/a.jpg"},
+		{name: "./fotos//a.jpg", want: "fotos/a.jpg"},
+		{name: `fotos\windows\a.jpg`, want: "fotos/windows/a.jpg"},
+		{name: "fotos/./a.jpg", want: "fotos/a.jpg"},
+		{name: "fotos/", want: "fotos"},
+		{name: "../fuera.txt", err: true},
+		{name: "fotos/../../fuera.txt", err: true},
+		{name: "fotos/../a.txt", err: true},
+		{name: `..\fuera.txt`, err: true},
+		{name: `fotos\..\..\fuera.txt`, err: true},
+		{name: "/etc/passwd", err: true},
+		{name: `\windows\system32`, err: true},
+		{name: `C:\fuera.txt`, err: true},
+		{name: "C:fuera.txt", err: true},
+		{name: "a\x00.txt", err: true},
+		{name: ".", err: true},
+		{name: "", err: true},
+	}
+	for _, tt := range tests {
+		got, err := cleanEntryPath(tt.name)
+		if tt.err {
+			if !errors.Is(err, ErrExtractUnsafePath) {
+				t.Errorf("cleanEntryPath(%q) = %q, %v; se esperaba ErrExtractUnsafePath", tt.name, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("cleanEntryPath(%q) = %q, %v; se esperaba %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestIsMetadataEntry(t *testing.T) {
+	for entryPath, want := range map[string]bool{
+		"__MACOSX":          true,
+		"__MACOSX/._a.jpg":  true,
+		"fotos/.DS_Store":   true,
+		"fotos/Thumbs.db":   true,
+		"fotos/a.jpg":       false,
+		"fotos/__MACOSX.md": false,
+	} {
+		if got := isMetadataEntry(entryPath); got != want {
+			t.Errorf("isMetadataEntry(%q) = %v, se esperaba %v", entryPath, got, want)
+		}
+	}
+}
+
+// writeZip crea un ZIP con las entradas indicadas (nombre y contenido).
+func writeZip(t *testing.T, entries map[string]string) string {
+	t.Helper()
+	archivePath := filepath.Join(t.TempDir(), "a.zip")
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(file)
+	for name, content := range entries {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	return archivePath
+}
+
+// writeTarGz crea un tar.gz con las cabeceras indicadas; las entradas
+// regulares llevan como contenido su propio nombre.
+func writeTarGz(t *testing.T, headers []*tar.Header) string {
+	t.Helper()
+	archivePath := filepath.Join(t.TempDir(), "a.tar.gz")
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	for _, header := range headers {
+		if header.Typeflag == tar.TypeReg {
+			header.Size = int64(len(header.Name))
+			header.Mode = 0644
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			tw.Write([]byte(header.Name))
+		}
+	}
+	tw.Close()
+	gz.Close()
+	file.Close()
+	return archivePath
+}
+
+func newTestExtraction(maxEntries int, maxBytes int64) *extraction {
+	return &extraction{
+		svc:     &ExtractService{MaxEntries: maxEntries, MaxBytes: maxBytes},
+		budget:  maxBytes,
+		folders: map[string]*string{"": nil},
+		report:  &models.ExtractReport{Entries: []models.ExtractEntryResult{}},
+	}
+}
+
+func TestDetectArchiveFormat(t *testing.T) {
+	zipPath := writeZip(t, map[string]string{"a.txt": "a"})
+	tarPath := writeTarGz(t, []*tar.Header{{Name: "a.txt", Typeflag: tar.TypeReg}})
+	otherPath := filepath.Join(t.TempDir(), "a.txt")
+	os.WriteFile(otherPath, []byte("texto plano"), 0644)
+
+	if format, err := detectArchiveFormat(zipPath); err != nil || format != models.ArchiveFormatZip {
+		t.Errorf("ZIP detectado como %q, %v", format, err)
+	}
+	if format, err := detectArchiveFormat(tarPath); err != nil || format != models.ArchiveFormatTarGz {
+		t.Errorf("tar.gz detectado como %q, %v", format, err)
+	}
+	if _, err := detectArchiveFormat(otherPath); !errors.Is(err, ErrExtractUnsupported) {
+		t.Errorf("texto plano: %v, se esperaba ErrExtractUnsupported", err)
+	}
+}
+
+func TestZipRejectsBombsBeforeExtracting(t *testing.T) {
+	archivePath := writeZip(t, map[string]string{"a.txt": string(make([]byte, 100)), "b.txt": string(make([]byte, 100)), "c.txt": string(make([]byte, 100))})
+
+	if err := newTestExtraction(2, 0).zip(archivePath); !errors.Is(err, ErrExtractTooMany) {
+		t.Errorf("demasiadas entradas: %v, se esperaba ErrExtractTooMany", err)
+	}
+	if err := newTestExtraction(0, 250).zip(archivePath); !errors.Is(err, ErrExtractTooLarge) {
+		t.Errorf("tamaño declarado excesivo: %v, se esperaba ErrExtractTooLarge", err)
+	}
+}
+
+func TestTarGzReportsUnsafeAndSkippedEntries(t *testing.T) {
+	archivePath := writeTarGz(t, []*tar.Header{
+		{Name: "enlace", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+		{Name: "../fuera.txt", Typeflag: tar.TypeReg},
+		{Name: "/abs.txt", Typeflag: tar.TypeReg},
+		{Name: "__MACOSX/._a.jpg", Typeflag: tar.TypeReg},
+		{Name: "fifo", Typeflag: tar.TypeFifo},
+	})
+	ex := newTestExtraction(0, 0)
+	if err := ex.tarGz(archivePath); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"enlace":           models.ExtractStatusSkipped,
+		"../fuera.txt":     models.ExtractStatusFailed,
+		"/abs.txt":         models.ExtractStatusFailed,
+		"__MACOSX/._a.jpg": models.ExtractStatusSkipped,
+		"fifo":             models.ExtractStatusSkipped,
+	}
+	if len(ex.report.Entries) != len(want) {
+		t.Fatalf("entradas = %+v", ex.report.Entries)
+	}
+	for _, entry := range ex.report.Entries {
+		if entry.Status != want[entry.Path] {
+			t.Errorf("%s: estado %q, se esperaba %q", entry.Path, entry.Status, want[entry.Path])
+		}
+	}
+	if ex.report.Created != 0 || ex.report.Skipped != 3 || ex.report.Failed != 2 || ex.report.Truncated {
+		t.Errorf("reporte = %+v", *ex.report)
+	}
+}
+
+func TestTarGzStopsAtEntryLimit(t *testing.T) {
+	// Un tar no declara cuántas entradas tiene: el límite se aplica al recorrerlo
+	archivePath := writeTarGz(t, []*tar.Header{
+		{Name: "a", Typeflag: tar.TypeSymlink, Linkname: "x"},
+		{Name: "b", Typeflag: tar.TypeSymlink, Linkname: "x"},
+		{Name: "c", Typeflag: tar.TypeSymlink, Linkname: "x"},
+	})
+	ex := newTestExtraction(2, 0)
+	if err := ex.tarGz(archivePath); err != nil {
+		t.Fatal(err)
+	}
+	if !ex.report.Truncated || ex.report.Skipped != 2 || ex.report.Failed != 1 {
+		t.Errorf("reporte = %+v", *ex.report)
+	}
+}
+
+func TestBudgetReaderCountsDecompressedBytes(t *testing.T) {
+	ex := newTestExtraction(0, 10)
+	reader := &budgetReader{reader: &repeatReader{}, extraction: ex}
+	buf := make([]byte, 4)
+	var err error
+	for i := 0; i < 10 && err == nil; i++ {
+		_, err = reader.Read(buf)
+	}
+	if !errors.Is(err, ErrExtractTooLarge) {
+		t.Errorf("err = %v, se esperaba ErrExtractTooLarge", err)
+	}
+}
+
+// repeatReader entrega datos sin fin, como una bomba de descompresión.
+type repeatReader struct{}
+
+func (repeatReader) Read(p []byte) (int, error) {
+	return len(p), nil
+}
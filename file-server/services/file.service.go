@@ -1,68 +1,267 @@
 package services
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
-	"os"
+	"net/http"
 	"path/filepath"
+	"strings"
+	"sync"
 
+	"github.com/sirupsen/logrus"
 	"github.com/t-saturn/file-server/database"
 	"github.com/t-saturn/file-server/models"
 	"github.com/t-saturn/file-server/services/storage"
+	"github.com/t-saturn/file-server/utils"
+	"gorm.io/gorm"
 )
 
 // FileService orquesta la lógica relacionada a archivos.
 type FileService struct {
-	Storage      storage.Storage
-	LogRepo      *database.LogRepository
-	ReplicaSvc   *ReplicaService
-	StoragePath  string
+	Storage     storage.Storage
+	LogRepo     *database.LogRepository
+	ReplicaSvc  *ReplicaService
+	Replication *ReplicationQueue
+	Retention   VersionRetention
+	// repairing evita reparar la misma ruta varias veces en paralelo
+	repairing sync.Map
 }
 
 // NewFileService crea una instancia de FileService.
-func NewFileService(storage storage.Storage, logRepo *database.LogRepository, replicaSvc *ReplicaService, storagePath string) *FileService {
+func NewFileService(storage storage.Storage, logRepo *database.LogRepository, replicaSvc *ReplicaService, replication *ReplicationQueue, retention VersionRetention) *FileService {
 	return &FileService{
 		Storage:     storage,
 		LogRepo:     logRepo,
 		ReplicaSvc:  replicaSvc,
-		StoragePath: storagePath,
+		Replication: replication,
+		Retention:   retention,
 	}
 }
 
-// UploadFile sube un archivo y devuelve la ruta relativa.
-func (fs *FileService) UploadFile(project, filename string, data io.Reader) (string, error) {
-	// Leer los datos en un búfer para que se puedan leer dos veces
-	buf, err := io.ReadAll(data)
+// UploadFile sube un archivo y devuelve la ruta relativa junto con sus
+// metadatos (tamaño, tipo MIME detectado y SHA-256), calculados mientras se
+// transmite. Los datos se transmiten directamente al almacenamiento; las
+// réplicas se alimentan luego desde la copia ya guardada, por lo que el consumo
+// de memoria no depende del tamaño del archivo. Si no se alcanza el quórum de
+// escritura, la subida se deshace y se devuelve ErrReplicationQuorum.
+func (fs *FileService) UploadFile(project, filename string, data io.Reader) (string, models.FileMetadata, error) {
+	// Guardar el archivo localmente
+	inspector := newContentInspector(data)
+	url, err := fs.Storage.SaveFile(project, filename, inspector)
 	if err != nil {
-		return "", err
+		return "", models.FileMetadata{}, err
 	}
 
-	// Crear dos lectores a partir del búfer
-	reader1 := bytes.NewReader(buf)
-	reader2 := bytes.NewReader(buf)
+	// Replicar el archivo leyendo la copia almacenada
+	relativePath := filepath.ToSlash(url)
+	if err := fs.Replication.ReplicateUpload(project, relativePath); err != nil {
+		fs.DiscardBlob(relativePath)
+		return "", models.FileMetadata{}, err
+	}
 
-	// Guardar el archivo localmente
-	url, err := fs.Storage.SaveFile(project, filename, reader1)
+	return url, inspector.Metadata(project, filename), nil
+}
+
+// DiscardBlob elimina, junto con sus copias en las réplicas, un contenido
+// recién guardado que no llegó a registrarse, salvo que otro archivo ya lo
+// referencie (almacenamiento por contenido). Una ruta vacía no hace nada.
+func (fs *FileService) DiscardBlob(relativePath string) {
+	if relativePath == "" {
+		return
+	}
+	references, err := database.CountBlobReferences(fs.LogRepo.DB, relativePath, "")
+	if err != nil || references > 0 {
+		return
+	}
+	if err := fs.Storage.Delete(relativePath); err != nil {
+		utils.Logger.WithError(err).WithField("path", relativePath).Error("Error al descartar el archivo")
+	}
+	fs.Replication.DiscardUpload(relativePath)
+}
+
+// ReadFromReplica obtiene el contenido de relativePath desde la primera réplica
+// que lo tenga, probando antes las que están sanas. rangeHeader se reenvía tal
+// cual para que la réplica atienda peticiones parciales. Devuelve la respuesta
+// (que el llamador debe cerrar) y la URL de la réplica usada.
+func (fs *FileService) ReadFromReplica(relativePath, rangeHeader string) (*http.Response, string, error) {
+	if !fs.ReplicaSvc.Enabled() {
+		return nil, "", fmt.Errorf("%s: %w", relativePath, storage.ErrNotExist)
+	}
+
+	healthy, unhealthy := []string{}, []string{}
+	for _, replicaURL := range fs.ReplicaSvc.URLs() {
+		if fs.ReplicaSvc.IsHealthy(replicaURL) {
+			healthy = append(healthy, replicaURL)
+		} else {
+			unhealthy = append(unhealthy, replicaURL)
+		}
+	}
+
+	lastErr := fmt.Errorf("%s: %w", relativePath, storage.ErrNotExist)
+	for _, replicaURL := range append(healthy, unhealthy...) {
+		resp, err := fs.ReplicaSvc.ReadFile(replicaURL, relativePath, rangeHeader)
+		if err == nil {
+			return resp, replicaURL, nil
+		}
+		// Un 404 es una respuesta válida de la réplica; solo los fallos de red la marcan como caída
+		if !errors.Is(err, storage.ErrNotExist) {
+			fs.ReplicaSvc.MarkResult(replicaURL, err)
+			lastErr = err
+		}
+	}
+	return nil, "", lastErr
+}
+
+// RepairFromReplica vuelve a guardar localmente una copia perdida o dañada
+// leyéndola completa desde una réplica. Se ejecuta en segundo plano después
+// de servir el archivo desde la réplica.
+func (fs *FileService) RepairFromReplica(relativePath string) {
+	if _, busy := fs.repairing.LoadOrStore(relativePath, true); busy {
+		return
+	}
+	defer fs.repairing.Delete(relativePath)
+
+	resp, replicaURL, err := fs.ReadFromReplica(relativePath, "")
 	if err != nil {
-		return "", err
+		utils.Logger.WithError(err).WithField("path", relativePath).Error("No se pudo reparar la copia local")
+		_ = fs.LogRepo.LogEvent("repair", ProjectFromPath(relativePath), relativePath, "", "failure", err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	if err := fs.Storage.Put(relativePath, resp.Body); err != nil {
+		utils.Logger.WithError(err).WithField("path", relativePath).Error("No se pudo reparar la copia local")
+		_ = fs.LogRepo.LogEvent("repair", ProjectFromPath(relativePath), relativePath, replicaURL, "failure", err.Error())
+		return
+	}
+
+	utils.Logger.WithFields(logrus.Fields{"event": "repair", "path": relativePath, "replica": replicaURL}).Info("Copia local reparada desde la réplica")
+	_ = fs.LogRepo.LogEvent("repair", ProjectFromPath(relativePath), relativePath, replicaURL, "success", "Copia local reparada desde la réplica")
+}
+
+// ProjectFromPath obtiene el proyecto a partir de la ruta relativa guardada
+// (<project>/<YYYY>/<MM>/<DD>/<archivo>).
+func ProjectFromPath(relativePath string) string {
+	project, _, found := strings.Cut(filepath.ToSlash(relativePath), "/")
+	if !found {
+		return ""
 	}
+	return project
+}
 
-	// Replicar el archivo
-	if err := fs.ReplicaSvc.ReplicateFile(project, filename, reader2); err != nil {
-		// En un sistema real, es posible que desee manejar este error de manera diferente,
-		// por ejemplo, agregando el archivo a una cola para reintentar la replicación más tarde.
-		// Por ahora, simplemente registraremos el error pero no devolveremos un error al cliente.
-		fmt.Printf("Error al replicar el archivo: %v\n", err)
+// FileProject devuelve el proyecto del archivo. Los registros anteriores a la
+// columna project lo toman del primer directorio de su ruta; con el
+// almacenamiento CAS la ruta ya no lo indica.
+func FileProject(file *models.File) string {
+	if file.Project != "" {
+		return file.Project
 	}
+	return ProjectFromPath(file.URL)
+}
 
-	return url, nil
+// CreateFileRecord crea el registro del archivo en la base de datos junto con
+// su versión 1.
+func (fs *FileService) CreateFileRecord(originalName, url, ownerID string, isPublic bool, metadata models.FileMetadata) (*models.File, error) {
+	return fs.insertFileRecord(originalName, url, ownerID, isPublic, metadata, nil, false)
 }
 
-// CreateFileRecord crea el registro del archivo en la base de datos.
-func (fs *FileService) CreateFileRecord(originalName, url, ownerID string, isPublic bool) (*models.File, error) {
-	return database.InsertFileRecord(fs.LogRepo.DB, originalName, url, ownerID, isPublic)
+// CreateOwnedFileRecord crea el registro del archivo y asigna el permiso de
+// "owner" a quien lo subió.
+func (fs *FileService) CreateOwnedFileRecord(originalName, url, ownerID string, isPublic bool, metadata models.FileMetadata) (*models.File, error) {
+	return fs.CreateOwnedFileRecordInFolder(originalName, url, ownerID, isPublic, metadata, nil)
+}
+
+// CreateOwnedFileRecordInFolder es como CreateOwnedFileRecord, pero crea el
+// archivo directamente dentro de folderID (nil para la raíz). La carpeta debe
+// pertenecer a ownerID; se verifica antes de llamar.
+func (fs *FileService) CreateOwnedFileRecordInFolder(originalName, url, ownerID string, isPublic bool, metadata models.FileMetadata, folderID *string) (*models.File, error) {
+	file, err := fs.insertFileRecord(originalName, url, ownerID, isPublic, metadata, folderID, true)
+	if err != nil {
+		return nil, err
+	}
+	fs.SyncFileRecord(file)
+	return file, nil
+}
+
+// insertFileRecord inserta en una sola transacción el registro, su versión 1
+// y, si owned es true, el permiso de "owner", para que un error a mitad de
+// camino no deje un archivo sin versión o sin propietario.
+func (fs *FileService) insertFileRecord(originalName, url, ownerID string, isPublic bool, metadata models.FileMetadata, folderID *string, owned bool) (*models.File, error) {
+	var file *models.File
+	err := fs.LogRepo.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if file, err = database.InsertFileRecord(tx, originalName, url, ownerID, isPublic, metadata); err != nil {
+			return err
+		}
+		if folderID != nil {
+			if err := database.UpdateFileFolder(tx, file.ID, folderID); err != nil {
+				return fmt.Errorf("error asignando la carpeta del archivo: %w", err)
+			}
+			file.FolderID = folderID
+		}
+		if _, err := database.InsertFileVersion(tx, file.ID, file.Version, originalName, url, ownerID, metadata); err != nil {
+			return fmt.Errorf("error registrando la versión inicial del archivo: %w", err)
+		}
+		if owned {
+			if _, err := database.InsertFilePermissionRecord(tx, file.ID, ownerID, "owner"); err != nil {
+				return fmt.Errorf("error asignando permisos de propietario del archivo: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	fs.addQuotaUsage(file, metadata.Size, 1)
+	return file, nil
+}
+
+// SyncFileRecord propaga a las réplicas el registro actual del archivo. Debe
+// llamarse después de cada cambio en sus metadatos o permisos.
+func (fs *FileService) SyncFileRecord(file *models.File) {
+	fs.Replication.ReplicateRecord(file)
+}
+
+// StoreReplicatedFile guarda en la réplica el contenido recibido del primario
+// en la misma ruta relativa.
+func (fs *FileService) StoreReplicatedFile(relativePath string, data io.Reader) error {
+	return fs.Storage.Put(filepath.ToSlash(relativePath), data)
+}
+
+// DeleteReplicatedFile elimina de la réplica el contenido que el primario ya
+// liberó. Eliminar un archivo inexistente no es un error, para que los
+// reintentos sean idempotentes.
+func (fs *FileService) DeleteReplicatedFile(relativePath string) error {
+	err := fs.Storage.Delete(filepath.ToSlash(relativePath))
+	if errors.Is(err, storage.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// PurgeReplicatedRecord elimina de la réplica el registro de un archivo
+// purgado en el primario. Los blobs se eliminan con sus propias operaciones.
+func (fs *FileService) PurgeReplicatedRecord(fileID string) error {
+	return database.PurgeFileRecord(fs.LogRepo.DB, fileID)
+}
+
+// ApplyReplicatedRecord guarda en la réplica el registro enviado por el primario.
+func (fs *FileService) ApplyReplicatedRecord(replicated *models.ReplicatedFile) error {
+	if replicated.File.ID == "" || replicated.File.URL == "" {
+		return errors.New("registro replicado incompleto")
+	}
+	for _, permission := range replicated.Permissions {
+		if permission.FileID != replicated.File.ID {
+			return errors.New("los permisos replicados no corresponden al archivo")
+		}
+	}
+	for _, version := range replicated.Versions {
+		if version.FileID != replicated.File.ID {
+			return errors.New("las versiones replicadas no corresponden al archivo")
+		}
+	}
+	return database.UpsertReplicatedFile(fs.LogRepo.DB, replicated)
 }
 
 // GetFileRecordByID obtiene un archivo por su ID.
@@ -75,11 +274,36 @@ func (fs *FileService) CheckPermission(file *models.File, userID string) (bool,
 	if file.IsPublic {
 		return true, nil
 	}
+	role, err := fs.FileRole(file, userID)
+	return role != "", err
+}
+
+// FileRole devuelve el rol efectivo del usuario sobre el archivo: "owner",
+// "editor" o "viewer", o "" si no tiene acceso. Combina el permiso propio del
+// archivo con el rol en su proyecto (admin y editor del proyecto equivalen a
+// "editor") y devuelve el mayor.
+func (fs *FileService) FileRole(file *models.File, userID string) (string, error) {
 	if file.OwnerID == userID {
-		return true, nil
+		return "owner", nil
+	}
+	_, role, err := database.CheckUserFilePermission(fs.LogRepo.DB, file.ID, userID)
+	if err != nil || role == "owner" || role == "editor" {
+		return role, err
+	}
+	if file.Project == "" {
+		return role, nil
 	}
-	hasPermission, _, err := database.CheckUserFilePermission(fs.LogRepo.DB, file.ID, userID)
-	return hasPermission, err
+	projectRole, err := database.GetProjectMemberRole(fs.LogRepo.DB, file.Project, userID)
+	if err != nil {
+		return "", err
+	}
+	switch projectRole {
+	case models.ProjectRoleAdmin, models.ProjectRoleEditor:
+		return "editor", nil
+	case models.ProjectRoleViewer:
+		return "viewer", nil
+	}
+	return role, nil
 }
 
 // UpdateFilePermissions actualiza los permisos y estado público del archivo.
@@ -103,6 +327,7 @@ func (fs *FileService) UpdateFilePermissions(fileID, requestorID string, update
 			}
 		}
 	}
+	fs.SyncFileRecord(file)
 	return nil
 }
 
@@ -115,10 +340,16 @@ func (fs *FileService) RemoveFilePermission(fileID, requestorID, userID string)
 	if file.OwnerID != requestorID {
 		return errors.New("solo el propietario puede eliminar el permiso de archivo")
 	}
-	return database.DeleteFilePermission(fs.LogRepo.DB, fileID, userID)
+	if err := database.DeleteFilePermission(fs.LogRepo.DB, fileID, userID); err != nil {
+		return err
+	}
+	fs.SyncFileRecord(file)
+	return nil
 }
 
-// RemoveFile elimina un archivo del sistema (borrado lógico y eliminación física).
+// RemoveFile mueve un archivo a la papelera (borrado lógico). El contenido y
+// sus versiones se conservan para poder restaurarlo; el purgador los elimina
+// definitivamente cuando vence la retención de la papelera.
 func (fs *FileService) RemoveFile(fileID, requestorID string) error {
 	file, err := fs.GetFileRecordByID(fileID)
 	if err != nil {
@@ -127,17 +358,10 @@ func (fs *FileService) RemoveFile(fileID, requestorID string) error {
 	if file.OwnerID != requestorID {
 		return errors.New("solo el propietario puede eliminar el archivo")
 	}
-	physicalPath := filepath.Join(fs.StoragePath, file.URL)
-	if err := os.Remove(physicalPath); err != nil {
-		// Se continúa aun si falla la eliminación física
-	}
 
-	// Eliminar el archivo del servidor de réplica
-	if err := fs.ReplicaSvc.DeleteFile(file.URL); err != nil {
-		// Al igual que con la replicación, es posible que desee manejar este error de manera diferente
-		// en un sistema real.
-		fmt.Printf("Error al eliminar el archivo de la réplica: %v\n", err)
+	if err := database.DeleteFileRecord(fs.LogRepo.DB, fileID); err != nil {
+		return err
 	}
-
-	return database.DeleteFileRecord(fs.LogRepo.DB, fileID)
+	fs.SyncFileRecord(file)
+	return nil
 }
@@ -0,0 +1,310 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/t-saturn/file-server/database"
+	"github.com/t-saturn/file-server/models"
+	"gorm.io/gorm"
+)
+
+// Errores devueltos por FolderService.
+var (
+	ErrFolderNotFound  = errors.New("carpeta no encontrada")
+	ErrFolderForbidden = errors.New("la carpeta pertenece a otro usuario")
+	ErrFolderNameTaken = errors.New("ya existe una carpeta con ese nombre en la misma ubicación")
+	ErrFolderInvalid   = errors.New("nombre de carpeta inválido")
+	ErrFolderCycle     = errors.New("no se puede mover una carpeta dentro de sí misma")
+	ErrFolderNotEmpty  = errors.New("la carpeta no está vacía")
+)
+
+// FolderService gestiona la jerarquía de carpetas virtuales de cada usuario.
+// Las carpetas solo existen como metadatos: el contenido de los archivos
+// permanece en la ruta donde se guardó.
+type FolderService struct {
+	FileSvc *FileService
+}
+
+// NewFolderService crea una instancia de FolderService.
+func NewFolderService(fileSvc *FileService) *FolderService {
+	return &FolderService{FileSvc: fileSvc}
+}
+
+// FolderContents es una página del contenido de una carpeta: primero las
+// subcarpetas y luego los archivos.
+type FolderContents struct {
+	Folder  *models.Folder   `json:"folder"`
+	Folders []*models.Folder `json:"folders"`
+	Files   []*models.File   `json:"files"`
+	Total   int64            `json:"total"`
+	Limit   int              `json:"limit"`
+	Offset  int              `json:"offset"`
+}
+
+// GetFolder obtiene una carpeta verificando que pertenezca al usuario.
+func (fs *FolderService) GetFolder(folderID, ownerID string) (*models.Folder, error) {
+	folder, err := database.GetFolderById(fs.FileSvc.LogRepo.DB, folderID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrFolderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if folder.OwnerID != ownerID {
+		return nil, ErrFolderForbidden
+	}
+	return folder, nil
+}
+
+// CreateFolder crea una carpeta dentro de parentID (nil para la raíz).
+func (fs *FolderService) CreateFolder(ownerID, name string, parentID *string) (*models.Folder, error) {
+	name, err := validFolderName(name)
+	if err != nil {
+		return nil, err
+	}
+	if parentID != nil {
+		if _, err := fs.GetFolder(*parentID, ownerID); err != nil {
+			return nil, err
+		}
+	}
+	if err := fs.checkNameAvailable(ownerID, parentID, name, ""); err != nil {
+		return nil, err
+	}
+	db := fs.FileSvc.LogRepo.DB
+	folder, err := database.InsertFolder(db, ownerID, name, parentID)
+	if database.IsDuplicateKey(db, err) {
+		// Otra petición creó la misma carpeta después de la verificación
+		return nil, ErrFolderNameTaken
+	}
+	return folder, err
+}
+
+// RenameFolder cambia el nombre de una carpeta.
+func (fs *FolderService) RenameFolder(folderID, ownerID, name string) (*models.Folder, error) {
+	folder, err := fs.GetFolder(folderID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if folder.Name, err = validFolderName(name); err != nil {
+		return nil, err
+	}
+	if err := fs.checkNameAvailable(ownerID, folder.ParentID, folder.Name, folder.ID); err != nil {
+		return nil, err
+	}
+	if err := fs.updateFolder(folder); err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// MoveFolder mueve una carpeta dentro de parentID (nil para la raíz),
+// rechazando los movimientos que crearían un ciclo.
+func (fs *FolderService) MoveFolder(folderID, ownerID string, parentID *string) (*models.Folder, error) {
+	folder, err := fs.GetFolder(folderID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if parentID != nil {
+		// Recorrer los ancestros del nuevo padre: si aparece la carpeta movida hay un ciclo
+		for ancestorID := parentID; ancestorID != nil; {
+			if *ancestorID == folder.ID {
+				return nil, ErrFolderCycle
+			}
+			ancestor, err := fs.GetFolder(*ancestorID, ownerID)
+			if err != nil {
+				return nil, err
+			}
+			ancestorID = ancestor.ParentID
+		}
+	}
+	if err := fs.checkNameAvailable(ownerID, parentID, folder.Name, folder.ID); err != nil {
+		return nil, err
+	}
+	folder.ParentID = parentID
+	if err := fs.updateFolder(folder); err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// DeleteFolder elimina una carpeta. Si no está vacía solo se elimina con
+// recursive: sus archivos se mueven a la papelera y sus subcarpetas se
+// eliminan. Los archivos restaurados después vuelven a la raíz.
+func (fs *FolderService) DeleteFolder(folderID, ownerID string, recursive bool) error {
+	folder, err := fs.GetFolder(folderID, ownerID)
+	if err != nil {
+		return err
+	}
+
+	// Todo el subárbol se elimina en una transacción: un error a mitad de
+	// camino no deja carpetas ni archivos a medio eliminar
+	var files []*models.File
+	err = fs.FileSvc.LogRepo.DB.Transaction(func(tx *gorm.DB) error {
+		subtree, err := database.GetFolderSubtreeIDs(tx, folder.ID)
+		if err != nil {
+			return err
+		}
+		if files, err = database.GetFilesInFolders(tx, subtree); err != nil {
+			return err
+		}
+		if !recursive && (len(subtree) > 1 || len(files) > 0) {
+			return ErrFolderNotEmpty
+		}
+
+		for _, file := range files {
+			if file.OwnerID != ownerID {
+				return errors.New("solo el propietario puede eliminar el archivo")
+			}
+			if err := database.DeleteFileRecord(tx, file.ID); err != nil {
+				return err
+			}
+		}
+		if err := database.ClearFolderReferences(tx, subtree); err != nil {
+			return err
+		}
+		// Eliminar de las hojas hacia la raíz para respetar la relación padre-hijo
+		for i := len(subtree) - 1; i >= 0; i-- {
+			if err := database.DeleteFolder(tx, subtree[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Replicar los registros solo cuando la eliminación quedó confirmada
+	for _, file := range files {
+		fs.FileSvc.SyncFileRecord(file)
+	}
+	return nil
+}
+
+// ListContents devuelve una página del contenido de la carpeta (nil para la
+// raíz): las subcarpetas ordenadas por nombre seguidas de los archivos.
+func (fs *FolderService) ListContents(folderID *string, ownerID string, limit, offset int) (*FolderContents, error) {
+	db := fs.FileSvc.LogRepo.DB
+	contents := &FolderContents{Folders: []*models.Folder{}, Files: []*models.File{}, Limit: limit, Offset: offset}
+	if folderID != nil {
+		folder, err := fs.GetFolder(*folderID, ownerID)
+		if err != nil {
+			return nil, err
+		}
+		contents.Folder = folder
+	}
+
+	folderCount, err := database.CountSubfolders(db, ownerID, folderID)
+	if err != nil {
+		return nil, err
+	}
+	fileCount, err := database.CountFolderFiles(db, ownerID, folderID)
+	if err != nil {
+		return nil, err
+	}
+	contents.Total = folderCount + fileCount
+
+	// La página puede abarcar el final de las subcarpetas y el inicio de los archivos
+	if int64(offset) < folderCount {
+		if contents.Folders, err = database.GetSubfolders(db, ownerID, folderID, limit, offset); err != nil {
+			return nil, err
+		}
+	}
+	remaining := limit - len(contents.Folders)
+	if remaining > 0 {
+		fileOffset := offset - int(folderCount)
+		if fileOffset < 0 {
+			fileOffset = 0
+		}
+		if contents.Files, err = database.GetFolderFiles(db, ownerID, folderID, remaining, fileOffset); err != nil {
+			return nil, err
+		}
+	}
+	return contents, nil
+}
+
+// EnsureFolderPath devuelve la carpeta que corresponde a la ruta names dentro
+// de parentID (nil para la raíz) y crea las que falten.
+func (fs *FolderService) EnsureFolderPath(ownerID string, parentID *string, names []string) (*string, error) {
+	db := fs.FileSvc.LogRepo.DB
+	for _, name := range names {
+		name, err := validFolderName(name)
+		if err != nil {
+			return nil, err
+		}
+		folder, err := database.GetFolderByName(db, ownerID, parentID, name)
+		if err != nil {
+			return nil, err
+		}
+		if folder == nil {
+			folder, err = database.InsertFolder(db, ownerID, name, parentID)
+			if database.IsDuplicateKey(db, err) {
+				// Otra extracción creó la carpeta al mismo tiempo: usar esa
+				folder, err = database.GetFolderByName(db, ownerID, parentID, name)
+				if err == nil && folder == nil {
+					err = ErrFolderNotFound
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		parentID = &folder.ID
+	}
+	return parentID, nil
+}
+
+// MoveFile mueve el registro de un archivo a otra carpeta (nil para la raíz)
+// sin mover su contenido. Solo el propietario del archivo puede moverlo.
+func (fs *FolderService) MoveFile(fileID, ownerID string, folderID *string) (*models.File, error) {
+	file, err := fs.FileSvc.GetFileRecordByID(fileID)
+	if err != nil {
+		return nil, err
+	}
+	if file.OwnerID != ownerID {
+		return nil, errors.New("solo el propietario puede mover el archivo")
+	}
+	if folderID != nil {
+		if _, err := fs.GetFolder(*folderID, ownerID); err != nil {
+			return nil, err
+		}
+	}
+	if err := database.UpdateFileFolder(fs.FileSvc.LogRepo.DB, file.ID, folderID); err != nil {
+		return nil, err
+	}
+	file.FolderID = folderID
+	fs.FileSvc.SyncFileRecord(file)
+	return file, nil
+}
+
+// updateFolder guarda el nombre y el padre de la carpeta. El índice único
+// resuelve las carreras que checkNameAvailable no puede detectar.
+func (fs *FolderService) updateFolder(folder *models.Folder) error {
+	db := fs.FileSvc.LogRepo.DB
+	err := database.UpdateFolder(db, folder.ID, folder.Name, folder.ParentID)
+	if database.IsDuplicateKey(db, err) {
+		return ErrFolderNameTaken
+	}
+	return err
+}
+
+// checkNameAvailable verifica que no haya otra carpeta con el mismo nombre en el mismo padre.
+func (fs *FolderService) checkNameAvailable(ownerID string, parentID *string, name, excludeID string) error {
+	exists, err := database.FolderNameExists(fs.FileSvc.LogRepo.DB, ownerID, parentID, name, excludeID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrFolderNameTaken
+	}
+	return nil
+}
+
+// validFolderName normaliza el nombre y rechaza los vacíos o con separadores.
+func validFolderName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 255 || strings.ContainsAny(name, "/\\") || name == "." || name == ".." {
+		return "", ErrFolderInvalid
+	}
+	return name, nil
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/t-saturn/file-server/database"
+	"github.com/t-saturn/file-server/models"
+)
+
+func TestConcurrentFolderCreationKeepsNamesUnique(t *testing.T) {
+	db := openTestDB(t)
+	ownerID := uuid.NewString()
+	t.Cleanup(func() {
+		db.Where("owner_id = ?", ownerID).Delete(&models.Folder{})
+	})
+	fs := NewFolderService(&FileService{LogRepo: &database.LogRepository{DB: db}})
+
+	// Varias extracciones en la misma ruta deben terminar en las mismas carpetas
+	const workers = 8
+	ids := make([]*string, workers)
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i], errs[i] = fs.EnsureFolderPath(ownerID, nil, []string{"fotos", "2025"})
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < workers; i++ {
+		if errs[i] != nil {
+			t.Fatalf("EnsureFolderPath: %v", errs[i])
+		}
+		if *ids[i] != *ids[0] {
+			t.Errorf("EnsureFolderPath devolvió carpetas distintas: %s y %s", *ids[i], *ids[0])
+		}
+	}
+
+	// Solo una de las creaciones simultáneas del mismo nombre puede prosperar
+	created := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := fs.CreateFolder(ownerID, "documentos", nil)
+			created <- err
+		}()
+	}
+	wg.Wait()
+	close(created)
+	succeeded := 0
+	for err := range created {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrFolderNameTaken):
+			t.Errorf("CreateFolder: %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("se crearon %d carpetas \"documentos\", se esperaba 1", succeeded)
+	}
+
+	var count int64
+	db.Model(&models.Folder{}).Where("owner_id = ? AND parent_id IS NULL", ownerID).Count(&count)
+	if count != 2 {
+		t.Errorf("carpetas en la raíz = %d, se esperaban 2", count)
+	}
+}
+
+func TestDeleteFolderRejectsNonEmptyWithoutChanges(t *testing.T) {
+	db := openTestDB(t)
+	ownerID := uuid.NewString()
+	t.Cleanup(func() {
+		db.Where("owner_id = ?", ownerID).Delete(&models.Folder{})
+	})
+	fs := NewFolderService(&FileService{LogRepo: &database.LogRepository{DB: db}})
+
+	leafID, err := fs.EnsureFolderPath(ownerID, nil, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := database.GetFolderByName(db, ownerID, nil, "a")
+	if err != nil || root == nil {
+		t.Fatalf("GetFolderByName: %v, %v", root, err)
+	}
+	if err := fs.DeleteFolder(root.ID, ownerID, false); !errors.Is(err, ErrFolderNotEmpty) {
+		t.Fatalf("DeleteFolder = %v, se esperaba ErrFolderNotEmpty", err)
+	}
+	if _, err := fs.GetFolder(*leafID, ownerID); err != nil {
+		t.Errorf("la subcarpeta no debía eliminarse: %v", err)
+	}
+	if err := fs.DeleteFolder(root.ID, ownerID, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{root.ID, *leafID} {
+		if _, err := fs.GetFolder(id, ownerID); !errors.Is(err, ErrFolderNotFound) {
+			t.Errorf("GetFolder(%s) = %v, se esperaba ErrFolderNotFound", id, err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"github.com/t-saturn/file-server/database"
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/utils"
+)
+
+// sniffLen es la cantidad de bytes que usa http.DetectContentType.
+const sniffLen = 512
+
+// firstUUID es el menor UUID posible; inicia los recorridos por ID.
+const firstUUID = "00000000-0000-0000-0000-000000000000"
+
+// contentInspector calcula el tamaño, el SHA-256 y los primeros bytes del
+// contenido a medida que se lee, sin volver a leerlo del almacenamiento.
+type contentInspector struct {
+	reader io.Reader
+	hash   hash.Hash
+	head   []byte
+	size   int64
+}
+
+func newContentInspector(reader io.Reader) *contentInspector {
+	return &contentInspector{reader: reader, hash: sha256.New()}
+}
+
+func (ci *contentInspector) Read(p []byte) (int, error) {
+	n, err := ci.reader.Read(p)
+	if n > 0 {
+		ci.hash.Write(p[:n])
+		if missing := sniffLen - len(ci.head); missing > 0 {
+			ci.head = append(ci.head, p[:min(n, missing)]...)
+		}
+		ci.size += int64(n)
+	}
+	return n, err
+}
+
+// Metadata devuelve los datos del contenido leído hasta el momento.
+func (ci *contentInspector) Metadata(project, filename string) models.FileMetadata {
+	return models.FileMetadata{
+		Project:  project,
+		Size:     ci.size,
+		MimeType: detectMimeType(ci.head, filename),
+		Checksum: hex.EncodeToString(ci.hash.Sum(nil)),
+	}
+}
+
+// detectMimeType detecta el tipo MIME a partir de los primeros bytes. Cuando
+// el resultado es genérico (binario o texto plano) y la extensión indica un
+// tipo conocido, se usa el de la extensión (CSS, JSON, documentos de Office...).
+// Se devuelve solo el tipo, sin parámetros como charset, para que los filtros
+// y comparaciones por tipo sean exactos.
+func detectMimeType(head []byte, filename string) string {
+	detected := mediaType(http.DetectContentType(head))
+	if detected == "application/octet-stream" || detected == "text/plain" {
+		if byExtension := mediaType(mime.TypeByExtension(filepath.Ext(filename))); byExtension != "" {
+			return byExtension
+		}
+	}
+	return detected
+}
+
+// blobMetadata lee el contenido guardado en relativePath para obtener sus
+// metadatos. Se usa cuando el contenido no pasó por UploadFile (restauración
+// de versiones y migración de registros anteriores).
+func (fs *FileService) blobMetadata(relativePath, filename string) (models.FileMetadata, error) {
+	file, err := fs.Storage.Open(relativePath)
+	if err != nil {
+		return models.FileMetadata{}, err
+	}
+	defer file.Close()
+
+	inspector := newContentInspector(file)
+	if _, err := io.Copy(io.Discard, inspector); err != nil {
+		return models.FileMetadata{}, err
+	}
+	return inspector.Metadata(ProjectFromPath(relativePath), filename), nil
+}
+
+// BackfillFileMetadata completa el tamaño, el tipo MIME y el checksum de los
+// archivos y versiones registrados antes de guardar esos datos. Los registros
+// cuyo contenido no se puede leer se informan y se omiten. Devuelve cuántos
+// registros se actualizaron y cuántos se omitieron.
+func (fs *FileService) BackfillFileMetadata() (updated, skipped int, err error) {
+	const batchSize = 200
+	db := fs.LogRepo.DB
+
+	for afterID := firstUUID; ; {
+		files, err := database.GetFilesWithoutChecksum(db, afterID, batchSize)
+		if err != nil {
+			return updated, skipped, err
+		}
+		for _, file := range files {
+			afterID = file.ID
+			metadata, err := fs.blobMetadata(file.URL, file.OriginalName)
+			if err != nil {
+				utils.Logger.WithError(err).WithFields(logrus.Fields{"file_id": file.ID, "path": file.URL}).Warn("No se pudo leer el contenido del archivo")
+				skipped++
+				continue
+			}
+			if err := database.UpdateFileMetadata(db, file.ID, metadata); err != nil {
+				return updated, skipped, err
+			}
+			updated++
+		}
+		if len(files) < batchSize {
+			break
+		}
+	}
+
+	for afterID := firstUUID; ; {
+		versions, err := database.GetFileVersionsWithoutChecksum(db, afterID, batchSize)
+		if err != nil {
+			return updated, skipped, err
+		}
+		for _, version := range versions {
+			afterID = version.ID
+			metadata, err := fs.blobMetadata(version.URL, version.OriginalName)
+			if err != nil {
+				utils.Logger.WithError(err).WithFields(logrus.Fields{"file_id": version.FileID, "version": version.Version, "path": version.URL}).Warn("No se pudo leer el contenido de la versión")
+				skipped++
+				continue
+			}
+			if err := database.UpdateFileVersionMetadata(db, version.ID, metadata); err != nil {
+				return updated, skipped, err
+			}
+			updated++
+		}
+		if len(versions) < batchSize {
+			break
+		}
+	}
+	// Los tamaños completados cambian el uso de las cuotas
+	return updated, skipped, database.RecalculateQuotaUsage(db)
+}
@@ -0,0 +1,24 @@
+package services
+
+import "testing"
+
+func TestDetectMimeType(t *testing.T) {
+	tests := []struct {
+		head     string
+		filename string
+		want     string
+	}{
+		{"hola mundo", "a.txt", "text/plain"},
+		{"hola mundo", "sin-extension", "text/plain"},
+		{"<html><body>hola</body></html>", "a.html", "text/html"},
+		{"body { color: red }", "a.css", "text/css"},
+		{`{"a": 1}`, "a.json", "application/json"},
+		{"%PDF-1.7", "a.bin", "application/pdf"},
+		{"\x00\x01\x02", "a.unknownext", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		if got := detectMimeType([]byte(tt.head), tt.filename); got != tt.want {
+			t.Errorf("detectMimeType(%q, %q) = %q, se esperaba %q", tt.head, tt.filename, got, tt.want)
+		}
+	}
+}
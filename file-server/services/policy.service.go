@@ -0,0 +1,183 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"github.com/t-saturn/file-server/database"
+	"github.com/t-saturn/file-server/models"
+)
+
+// Errores devueltos por UploadPolicyService.
+var (
+	ErrFileTooLarge       = errors.New("el archivo supera el tamaño máximo permitido")
+	ErrMimeTypeNotAllowed = errors.New("tipo de archivo no permitido")
+	ErrInvalidPolicy      = errors.New("política de subida inválida")
+)
+
+// UploadPolicyService aplica las políticas de subida de cada proyecto. Los
+// proyectos sin política propia usan Defaults.
+type UploadPolicyService struct {
+	FileSvc  *FileService
+	Defaults models.UploadPolicy
+}
+
+// NewUploadPolicyService crea una instancia de UploadPolicyService.
+func NewUploadPolicyService(fileSvc *FileService, defaults models.UploadPolicy) *UploadPolicyService {
+	defaults.Default = true
+	for i, mimeType := range defaults.AllowedMimeTypes {
+		defaults.AllowedMimeTypes[i] = mediaType(mimeType)
+	}
+	for i, mimeType := range defaults.BlockedMimeTypes {
+		defaults.BlockedMimeTypes[i] = mediaType(mimeType)
+	}
+	return &UploadPolicyService{FileSvc: fileSvc, Defaults: defaults}
+}
+
+// Policy devuelve la política vigente del proyecto.
+func (ps *UploadPolicyService) Policy(project string) (*models.UploadPolicy, error) {
+	policy, err := database.GetUploadPolicy(ps.FileSvc.LogRepo.DB, project)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		defaults := ps.Defaults
+		defaults.Project = project
+		return &defaults, nil
+	}
+	return policy, nil
+}
+
+// SetPolicy define la política propia de un proyecto; reemplaza por completo a
+// la de la configuración.
+func (ps *UploadPolicyService) SetPolicy(project string, req models.UploadPolicyRequest) (*models.UploadPolicy, error) {
+	if project == "" || req.MaxSize < 0 {
+		return nil, fmt.Errorf("%w: el tamaño máximo no puede ser negativo", ErrInvalidPolicy)
+	}
+	allowed, err := normalizeMimeTypes(req.AllowedMimeTypes)
+	if err != nil {
+		return nil, err
+	}
+	blocked, err := normalizeMimeTypes(req.BlockedMimeTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &models.UploadPolicy{
+		Project:          project,
+		MaxSize:          req.MaxSize,
+		AllowedMimeTypes: allowed,
+		BlockedMimeTypes: blocked,
+	}
+	if err := database.SaveUploadPolicy(ps.FileSvc.LogRepo.DB, policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// DeletePolicy elimina la política propia del proyecto. Devuelve false si no tenía.
+func (ps *UploadPolicyService) DeletePolicy(project string) (bool, error) {
+	return database.DeleteUploadPolicy(ps.FileSvc.LogRepo.DB, project)
+}
+
+// Enforce lee los primeros bytes de data para detectar su tipo MIME y lo
+// compara con la política antes de que llegue al almacenamiento. Devuelve un
+// lector con el contenido completo que falla con ErrFileTooLarge si supera el
+// tamaño máximo.
+func (ps *UploadPolicyService) Enforce(policy *models.UploadPolicy, filename string, data io.Reader) (io.Reader, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(data, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	if err := checkMimeType(policy, head, filename); err != nil {
+		return nil, err
+	}
+
+	content := io.MultiReader(bytes.NewReader(head), data)
+	if policy.MaxSize > 0 {
+		return &sizeLimitedReader{reader: content, limit: policy.MaxSize}, nil
+	}
+	return content, nil
+}
+
+// checkMimeType exige que el tipo detectado en el contenido esté permitido y
+// que ni ese tipo ni el que indica la extensión estén bloqueados, para que un
+// archivo no pueda servirse como un tipo bloqueado cambiando su nombre.
+func checkMimeType(policy *models.UploadPolicy, head []byte, filename string) error {
+	detected := detectMimeType(head, filename)
+	byExtension := mediaType(mime.TypeByExtension(filepath.Ext(filename)))
+
+	if len(policy.AllowedMimeTypes) > 0 && !matchesMimeType(policy.AllowedMimeTypes, detected) {
+		return fmt.Errorf("%w: %s no está entre los tipos admitidos del proyecto", ErrMimeTypeNotAllowed, detected)
+	}
+	for _, mimeType := range []string{detected, byExtension} {
+		if mimeType != "" && matchesMimeType(policy.BlockedMimeTypes, mimeType) {
+			return fmt.Errorf("%w: %s está bloqueado en el proyecto", ErrMimeTypeNotAllowed, mimeType)
+		}
+	}
+	return nil
+}
+
+// matchesMimeType indica si mimeType coincide con alguno de los patrones
+// ("image/png", "image/*" o "*/*").
+func matchesMimeType(patterns []string, mimeType string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*/*" || pattern == mimeType {
+			return true
+		}
+		if prefix, found := strings.CutSuffix(pattern, "/*"); found && strings.HasPrefix(mimeType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// mediaType quita los parámetros (p.ej. "; charset=utf-8") de un tipo MIME.
+func mediaType(mimeType string) string {
+	if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil {
+		return mediaType
+	}
+	mediaType, _, _ := strings.Cut(mimeType, ";")
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
+
+// normalizeMimeTypes valida y normaliza una lista de tipos MIME de una política.
+func normalizeMimeTypes(mimeTypes []string) ([]string, error) {
+	normalized := []string{}
+	for _, mimeType := range mimeTypes {
+		mimeType = mediaType(mimeType)
+		if mimeType == "" {
+			continue
+		}
+		major, minor, found := strings.Cut(mimeType, "/")
+		if !found || major == "" || minor == "" || strings.Contains(minor, "/") || (major == "*" && minor != "*") {
+			return nil, fmt.Errorf("%w: %q no es un tipo MIME válido", ErrInvalidPolicy, mimeType)
+		}
+		normalized = append(normalized, mimeType)
+	}
+	return normalized, nil
+}
+
+// sizeLimitedReader falla con ErrFileTooLarge en cuanto se leen más de limit bytes.
+type sizeLimitedReader struct {
+	reader io.Reader
+	limit  int64
+	read   int64
+}
+
+func (sr *sizeLimitedReader) Read(p []byte) (int, error) {
+	n, err := sr.reader.Read(p)
+	sr.read += int64(n)
+	if sr.read > sr.limit {
+		return n, fmt.Errorf("%w (%d bytes)", ErrFileTooLarge, sr.limit)
+	}
+	return n, err
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/t-saturn/file-server/database"
+	"github.com/t-saturn/file-server/models"
+)
+
+// Errores devueltos por ProjectService.
+var (
+	ErrProjectNotFound  = errors.New("proyecto no encontrado")
+	ErrProjectForbidden = errors.New("no tiene permisos suficientes en el proyecto")
+	ErrProjectExists    = errors.New("ya existe un proyecto con ese nombre")
+	ErrProjectInvalid   = errors.New("datos de proyecto inválidos")
+	ErrLastProjectAdmin = errors.New("el proyecto debe conservar al menos un administrador")
+	ErrMemberNotFound   = errors.New("el usuario no es miembro del proyecto")
+)
+
+// projectNamePattern restringe los nombres a un segmento de ruta seguro, ya
+// que el nombre es el primer directorio del almacenamiento de sus archivos.
+var projectNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// reservedProjectNames son directorios del almacenamiento que no pueden usarse
+// como proyecto (el de blobs del almacenamiento CAS).
+var reservedProjectNames = []string{"blobs"}
+
+// ProjectService gestiona los proyectos y sus miembros. El rol de un miembro
+// vale para todos los archivos del proyecto y se suma a los permisos de cada
+// archivo (ver FileService.FileRole).
+type ProjectService struct {
+	FileSvc *FileService
+}
+
+// NewProjectService crea una instancia de ProjectService.
+func NewProjectService(fileSvc *FileService) *ProjectService {
+	return &ProjectService{FileSvc: fileSvc}
+}
+
+// CreateProject crea un proyecto del que userID queda como administrador.
+func (ps *ProjectService) CreateProject(name, description, userID string) (*models.Project, error) {
+	if !projectNamePattern.MatchString(name) || slices.Contains(reservedProjectNames, name) {
+		return nil, fmt.Errorf("%w: el nombre solo admite letras, números, '.', '_' y '-' (máximo 64 caracteres)", ErrProjectInvalid)
+	}
+	project := &models.Project{Name: name, Description: description, CreatedBy: userID}
+	created, err := database.InsertProject(ps.FileSvc.LogRepo.DB, project, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return nil, ErrProjectExists
+	}
+	return project, nil
+}
+
+// GetProject obtiene el proyecto junto con el rol del usuario, que debe ser miembro.
+func (ps *ProjectService) GetProject(name, userID string) (*models.UserProject, error) {
+	project, role, err := ps.projectRole(name, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, ErrProjectForbidden
+	}
+	return &models.UserProject{Project: *project, Role: role}, nil
+}
+
+// ListProjects devuelve los proyectos de los que el usuario es miembro.
+func (ps *ProjectService) ListProjects(userID string) ([]*models.UserProject, error) {
+	return database.GetUserProjects(ps.FileSvc.LogRepo.DB, userID)
+}
+
+// UpdateProject cambia la descripción del proyecto; requiere ser administrador.
+func (ps *ProjectService) UpdateProject(name, description, userID string) (*models.UserProject, error) {
+	if err := ps.RequireRole(name, userID, models.ProjectRoleAdmin); err != nil {
+		return nil, err
+	}
+	if err := database.UpdateProjectDescription(ps.FileSvc.LogRepo.DB, name, description); err != nil {
+		return nil, err
+	}
+	return ps.GetProject(name, userID)
+}
+
+// Members devuelve los miembros del proyecto; requiere ser miembro.
+func (ps *ProjectService) Members(name, userID string) ([]*models.ProjectMember, error) {
+	if err := ps.RequireRole(name, userID, models.ProjectRoleAdmin, models.ProjectRoleEditor, models.ProjectRoleViewer); err != nil {
+		return nil, err
+	}
+	return database.GetProjectMembers(ps.FileSvc.LogRepo.DB, name)
+}
+
+// SetMember agrega un miembro o cambia su rol; requiere que requestorID sea
+// administrador del proyecto.
+func (ps *ProjectService) SetMember(name, requestorID, userID, role string) (*models.ProjectMember, error) {
+	if err := ps.RequireRole(name, requestorID, models.ProjectRoleAdmin); err != nil {
+		return nil, err
+	}
+	return ps.AssignMember(name, userID, role)
+}
+
+// AssignMember agrega un miembro o cambia su rol sin verificar quién lo pide.
+// Lo usan SetMember y los administradores del servidor, que pueden asignar el
+// primer administrador de los proyectos que no tienen ninguno.
+func (ps *ProjectService) AssignMember(name, userID, role string) (*models.ProjectMember, error) {
+	if userID == "" || (role != models.ProjectRoleAdmin && role != models.ProjectRoleEditor && role != models.ProjectRoleViewer) {
+		return nil, fmt.Errorf("%w: se requiere user_id y un rol admin, editor o viewer", ErrProjectInvalid)
+	}
+	project, current, err := ps.projectRole(name, userID)
+	if err != nil {
+		return nil, err
+	}
+	if current == models.ProjectRoleAdmin && role != models.ProjectRoleAdmin {
+		if err := ps.keepOneAdmin(project.Name); err != nil {
+			return nil, err
+		}
+	}
+	return database.UpsertProjectMember(ps.FileSvc.LogRepo.DB, project.Name, userID, role)
+}
+
+// RemoveMember quita a un miembro del proyecto; requiere ser administrador,
+// salvo para abandonar el proyecto uno mismo.
+func (ps *ProjectService) RemoveMember(name, requestorID, userID string) error {
+	if requestorID != userID {
+		if err := ps.RequireRole(name, requestorID, models.ProjectRoleAdmin); err != nil {
+			return err
+		}
+	}
+	project, current, err := ps.projectRole(name, userID)
+	if err != nil {
+		return err
+	}
+	if current == "" {
+		return ErrMemberNotFound
+	}
+	if current == models.ProjectRoleAdmin {
+		if err := ps.keepOneAdmin(project.Name); err != nil {
+			return err
+		}
+	}
+	_, err = database.DeleteProjectMember(ps.FileSvc.LogRepo.DB, project.Name, userID)
+	return err
+}
+
+// RequireRole verifica que el proyecto exista y que el usuario tenga alguno de
+// los roles indicados.
+func (ps *ProjectService) RequireRole(name, userID string, roles ...string) error {
+	_, role, err := ps.projectRole(name, userID)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(roles, role) {
+		return ErrProjectForbidden
+	}
+	return nil
+}
+
+// projectRole obtiene el proyecto y el rol del usuario en él ("" si no es miembro).
+func (ps *ProjectService) projectRole(name, userID string) (*models.Project, string, error) {
+	db := ps.FileSvc.LogRepo.DB
+	project, err := database.GetProject(db, name)
+	if err != nil {
+		return nil, "", err
+	}
+	if project == nil {
+		return nil, "", ErrProjectNotFound
+	}
+	role, err := database.GetProjectMemberRole(db, name, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	return project, role, nil
+}
+
+// keepOneAdmin impide dejar al proyecto sin administradores.
+func (ps *ProjectService) keepOneAdmin(name string) error {
+	admins, err := database.CountProjectAdmins(ps.FileSvc.LogRepo.DB, name)
+	if err != nil {
+		return err
+	}
+	if admins <= 1 {
+		return ErrLastProjectAdmin
+	}
+	return nil
+}
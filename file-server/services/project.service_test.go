@@ -0,0 +1,88 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/t-saturn/file-server/database"
+	"github.com/t-saturn/file-server/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// openTestDB abre la base de TEST_DATABASE_URL (un DSN de Postgres) y aplica
+// las migraciones; sin ella la prueba se omite.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL no definida")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestMigrateKeepsUploadAccessToLegacyProjects(t *testing.T) {
+	db := openTestDB(t)
+	project := "legado-" + uuid.NewString()[:8]
+	first, second := uuid.NewString(), uuid.NewString()
+	t.Cleanup(func() {
+		db.Where("project = ?", project).Delete(&models.ProjectMember{})
+		db.Where("name = ?", project).Delete(&models.Project{})
+		db.Where("file_id IN (?)", db.Model(&models.File{}).Select("id::text").Where("project = ?", project)).Delete(&models.FileVersion{})
+		db.Where("project = ?", project).Delete(&models.File{})
+	})
+
+	// Archivos subidos antes de que existieran los proyectos y sus miembros
+	created := time.Now().Add(-time.Hour)
+	for i, ownerID := range []string{first, second, first} {
+		file := &models.File{
+			OriginalName: "a.txt",
+			URL:          project + "/a.txt",
+			FileUrl:      "a.txt",
+			OwnerID:      ownerID,
+			Project:      project,
+			CreatedAt:    created.Add(time.Duration(i) * time.Minute),
+			UpdatedAt:    created,
+		}
+		if err := db.Create(file).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	ps := NewProjectService(&FileService{LogRepo: &database.LogRepository{DB: db}})
+	for _, ownerID := range []string{first, second} {
+		if err := ps.RequireRole(project, ownerID, models.ProjectRoleAdmin, models.ProjectRoleEditor); err != nil {
+			t.Errorf("propietario %s sin acceso de subida: %v", ownerID, err)
+		}
+	}
+	if err := ps.RequireRole(project, first, models.ProjectRoleAdmin); err != nil {
+		t.Errorf("el propietario del archivo más antiguo debe ser admin: %v", err)
+	}
+	if err := ps.RequireRole(project, uuid.NewString(), models.ProjectRoleAdmin, models.ProjectRoleEditor); !errors.Is(err, ErrProjectForbidden) {
+		t.Errorf("un usuario sin archivos en el proyecto obtuvo acceso: %v", err)
+	}
+
+	// Volver a migrar no toca a los miembros que ya tiene el proyecto
+	if _, err := ps.AssignMember(project, second, models.ProjectRoleViewer); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.RequireRole(project, second, models.ProjectRoleViewer); err != nil {
+		t.Errorf("la migración restauró un rol cambiado: %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/sirupsen/logrus"
+	"github.com/t-saturn/file-server/database"
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/utils"
+)
+
+// Errores devueltos por QuotaService.
+var (
+	ErrQuotaExceeded = errors.New("cuota de almacenamiento excedida")
+	ErrInvalidQuota  = errors.New("cuota inválida")
+)
+
+// QuotaLimits define los límites por defecto de usuarios y proyectos sin
+// límites propios. 0 indica sin límite.
+type QuotaLimits struct {
+	UserBytes    int64
+	UserFiles    int64
+	ProjectBytes int64
+	ProjectFiles int64
+}
+
+// QuotaService controla el espacio y la cantidad de archivos de cada usuario
+// y de cada proyecto. El uso se actualiza en FileService al crear, versionar y
+// purgar archivos; aquí se consulta y se compara con los límites.
+type QuotaService struct {
+	FileSvc  *FileService
+	Defaults QuotaLimits
+}
+
+// NewQuotaService crea una instancia de QuotaService.
+func NewQuotaService(fileSvc *FileService, defaults QuotaLimits) *QuotaService {
+	return &QuotaService{FileSvc: fileSvc, Defaults: defaults}
+}
+
+// Usage devuelve el uso y los límites vigentes de un usuario o proyecto.
+func (qs *QuotaService) Usage(scope, subject string) (*models.QuotaUsage, error) {
+	if scope != models.QuotaScopeUser && scope != models.QuotaScopeProject {
+		return nil, fmt.Errorf("%w: el alcance debe ser user o project", ErrInvalidQuota)
+	}
+	quota, err := database.GetQuota(qs.FileSvc.LogRepo.DB, scope, subject)
+	if err != nil {
+		return nil, err
+	}
+	return qs.usage(quota), nil
+}
+
+// SetLimits cambia los límites propios de un usuario o proyecto (nil vuelve
+// al valor por defecto y 0 quita el límite).
+func (qs *QuotaService) SetLimits(scope, subject string, maxBytes, maxFiles *int64) (*models.QuotaUsage, error) {
+	if scope != models.QuotaScopeUser && scope != models.QuotaScopeProject {
+		return nil, fmt.Errorf("%w: el alcance debe ser user o project", ErrInvalidQuota)
+	}
+	if subject == "" || (maxBytes != nil && *maxBytes < 0) || (maxFiles != nil && *maxFiles < 0) {
+		return nil, fmt.Errorf("%w: los límites no pueden ser negativos", ErrInvalidQuota)
+	}
+	quota, err := database.SetQuotaLimits(qs.FileSvc.LogRepo.DB, scope, subject, maxBytes, maxFiles)
+	if err != nil {
+		return nil, err
+	}
+	return qs.usage(quota), nil
+}
+
+// Allowance verifica que el propietario y el proyecto admitan addFiles archivos
+// más y devuelve cuántos bytes pueden escribirse todavía (-1 sin límite). Si
+// alguna cuota ya está agotada devuelve ErrQuotaExceeded.
+func (qs *QuotaService) Allowance(ownerID, project string, addFiles int64) (int64, error) {
+	remaining := int64(-1)
+	for _, target := range []struct{ scope, subject, label string }{
+		{models.QuotaScopeUser, ownerID, "del usuario"},
+		{models.QuotaScopeProject, project, "del proyecto " + project},
+	} {
+		usage, err := qs.Usage(target.scope, target.subject)
+		if err != nil {
+			return 0, err
+		}
+		if usage.MaxFiles > 0 && usage.UsedFiles+addFiles > usage.MaxFiles {
+			return 0, fmt.Errorf("%w: se alcanzó el límite de %d archivos %s", ErrQuotaExceeded, usage.MaxFiles, target.label)
+		}
+		if usage.MaxBytes > 0 {
+			left := usage.MaxBytes - usage.UsedBytes
+			if left <= 0 {
+				return 0, fmt.Errorf("%w: se usaron %d de %d bytes %s", ErrQuotaExceeded, usage.UsedBytes, usage.MaxBytes, target.label)
+			}
+			if remaining < 0 || left < remaining {
+				remaining = left
+			}
+		}
+	}
+	return remaining, nil
+}
+
+// LimitReader devuelve un lector que falla con ErrQuotaExceeded si data supera
+// remaining bytes (remaining < 0 no aplica límite). Así una subida sin tamaño
+// declarado se corta en cuanto excede la cuota.
+func LimitReader(data io.Reader, remaining int64) io.Reader {
+	if remaining < 0 {
+		return data
+	}
+	return &quotaReader{reader: data, limit: remaining}
+}
+
+type quotaReader struct {
+	reader io.Reader
+	limit  int64
+	read   int64
+}
+
+func (qr *quotaReader) Read(p []byte) (int, error) {
+	n, err := qr.reader.Read(p)
+	qr.read += int64(n)
+	if qr.read > qr.limit {
+		return n, fmt.Errorf("%w: el archivo supera los %d bytes disponibles", ErrQuotaExceeded, qr.limit)
+	}
+	return n, err
+}
+
+// usage combina el uso registrado con los límites propios o por defecto.
+func (qs *QuotaService) usage(quota *models.Quota) *models.QuotaUsage {
+	maxBytes, maxFiles := qs.Defaults.UserBytes, qs.Defaults.UserFiles
+	if quota.Scope == models.QuotaScopeProject {
+		maxBytes, maxFiles = qs.Defaults.ProjectBytes, qs.Defaults.ProjectFiles
+	}
+	if quota.MaxBytes != nil {
+		maxBytes = *quota.MaxBytes
+	}
+	if quota.MaxFiles != nil {
+		maxFiles = *quota.MaxFiles
+	}
+	return &models.QuotaUsage{
+		Scope:     quota.Scope,
+		Subject:   quota.Subject,
+		UsedBytes: quota.UsedBytes,
+		UsedFiles: quota.UsedFiles,
+		MaxBytes:  maxBytes,
+		MaxFiles:  maxFiles,
+		Custom:    quota.MaxBytes != nil || quota.MaxFiles != nil,
+	}
+}
+
+// addQuotaUsage suma bytes y archivos al uso del propietario y del proyecto
+// del archivo. Un error solo se registra: los contadores se recalculan al migrar.
+func (fs *FileService) addQuotaUsage(file *models.File, bytes, files int64) {
+	if err := database.AddQuotaUsage(fs.LogRepo.DB, file.OwnerID, file.Project, bytes, files); err != nil {
+		utils.Logger.WithError(err).WithFields(logrus.Fields{"file_id": file.ID, "bytes": bytes, "files": files}).Error("No se pudo actualizar el uso de las cuotas")
+	}
+}
@@ -0,0 +1,319 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/t-saturn/file-server/database"
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/services/storage"
+	"github.com/t-saturn/file-server/utils"
+)
+
+// ReconcileService compara periódicamente el contenido del primario con el de
+// cada réplica (anti-entropía) y vuelve a encolar la copia de los archivos
+// faltantes o distintos.
+//
+// La comparación se hace por carpetas: cada carpeta (p.ej.
+// <project>/<YYYY>/<MM>/<DD>) se resume con la raíz de un árbol de Merkle
+// calculado sobre la ruta, el tamaño y el SHA-256 de sus archivos, de modo que
+// solo se piden los listados completos de las carpetas cuya raíz difiere.
+type ReconcileService struct {
+	Storage     storage.Storage
+	LogRepo     *database.LogRepository
+	ReplicaSvc  *ReplicaService
+	Replication *ReplicationQueue
+
+	// checksums evita recalcular el SHA-256 de archivos que no cambiaron
+	mu        sync.Mutex
+	checksums map[string]cachedChecksum
+	running   sync.Mutex
+}
+
+// cachedChecksum guarda el resumen de un archivo junto a los datos que
+// permiten detectar que cambió.
+type cachedChecksum struct {
+	size    int64
+	modTime time.Time
+	sha256  string
+}
+
+// NewReconcileService crea una instancia de ReconcileService.
+func NewReconcileService(storage storage.Storage, logRepo *database.LogRepository, replicaSvc *ReplicaService, replication *ReplicationQueue) *ReconcileService {
+	return &ReconcileService{
+		Storage:     storage,
+		LogRepo:     logRepo,
+		ReplicaSvc:  replicaSvc,
+		Replication: replication,
+		checksums:   map[string]cachedChecksum{},
+	}
+}
+
+// Start ejecuta la reconciliación periódicamente en segundo plano. Con un
+// intervalo de 0 el job queda desactivado.
+func (rs *ReconcileService) Start(interval time.Duration) {
+	if !rs.ReplicaSvc.Enabled() || interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			rs.Reconcile()
+		}
+	}()
+}
+
+// Reconcile compara el primario con cada réplica y devuelve un resumen por
+// réplica. Si ya hay una pasada en curso no se inicia otra.
+func (rs *ReconcileService) Reconcile() []models.ReconcileSummary {
+	if !rs.running.TryLock() {
+		return nil
+	}
+	defer rs.running.Unlock()
+
+	summaries := []models.ReconcileSummary{}
+	localFolders, err := rs.BuildTree("")
+	if err != nil {
+		utils.Logger.WithError(err).Error("No se pudo construir el manifiesto local")
+		_ = rs.LogRepo.LogEvent("reconcile", "", "", "", "failure", "No se pudo construir el manifiesto local: "+err.Error())
+		return summaries
+	}
+
+	for _, replicaURL := range rs.ReplicaSvc.URLs() {
+		summary := rs.reconcileReplica(replicaURL, localFolders)
+		summaries = append(summaries, summary)
+
+		fields := logrus.Fields{
+			"event": "reconcile", "replica": replicaURL,
+			"folders_checked": summary.FoldersChecked, "folders_differing": summary.FoldersDiffering,
+			"missing": summary.Missing, "mismatched": summary.Mismatched, "extra": summary.Extra, "enqueued": summary.Enqueued,
+		}
+		message := fmt.Sprintf("Carpetas revisadas: %d, con diferencias: %d, faltantes: %d, distintos: %d, sobrantes: %d, encolados: %d",
+			summary.FoldersChecked, summary.FoldersDiffering, summary.Missing, summary.Mismatched, summary.Extra, summary.Enqueued)
+		if summary.Error != "" {
+			utils.Logger.WithFields(fields).Error("Reconciliación incompleta: " + summary.Error)
+			_ = rs.LogRepo.LogEvent("reconcile", "", "", replicaURL, "failure", message+". Error: "+summary.Error)
+			continue
+		}
+		utils.Logger.WithFields(fields).Info("Reconciliación completada")
+		_ = rs.LogRepo.LogEvent("reconcile", "", "", replicaURL, "success", message)
+	}
+	return summaries
+}
+
+// reconcileReplica compara las carpetas locales con las de una réplica y
+// encola la copia de los archivos que le faltan o que difieren. Los archivos
+// que solo existen en la réplica se informan pero no se eliminan.
+func (rs *ReconcileService) reconcileReplica(replicaURL string, localFolders []models.ManifestFolder) models.ReconcileSummary {
+	summary := models.ReconcileSummary{ReplicaURL: replicaURL}
+
+	remoteFolders, err := rs.ReplicaSvc.FetchManifestTree(replicaURL)
+	if err != nil {
+		summary.Error = err.Error()
+		return summary
+	}
+	remoteRoots := map[string]string{}
+	for _, folder := range remoteFolders {
+		remoteRoots[folder.Folder] = folder.Root
+	}
+
+	for _, folder := range localFolders {
+		summary.FoldersChecked++
+		remoteRoot, exists := remoteRoots[folder.Folder]
+		delete(remoteRoots, folder.Folder)
+		if exists && remoteRoot == folder.Root {
+			continue
+		}
+		summary.FoldersDiffering++
+
+		localEntries, err := rs.FolderEntries(folder.Folder)
+		if err != nil {
+			summary.Error = err.Error()
+			return summary
+		}
+		remoteEntries := []models.ManifestEntry{}
+		if exists {
+			if remoteEntries, err = rs.ReplicaSvc.FetchManifestFolder(replicaURL, folder.Folder); err != nil {
+				summary.Error = err.Error()
+				return summary
+			}
+		}
+
+		remoteByPath := map[string]models.ManifestEntry{}
+		for _, entry := range remoteEntries {
+			remoteByPath[entry.Path] = entry
+		}
+		for _, entry := range localEntries {
+			remote, found := remoteByPath[entry.Path]
+			delete(remoteByPath, entry.Path)
+			switch {
+			case !found:
+				summary.Missing++
+			case remote.Size != entry.Size || remote.SHA256 != entry.SHA256:
+				summary.Mismatched++
+			default:
+				continue
+			}
+			enqueued, err := rs.Replication.EnqueueUpload(replicaURL, entry.Path)
+			if err != nil {
+				summary.Error = err.Error()
+				return summary
+			}
+			if enqueued {
+				summary.Enqueued++
+			}
+		}
+		summary.Extra += len(remoteByPath)
+	}
+
+	// Carpetas que solo existen en la réplica
+	for folder := range remoteRoots {
+		entries, err := rs.ReplicaSvc.FetchManifestFolder(replicaURL, folder)
+		if err != nil {
+			summary.Error = err.Error()
+			return summary
+		}
+		summary.FoldersDiffering++
+		summary.Extra += len(entries)
+	}
+	return summary
+}
+
+// BuildTree agrupa los archivos cuya ruta comienza con prefix por carpeta y
+// calcula la raíz de Merkle de cada una.
+func (rs *ReconcileService) BuildTree(prefix string) ([]models.ManifestFolder, error) {
+	entries, err := rs.manifest(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	byFolder := map[string][]models.ManifestEntry{}
+	for _, entry := range entries {
+		folder := path.Dir(entry.Path)
+		byFolder[folder] = append(byFolder[folder], entry)
+	}
+
+	folders := make([]models.ManifestFolder, 0, len(byFolder))
+	for folder, folderEntries := range byFolder {
+		folders = append(folders, models.ManifestFolder{Folder: folder, Root: merkleRoot(folderEntries), Files: len(folderEntries)})
+	}
+	sort.Slice(folders, func(i, j int) bool { return folders[i].Folder < folders[j].Folder })
+	return folders, nil
+}
+
+// FolderEntries devuelve los archivos guardados directamente en una carpeta.
+func (rs *ReconcileService) FolderEntries(folder string) ([]models.ManifestEntry, error) {
+	entries, err := rs.manifest(folder + "/")
+	if err != nil {
+		return nil, err
+	}
+	direct := []models.ManifestEntry{}
+	for _, entry := range entries {
+		if path.Dir(entry.Path) == folder {
+			direct = append(direct, entry)
+		}
+	}
+	return direct, nil
+}
+
+// manifest lista los archivos con su tamaño y SHA-256, ordenados por ruta.
+func (rs *ReconcileService) manifest(prefix string) ([]models.ManifestEntry, error) {
+	files, err := rs.Storage.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]models.ManifestEntry, 0, len(files))
+	for _, file := range files {
+		sum, err := rs.checksum(file)
+		if err != nil {
+			// Un archivo eliminado durante el recorrido simplemente se omite
+			if errors.Is(err, storage.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		entries = append(entries, models.ManifestEntry{Path: file.Path, Size: file.Size, SHA256: sum})
+	}
+
+	// En un recorrido completo se descartan del caché los archivos que ya no existen
+	if prefix == "" {
+		seen := make(map[string]bool, len(entries))
+		for _, entry := range entries {
+			seen[entry.Path] = true
+		}
+		rs.mu.Lock()
+		for cachedPath := range rs.checksums {
+			if !seen[cachedPath] {
+				delete(rs.checksums, cachedPath)
+			}
+		}
+		rs.mu.Unlock()
+	}
+	return entries, nil
+}
+
+// checksum devuelve el SHA-256 de un archivo, reutilizando el último cálculo
+// si el tamaño y la fecha de modificación no cambiaron.
+func (rs *ReconcileService) checksum(file storage.FileInfo) (string, error) {
+	rs.mu.Lock()
+	cached, found := rs.checksums[file.Path]
+	rs.mu.Unlock()
+	if found && cached.size == file.Size && cached.modTime.Equal(file.ModTime) {
+		return cached.sha256, nil
+	}
+
+	content, err := rs.Storage.Open(file.Path)
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	rs.mu.Lock()
+	rs.checksums[file.Path] = cachedChecksum{size: file.Size, modTime: file.ModTime, sha256: sum}
+	rs.mu.Unlock()
+	return sum, nil
+}
+
+// merkleRoot calcula la raíz del árbol de Merkle de una carpeta. Cada hoja es
+// el SHA-256 de "ruta, tamaño, resumen"; cada nodo, el de sus dos hijos (un
+// nodo sin pareja sube sin cambios). Las entradas deben venir ordenadas.
+func merkleRoot(entries []models.ManifestEntry) string {
+	level := make([][]byte, 0, len(entries))
+	for _, entry := range entries {
+		leaf := sha256.Sum256([]byte(entry.Path + "\x00" + strconv.FormatInt(entry.Size, 10) + "\x00" + entry.SHA256))
+		level = append(level, leaf[:])
+	}
+	if len(level) == 0 {
+		return ""
+	}
+
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			node := sha256.Sum256(append(append([]byte{}, level[i]...), level[i+1]...))
+			next = append(next, node[:])
+		}
+		level = next
+	}
+	return hex.EncodeToString(level[0])
+}
@@ -2,71 +2,207 @@ package services
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/url"
+	"path"
+	"sync"
 	"time"
+
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/services/storage"
+	"github.com/t-saturn/file-server/utils"
 )
 
-// ReplicaService maneja la comunicación con el servidor de réplica.
+// ReplicaNode describe el estado de salud de un servidor de réplica.
+type ReplicaNode struct {
+	URL                 string     `json:"url"`
+	Healthy             bool       `json:"healthy"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastCheckedAt       *time.Time `json:"last_checked_at,omitempty"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+}
+
+// ReplicaService maneja la comunicación con el conjunto de servidores de réplica.
 type ReplicaService struct {
-	ReplicaURL       string
 	ReplicaAuthToken string
+	replicas         []*ReplicaNode
+	mu               sync.RWMutex
 	httpClient       *http.Client
 }
 
 // NewReplicaService crea una instancia de ReplicaService.
-func NewReplicaService(replicaURL string, replicaAuthToken string) *ReplicaService {
+// Todas las réplicas se consideran sanas hasta que una operación o un chequeo falle.
+func NewReplicaService(replicaURLs []string, replicaAuthToken string) *ReplicaService {
+	replicas := make([]*ReplicaNode, 0, len(replicaURLs))
+	for _, replicaURL := range replicaURLs {
+		replicas = append(replicas, &ReplicaNode{URL: replicaURL, Healthy: true})
+	}
 	return &ReplicaService{
-		ReplicaURL:       replicaURL,
 		ReplicaAuthToken: replicaAuthToken,
+		replicas:         replicas,
+		// Sin Timeout global: la transferencia de archivos grandes puede durar
+		// más de 30 segundos. Se limita en cambio la espera de la respuesta.
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
 			Transport: &http.Transport{
-				MaxIdleConns:        10,
-				MaxIdleConnsPerHost: 2,
-				IdleConnTimeout:     90 * time.Second,
-				DisableKeepAlives:   false,
+				MaxIdleConns:          10,
+				MaxIdleConnsPerHost:   2,
+				IdleConnTimeout:       90 * time.Second,
+				ResponseHeaderTimeout: 30 * time.Second,
+				DisableKeepAlives:     false,
 			},
 		},
 	}
 }
 
-// ReplicateFile envía un archivo al servidor de réplica.
-func (rs *ReplicaService) ReplicateFile(project, filename string, data io.Reader) error {
-	if rs.ReplicaURL == "" {
-		return nil // No hay servidor de réplica configurado
+// Enabled indica si hay al menos un servidor de réplica configurado.
+func (rs *ReplicaService) Enabled() bool {
+	return len(rs.replicas) > 0
+}
+
+// URLs devuelve las URLs de todas las réplicas configuradas.
+func (rs *ReplicaService) URLs() []string {
+	urls := make([]string, 0, len(rs.replicas))
+	for _, replica := range rs.replicas {
+		urls = append(urls, replica.URL)
+	}
+	return urls
+}
+
+// IsHealthy indica si la última operación o chequeo con la réplica fue exitoso.
+func (rs *ReplicaService) IsHealthy(replicaURL string) bool {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	for _, replica := range rs.replicas {
+		if replica.URL == replicaURL {
+			return replica.Healthy
+		}
+	}
+	return false
+}
+
+// Status devuelve una copia del estado de salud de cada réplica.
+func (rs *ReplicaService) Status() []ReplicaNode {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	status := make([]ReplicaNode, 0, len(rs.replicas))
+	for _, replica := range rs.replicas {
+		status = append(status, *replica)
+	}
+	return status
+}
+
+// MarkResult actualiza el estado de salud de la réplica según el resultado de una operación.
+func (rs *ReplicaService) MarkResult(replicaURL string, err error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	now := time.Now()
+	for _, replica := range rs.replicas {
+		if replica.URL != replicaURL {
+			continue
+		}
+		replica.LastCheckedAt = &now
+		if err != nil {
+			if replica.Healthy {
+				utils.Logger.WithError(err).WithField("replica", replicaURL).Warn("Réplica marcada como no disponible")
+			}
+			replica.Healthy = false
+			replica.ConsecutiveFailures++
+			replica.LastError = err.Error()
+			return
+		}
+		if !replica.Healthy {
+			utils.Logger.WithField("replica", replicaURL).Info("Réplica disponible nuevamente")
+		}
+		replica.Healthy = true
+		replica.ConsecutiveFailures = 0
+		replica.LastError = ""
+		replica.LastSuccessAt = &now
+		return
+	}
+}
+
+// CheckHealth consulta el endpoint interno de salud de cada réplica.
+func (rs *ReplicaService) CheckHealth() {
+	for _, replicaURL := range rs.URLs() {
+		rs.MarkResult(replicaURL, rs.ping(replicaURL))
+	}
+}
+
+// StartHealthChecks ejecuta CheckHealth periódicamente en segundo plano.
+func (rs *ReplicaService) StartHealthChecks(interval time.Duration) {
+	if !rs.Enabled() {
+		return
 	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			rs.CheckHealth()
+		}
+	}()
+}
 
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-	part, err := writer.CreateFormFile("file", filename)
+// ping verifica que la réplica responde y acepta el token de replicación.
+func (rs *ReplicaService) ping(replicaURL string) error {
+	req, err := http.NewRequest("GET", replicaURL+"/internal/health", nil)
 	if err != nil {
 		return err
 	}
+	rs.authorize(req)
 
-	if _, err := io.Copy(part, data); err != nil {
+	resp, err := rs.httpClient.Do(req)
+	if err != nil {
 		return err
 	}
-	writer.Close()
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("el chequeo de salud falló con el código de estado: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ReplicateFile envía un archivo a una réplica, que lo guarda en la misma ruta
+// relativa que tiene en el primario.
+// El cuerpo multipart se genera al vuelo mediante un io.Pipe, de modo que el
+// archivo nunca se carga completo en memoria sin importar su tamaño.
+func (rs *ReplicaService) ReplicateFile(replicaURL, project, relativePath string, data io.Reader) error {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
 
-	// Corregir la URL - usar parámetro de path en lugar de query
-	url := fmt.Sprintf("%s/internal/upload/%s", rs.ReplicaURL, url.PathEscape(project))
-	req, err := http.NewRequest("POST", url, body)
+	// Escribir el multipart en una goroutine mientras el cliente HTTP lo consume
+	go func() {
+		part, err := writer.CreateFormFile("file", path.Base(relativePath))
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(part, data); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(writer.Close())
+	}()
+
+	// La ruta canónica viaja en la query para conocerla antes de leer el archivo
+	url := fmt.Sprintf("%s/internal/upload/%s?path=%s", replicaURL, url.PathEscape(project), url.QueryEscape(relativePath))
+	req, err := http.NewRequest("POST", url, pr)
 	if err != nil {
+		pr.CloseWithError(err)
 		return err
 	}
 
 	req.Header.Set("Content-Type", writer.FormDataContentType())
-	if rs.ReplicaAuthToken != "" {
-		req.Header.Set("Authorization", "Bearer "+rs.ReplicaAuthToken)
-	}
+	rs.authorize(req)
 
 	// Usar el cliente HTTP compartido
 	resp, err := rs.httpClient.Do(req)
 	if err != nil {
+		pr.CloseWithError(err)
 		return err
 	}
 	defer resp.Body.Close()
@@ -79,21 +215,112 @@ func (rs *ReplicaService) ReplicateFile(project, filename string, data io.Reader
 	return nil
 }
 
-// DeleteFile envía una solicitud de eliminación de archivo al servidor de réplica.
-func (rs *ReplicaService) DeleteFile(fileURL string) error {
-	if rs.ReplicaURL == "" {
-		return nil // No hay servidor de réplica configurado
+// ReadFile lee de una réplica el contenido guardado en relativePath. Si
+// rangeHeader no está vacío se reenvía, y la réplica responde 206 con el rango.
+// El llamador debe cerrar el cuerpo de la respuesta.
+func (rs *ReplicaService) ReadFile(replicaURL, relativePath, rangeHeader string) (*http.Response, error) {
+	url := fmt.Sprintf("%s/internal/read?path=%s", replicaURL, url.QueryEscape(relativePath))
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+	rs.authorize(req)
+
+	resp, err := rs.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		return resp, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %w", relativePath, storage.ErrNotExist)
+	default:
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("la lectura de la réplica falló con el código de estado: %d, cuerpo de respuesta: %s", resp.StatusCode, string(respBody))
+	}
+}
+
+// FetchManifestTree obtiene de una réplica las raíces de Merkle de cada carpeta.
+func (rs *ReplicaService) FetchManifestTree(replicaURL string) ([]models.ManifestFolder, error) {
+	var response struct {
+		Folders []models.ManifestFolder `json:"folders"`
+	}
+	if err := rs.getJSON(replicaURL+"/internal/manifest", &response); err != nil {
+		return nil, err
+	}
+	return response.Folders, nil
+}
+
+// FetchManifestFolder obtiene de una réplica los archivos de una carpeta con su tamaño y resumen.
+func (rs *ReplicaService) FetchManifestFolder(replicaURL, folder string) ([]models.ManifestEntry, error) {
+	var response struct {
+		Entries []models.ManifestEntry `json:"entries"`
 	}
+	if err := rs.getJSON(replicaURL+"/internal/manifest/folder?folder="+url.QueryEscape(folder), &response); err != nil {
+		return nil, err
+	}
+	return response.Entries, nil
+}
 
-	// Escapar la URL del archivo para evitar problemas con caracteres especiales
-	url := fmt.Sprintf("%s/internal/delete/%s", rs.ReplicaURL, url.PathEscape(fileURL))
+// DeleteFileRecord solicita a una réplica eliminar definitivamente el
+// registro de un archivo purgado en el primario.
+func (rs *ReplicaService) DeleteFileRecord(replicaURL, fileID string) error {
+	url := fmt.Sprintf("%s/internal/files/%s", replicaURL, url.PathEscape(fileID))
 	req, err := http.NewRequest("DELETE", url, nil)
 	if err != nil {
 		return err
 	}
-	if rs.ReplicaAuthToken != "" {
-		req.Header.Set("Authorization", "Bearer "+rs.ReplicaAuthToken)
+	rs.authorize(req)
+
+	resp, err := rs.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("la eliminación del registro en la réplica falló con el código de estado: %d, cuerpo de respuesta: %s", resp.StatusCode, string(respBody))
+	}
+
+	return nil
+}
+
+// getJSON realiza un GET autenticado y decodifica la respuesta JSON.
+func (rs *ReplicaService) getJSON(endpoint string, target interface{}) error {
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	rs.authorize(req)
+
+	resp, err := rs.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("la consulta a la réplica falló con el código de estado: %d, cuerpo de respuesta: %s", resp.StatusCode, string(respBody))
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+// DeleteFile solicita a una réplica eliminar el contenido guardado en relativePath.
+func (rs *ReplicaService) DeleteFile(replicaURL, relativePath string) error {
+	url := fmt.Sprintf("%s/internal/delete?path=%s", replicaURL, url.QueryEscape(relativePath))
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return err
 	}
+	rs.authorize(req)
 
 	// Usar el cliente HTTP compartido
 	resp, err := rs.httpClient.Do(req)
@@ -108,4 +335,40 @@ func (rs *ReplicaService) DeleteFile(fileURL string) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// SyncFileRecord envía a una réplica el registro del archivo (con el mismo ID)
+// y sus permisos. Un registro con deleted_at propaga también el borrado lógico.
+func (rs *ReplicaService) SyncFileRecord(replicaURL string, replicated *models.ReplicatedFile) error {
+	body, err := json.Marshal(replicated)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/internal/files/%s", replicaURL, url.PathEscape(replicated.File.ID))
+	req, err := http.NewRequest("PUT", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rs.authorize(req)
+
+	resp, err := rs.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("la sincronización del registro falló con el código de estado: %d, cuerpo de respuesta: %s", resp.StatusCode, string(respBody))
+	}
+
+	return nil
+}
+
+func (rs *ReplicaService) authorize(req *http.Request) {
+	if rs.ReplicaAuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+rs.ReplicaAuthToken)
+	}
+}
@@ -0,0 +1,341 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/t-saturn/file-server/database"
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/services/storage"
+	"github.com/t-saturn/file-server/utils"
+	"gorm.io/gorm"
+)
+
+// ErrReplicationQuorum indica que menos de WriteQuorum réplicas confirmaron la operación.
+var ErrReplicationQuorum = errors.New("no se alcanzó el quórum de escritura en las réplicas")
+
+// replicationLease es el tiempo durante el que una operación en curso queda
+// reservada; si el proceso se detiene a mitad de un intento, el worker la
+// retoma al vencer este plazo.
+const replicationLease = 30 * time.Minute
+
+// ReplicationQueue implementa una cola persistente (outbox) de operaciones de
+// replicación. Cada operación se guarda en Postgres, una por réplica, antes de
+// intentarse, y un worker en segundo plano reintenta las fallidas con backoff
+// exponencial hasta que la réplica vuelve a estar disponible.
+//
+// WriteQuorum es la cantidad de réplicas que deben confirmar una operación
+// para considerarla exitosa; con 0 la replicación es completamente asíncrona:
+// las operaciones se registran en la cola y se intentan en segundo plano sin
+// que la subida o la eliminación esperen a ninguna réplica.
+type ReplicationQueue struct {
+	LogRepo     *database.LogRepository
+	Storage     storage.Storage
+	ReplicaSvc  *ReplicaService
+	WriteQuorum int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// NewReplicationQueue crea una instancia de ReplicationQueue.
+func NewReplicationQueue(logRepo *database.LogRepository, storage storage.Storage, replicaSvc *ReplicaService, writeQuorum int, baseBackoff, maxBackoff time.Duration) *ReplicationQueue {
+	if replicas := len(replicaSvc.URLs()); writeQuorum > replicas {
+		utils.Logger.Warnf("El quórum de escritura (%d) supera la cantidad de réplicas (%d); se usará %d", writeQuorum, replicas, replicas)
+		writeQuorum = replicas
+	}
+	return &ReplicationQueue{
+		LogRepo:     logRepo,
+		Storage:     storage,
+		ReplicaSvc:  replicaSvc,
+		WriteQuorum: writeQuorum,
+		BaseBackoff: baseBackoff,
+		MaxBackoff:  maxBackoff,
+	}
+}
+
+// ReplicateUpload copia un archivo en todas las réplicas. Devuelve
+// ErrReplicationQuorum si menos de WriteQuorum réplicas confirmaron la copia;
+// las réplicas pendientes siguen reintentándose en segundo plano.
+func (rq *ReplicationQueue) ReplicateUpload(project, relativePath string) error {
+	acked := rq.fanOut("upload", project, relativePath)
+	if len(acked) < rq.WriteQuorum {
+		return fmt.Errorf("%w: %d de %d", ErrReplicationQuorum, len(acked), rq.WriteQuorum)
+	}
+	return nil
+}
+
+// ReplicateDelete elimina un archivo de todas las réplicas. Las copias aún
+// pendientes de la misma ruta se descartan para que un reintento tardío no
+// vuelva a crear el archivo. Si no se alcanza el quórum, la eliminación se
+// revierte: se descartan los borrados pendientes y se vuelve a copiar el
+// archivo en las réplicas que ya lo habían eliminado.
+func (rq *ReplicationQueue) ReplicateDelete(relativePath string) error {
+	if !rq.ReplicaSvc.Enabled() {
+		return nil
+	}
+	rq.discardPending("upload", relativePath)
+
+	acked := rq.fanOut("delete", ProjectFromPath(relativePath), relativePath)
+	if len(acked) >= rq.WriteQuorum {
+		return nil
+	}
+
+	rq.discardPending("delete", relativePath)
+	for _, replicaURL := range acked {
+		if _, err := database.InsertReplicationTask(rq.LogRepo.DB, replicaURL, "upload", ProjectFromPath(relativePath), relativePath, "", time.Now()); err != nil {
+			utils.Logger.WithError(err).WithField("replica", replicaURL).Error("No se pudo programar la restauración de la réplica")
+		}
+	}
+	return fmt.Errorf("%w: %d de %d", ErrReplicationQuorum, len(acked), rq.WriteQuorum)
+}
+
+// EnqueueUpload programa la copia de un archivo en una réplica concreta para
+// que la realice el worker. Si ya hay una copia pendiente no se duplica.
+func (rq *ReplicationQueue) EnqueueUpload(replicaURL, relativePath string) (bool, error) {
+	pending, err := database.HasPendingReplicationTask(rq.LogRepo.DB, replicaURL, "upload", relativePath)
+	if err != nil || pending {
+		return false, err
+	}
+	if _, err := database.InsertReplicationTask(rq.LogRepo.DB, replicaURL, "upload", ProjectFromPath(relativePath), relativePath, "", time.Now()); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DiscardUpload deshace una copia que no alcanzó el quórum, sin exigir quórum
+// para la eliminación.
+func (rq *ReplicationQueue) DiscardUpload(relativePath string) {
+	if !rq.ReplicaSvc.Enabled() {
+		return
+	}
+	rq.discardPending("upload", relativePath)
+	go rq.fanOut("delete", ProjectFromPath(relativePath), relativePath)
+}
+
+// ReplicateRecord propaga a las réplicas el estado actual del registro de un
+// archivo (metadatos, permisos y borrado lógico). No exige quórum: el registro
+// ya está confirmado en el primario y la cola garantiza que llegue a todas.
+func (rq *ReplicationQueue) ReplicateRecord(file *models.File) {
+	if !rq.ReplicaSvc.Enabled() {
+		return
+	}
+	tasks := rq.persist("record", FileProject(file), file.URL, file.ID)
+	go func() {
+		for _, task := range tasks {
+			if !rq.ReplicaSvc.IsHealthy(task.ReplicaURL) && task.ID != 0 {
+				rq.deferTask(task, errors.New("réplica no disponible"))
+				continue
+			}
+			rq.attempt(task)
+		}
+	}()
+}
+
+// Stats devuelve la profundidad de la cola.
+func (rq *ReplicationQueue) Stats() (*models.ReplicationQueueStats, error) {
+	return database.GetReplicationQueueStats(rq.LogRepo.DB)
+}
+
+// Start ejecuta el worker de reintentos en segundo plano.
+func (rq *ReplicationQueue) Start(interval time.Duration) {
+	if !rq.ReplicaSvc.Enabled() {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			rq.processDue()
+		}
+	}()
+}
+
+// persist registra una operación por réplica, reservada durante
+// replicationLease para que el worker no la tome mientras se intenta.
+func (rq *ReplicationQueue) persist(operation, project, relativePath, fileID string) []*models.ReplicationTask {
+	tasks := []*models.ReplicationTask{}
+	for _, replicaURL := range rq.ReplicaSvc.URLs() {
+		task, err := database.InsertReplicationTask(rq.LogRepo.DB, replicaURL, operation, project, relativePath, fileID, time.Now().Add(replicationLease))
+		if err != nil {
+			// Sin registro persistente solo queda el intento directo
+			utils.Logger.WithError(err).Error("No se pudo registrar la operación de replicación")
+			task = &models.ReplicationTask{ReplicaURL: replicaURL, Operation: operation, Project: project, Path: relativePath, FileID: fileID}
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+// fanOut persiste una operación por réplica y las intenta en paralelo. Vuelve
+// en cuanto WriteQuorum réplicas confirmaron o todas respondieron, y devuelve
+// las réplicas que confirmaron hasta ese momento. Con WriteQuorum 0 vuelve
+// apenas las operaciones quedan registradas, sin esperar ningún intento. Las
+// réplicas marcadas como no disponibles no se intentan de inmediato: quedan
+// para el worker.
+func (rq *ReplicationQueue) fanOut(operation, project, relativePath string) []string {
+	if !rq.ReplicaSvc.Enabled() {
+		return nil
+	}
+
+	type result struct {
+		replicaURL string
+		ok         bool
+	}
+	tasks := rq.persist(operation, project, relativePath, "")
+	results := make(chan result, len(tasks))
+	started := 0
+
+	for _, task := range tasks {
+		if !rq.ReplicaSvc.IsHealthy(task.ReplicaURL) && task.ID != 0 {
+			rq.deferTask(task, errors.New("réplica no disponible"))
+			continue
+		}
+
+		started++
+		go func(task *models.ReplicationTask) {
+			results <- result{replicaURL: task.ReplicaURL, ok: rq.attempt(task)}
+		}(task)
+	}
+
+	// Replicación asíncrona: los intentos siguen en segundo plano
+	if rq.WriteQuorum == 0 {
+		return nil
+	}
+
+	acked := []string{}
+	for i := 0; i < started; i++ {
+		res := <-results
+		if res.ok {
+			acked = append(acked, res.replicaURL)
+		}
+		if len(acked) >= rq.WriteQuorum {
+			break
+		}
+	}
+	return acked
+}
+
+// processDue reintenta las operaciones cuyo plazo de espera ya venció.
+func (rq *ReplicationQueue) processDue() {
+	tasks, err := database.GetDueReplicationTasks(rq.LogRepo.DB, time.Now(), 50)
+	if err != nil {
+		utils.Logger.WithError(err).Error("Error obteniendo la cola de replicación")
+		return
+	}
+	for _, task := range tasks {
+		now := time.Now()
+		claimed, err := database.ClaimReplicationTask(rq.LogRepo.DB, task.ID, now, now.Add(replicationLease))
+		if err != nil || !claimed {
+			continue
+		}
+		rq.attempt(task)
+	}
+}
+
+// attempt ejecuta una operación, actualiza su registro y el estado de salud de
+// la réplica según el resultado. Devuelve true si la réplica la confirmó.
+func (rq *ReplicationQueue) attempt(task *models.ReplicationTask) bool {
+	err := rq.execute(task)
+	rq.ReplicaSvc.MarkResult(task.ReplicaURL, err)
+	fields := logrus.Fields{"event": "replication", "replica": task.ReplicaURL, "operation": task.Operation, "path": task.Path, "attempts": task.Attempts + 1}
+
+	if err == nil {
+		if task.ID != 0 {
+			if err := database.DeleteReplicationTask(rq.LogRepo.DB, task.ID); err != nil {
+				utils.Logger.WithError(err).WithFields(fields).Error("No se pudo cerrar la operación de replicación")
+			}
+		}
+		if task.Attempts > 0 {
+			utils.Logger.WithFields(fields).Info("Replicación recuperada")
+			_ = rq.LogRepo.LogEvent("replication", task.Project, task.Path, task.ReplicaURL, "success", "Replicación recuperada tras reintentos")
+		}
+		return true
+	}
+
+	utils.Logger.WithError(err).WithFields(fields).Warn("Error de replicación, se reintentará")
+	rq.deferTask(task, err)
+	return false
+}
+
+// deferTask registra un intento fallido y programa el siguiente con backoff.
+func (rq *ReplicationQueue) deferTask(task *models.ReplicationTask, cause error) {
+	task.Attempts++
+	if task.Attempts == 1 {
+		_ = rq.LogRepo.LogEvent("replication", task.Project, task.Path, task.ReplicaURL, "failure", task.Operation+": "+cause.Error())
+	}
+	if task.ID == 0 {
+		return
+	}
+	next := time.Now().Add(rq.backoff(task.Attempts))
+	if err := database.RecordReplicationFailure(rq.LogRepo.DB, task.ID, task.Attempts, cause.Error(), next); err != nil {
+		utils.Logger.WithError(err).WithField("path", task.Path).Error("No se pudo registrar el intento de replicación")
+	}
+}
+
+// discardPending elimina de la cola las operaciones pendientes de una ruta.
+func (rq *ReplicationQueue) discardPending(operation, relativePath string) {
+	if err := database.DeleteReplicationTasksByPath(rq.LogRepo.DB, operation, relativePath); err != nil {
+		utils.Logger.WithError(err).Warn("No se pudieron descartar las operaciones pendientes de " + relativePath)
+	}
+}
+
+// execute envía la operación a la réplica indicada en la tarea.
+func (rq *ReplicationQueue) execute(task *models.ReplicationTask) error {
+	switch task.Operation {
+	case "delete":
+		return rq.ReplicaSvc.DeleteFile(task.ReplicaURL, task.Path)
+	case "record":
+		// Se envía el estado actual del registro, no el del momento en que se encoló
+		file, err := database.GetFileRecordIncludingDeleted(rq.LogRepo.DB, task.FileID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// El archivo fue purgado: la réplica también elimina su registro
+			return rq.ReplicaSvc.DeleteFileRecord(task.ReplicaURL, task.FileID)
+		}
+		if err != nil {
+			return err
+		}
+		permissions, err := database.GetFilePermissions(rq.LogRepo.DB, file.ID)
+		if err != nil {
+			return err
+		}
+		versions, err := database.GetFileVersions(rq.LogRepo.DB, file.ID)
+		if err != nil {
+			return err
+		}
+		replicated := &models.ReplicatedFile{File: *file, Permissions: []models.FilePermission{}, Versions: []models.FileVersion{}}
+		for _, permission := range permissions {
+			replicated.Permissions = append(replicated.Permissions, *permission)
+		}
+		for _, version := range versions {
+			replicated.Versions = append(replicated.Versions, *version)
+		}
+		return rq.ReplicaSvc.SyncFileRecord(task.ReplicaURL, replicated)
+	default:
+		// La copia se lee siempre desde el almacenamiento, no desde la petición original
+		stored, err := rq.Storage.Open(task.Path)
+		if errors.Is(err, storage.ErrNotExist) {
+			// El archivo ya no existe localmente: no hay nada que replicar
+			utils.Logger.WithField("path", task.Path).Warn("Se descarta la replicación de un archivo inexistente")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer stored.Close()
+		return rq.ReplicaSvc.ReplicateFile(task.ReplicaURL, task.Project, task.Path, stored)
+	}
+}
+
+// backoff calcula la espera exponencial para el intento n, con un máximo de MaxBackoff.
+func (rq *ReplicationQueue) backoff(attempts int) time.Duration {
+	wait := rq.BaseBackoff
+	for i := 1; i < attempts && wait < rq.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > rq.MaxBackoff {
+		wait = rq.MaxBackoff
+	}
+	return wait
+}
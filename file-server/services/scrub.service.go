@@ -0,0 +1,239 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/t-saturn/file-server/database"
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/services/storage"
+	"github.com/t-saturn/file-server/utils"
+)
+
+// ScrubService verifica periódicamente que el contenido guardado de cada
+// archivo siga coincidiendo con el SHA-256 registrado al subirlo.
+type ScrubService struct {
+	FileSvc *FileService
+	// RateLimit limita los bytes leídos por segundo (0 sin límite) para no
+	// competir con las descargas de los usuarios.
+	RateLimit int64
+	// SelfHeal repara desde las réplicas los archivos dañados o faltantes.
+	SelfHeal bool
+	running  sync.Mutex
+}
+
+// NewScrubService crea una instancia de ScrubService.
+func NewScrubService(fileSvc *FileService, rateLimit int64, selfHeal bool) *ScrubService {
+	return &ScrubService{FileSvc: fileSvc, RateLimit: rateLimit, SelfHeal: selfHeal}
+}
+
+// Start ejecuta Scrub periódicamente en segundo plano (interval <= 0 lo desactiva).
+func (ss *ScrubService) Start(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			ss.Scrub()
+		}
+	}()
+}
+
+// Scrub recorre los archivos no eliminados, vuelve a calcular el SHA-256 de su
+// contenido y guarda el resultado en File.Status. Los archivos dañados o
+// faltantes se registran en el log de eventos y, con SelfHeal, se reparan
+// desde una réplica. Si ya hay una pasada en curso no se inicia otra.
+func (ss *ScrubService) Scrub() *models.ScrubSummary {
+	if !ss.running.TryLock() {
+		return nil
+	}
+	defer ss.running.Unlock()
+
+	const batchSize = 100
+	db := ss.FileSvc.LogRepo.DB
+	summary := &models.ScrubSummary{StartedAt: time.Now()}
+	limiter := newRateLimiter(ss.RateLimit)
+
+	for afterID := firstUUID; ; {
+		files, err := database.GetFilesForScrub(db, afterID, batchSize)
+		if err != nil {
+			utils.Logger.WithError(err).Error("Error obteniendo archivos para verificar")
+			_ = ss.FileSvc.LogRepo.LogEvent("scrub", "", "", "", "failure", "Error obteniendo archivos para verificar: "+err.Error())
+			break
+		}
+		for _, file := range files {
+			afterID = file.ID
+			ss.scrubFile(file, limiter, summary)
+		}
+		if len(files) < batchSize {
+			break
+		}
+	}
+
+	summary.FinishedAt = time.Now()
+	utils.Logger.WithFields(logrus.Fields{
+		"event": "scrub", "checked": summary.Checked, "corrupt": summary.Corrupt,
+		"missing": summary.Missing, "repaired": summary.Repaired, "skipped": summary.Skipped,
+	}).Info("Verificación de integridad finalizada")
+	_ = ss.FileSvc.LogRepo.LogEvent("scrub", "", "", "", "success", fmt.Sprintf(
+		"Verificados %d archivos: %d dañados, %d faltantes, %d reparados, %d sin checksum",
+		summary.Checked, summary.Corrupt, summary.Missing, summary.Repaired, summary.Skipped,
+	))
+	return summary
+}
+
+// scrubFile verifica un archivo y actualiza su estado y el resumen.
+func (ss *ScrubService) scrubFile(file *models.File, limiter *rateLimiter, summary *models.ScrubSummary) {
+	// Sin checksum registrado no hay con qué comparar (ver go run main.go -backfill)
+	if file.Checksum == "" {
+		summary.Skipped++
+		return
+	}
+	summary.Checked++
+
+	status, err := ss.verify(file, limiter)
+	if err != nil {
+		// Error de lectura distinto de la ausencia del archivo: no se cambia el estado
+		utils.Logger.WithError(err).WithField("file_id", file.ID).Error("No se pudo verificar el archivo")
+		return
+	}
+
+	if status != models.FileStatusOK {
+		if status == models.FileStatusCorrupt {
+			summary.Corrupt++
+		} else {
+			summary.Missing++
+		}
+		msg := "Contenido dañado: el SHA-256 no coincide"
+		if status == models.FileStatusMissing {
+			msg = "Contenido no encontrado en el almacenamiento"
+		}
+		utils.Logger.WithFields(logrus.Fields{"event": "scrub", "file_id": file.ID, "path": file.URL, "status": status}).Error(msg)
+		_ = ss.FileSvc.LogRepo.LogEvent("scrub", file.Project, file.URL, "", "failure", msg+" (file id: "+file.ID+")")
+
+		if ss.SelfHeal && ss.FileSvc.ReplicaSvc.Enabled() {
+			if err := ss.heal(file); err != nil {
+				utils.Logger.WithError(err).WithField("file_id", file.ID).Error("No se pudo reparar el archivo desde la réplica")
+				_ = ss.FileSvc.LogRepo.LogEvent("repair", file.Project, file.URL, "", "failure", err.Error())
+			} else {
+				summary.Repaired++
+				status = models.FileStatusOK
+				utils.Logger.WithFields(logrus.Fields{"event": "repair", "file_id": file.ID, "path": file.URL}).Info("Archivo reparado desde la réplica")
+				_ = ss.FileSvc.LogRepo.LogEvent("repair", file.Project, file.URL, "", "success", "Archivo reparado desde la réplica tras la verificación")
+			}
+		}
+	}
+
+	if err := database.UpdateFileIntegrity(ss.FileSvc.LogRepo.DB, file.ID, status, time.Now()); err != nil {
+		utils.Logger.WithError(err).WithField("file_id", file.ID).Error("No se pudo guardar el estado de integridad")
+	}
+}
+
+// verify vuelve a calcular el SHA-256 del contenido respetando el límite de lectura.
+func (ss *ScrubService) verify(file *models.File, limiter *rateLimiter) (string, error) {
+	blob, err := ss.FileSvc.Storage.Open(file.URL)
+	if errors.Is(err, storage.ErrNotExist) {
+		return models.FileStatusMissing, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer blob.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, limiter.Reader(blob)); err != nil {
+		return "", err
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != file.Checksum {
+		return models.FileStatusCorrupt, nil
+	}
+	return models.FileStatusOK, nil
+}
+
+// heal reemplaza el contenido local con la copia de una réplica, verificando
+// el checksum mientras se escribe para no guardar otra copia dañada.
+func (ss *ScrubService) heal(file *models.File) error {
+	resp, replicaURL, err := ss.FileSvc.ReadFromReplica(file.URL, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	hash := sha256.New()
+	reader := &checksumReader{Reader: io.TeeReader(resp.Body, hash), hash: hash, expected: file.Checksum}
+	if err := ss.FileSvc.Storage.Put(file.URL, reader); err != nil {
+		return fmt.Errorf("réplica %s: %w", replicaURL, err)
+	}
+	return nil
+}
+
+// checksumReader compara el SHA-256 acumulado al llegar al final del
+// contenido; si no coincide devuelve un error en lugar de io.EOF para que el
+// almacenamiento descarte la escritura.
+type checksumReader struct {
+	io.Reader
+	hash     hash.Hash
+	expected string
+}
+
+func (cr *checksumReader) Read(p []byte) (int, error) {
+	n, err := cr.Reader.Read(p)
+	if err == io.EOF {
+		if digest := hex.EncodeToString(cr.hash.Sum(nil)); digest != cr.expected {
+			return n, fmt.Errorf("la copia de la réplica tampoco coincide con el checksum (sha256 %s)", digest)
+		}
+	}
+	return n, err
+}
+
+// rateLimiter reparte las lecturas de una pasada para no superar bytesPerSecond.
+type rateLimiter struct {
+	bytesPerSecond int64
+	start          time.Time
+	read           int64
+}
+
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	return &rateLimiter{bytesPerSecond: bytesPerSecond, start: time.Now()}
+}
+
+// Reader envuelve r para que cada lectura espere lo necesario según el límite.
+func (rl *rateLimiter) Reader(r io.Reader) io.Reader {
+	if rl.bytesPerSecond <= 0 {
+		return r
+	}
+	return &limitedReader{reader: r, limiter: rl}
+}
+
+// wait registra n bytes leídos y duerme si la pasada va más rápido que el límite.
+func (rl *rateLimiter) wait(n int) {
+	rl.read += int64(n)
+	expected := time.Duration(float64(rl.read) / float64(rl.bytesPerSecond) * float64(time.Second))
+	if delay := expected - time.Since(rl.start); delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+type limitedReader struct {
+	reader  io.Reader
+	limiter *rateLimiter
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	// Leer como mucho un segundo de cuota para que las esperas sean cortas
+	if quota := lr.limiter.bytesPerSecond; int64(len(p)) > quota {
+		p = p[:quota]
+	}
+	n, err := lr.reader.Read(p)
+	lr.limiter.wait(n)
+	return n, err
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/t-saturn/file-server/database"
+	"github.com/t-saturn/file-server/models"
+)
+
+// ErrInvalidCursor indica que el cursor no es válido o no corresponde al orden pedido.
+var ErrInvalidCursor = errors.New("cursor inválido")
+
+// FilePage es una página del listado de archivos. NextCursor está vacío en la última página.
+type FilePage struct {
+	Files      []*models.File `json:"files"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// fileCursor es la posición del último archivo de una página. Incluye el orden
+// para rechazar cursores usados con otro parámetro "sort" u "order".
+type fileCursor struct {
+	Sort       string          `json:"s"`
+	Descending bool            `json:"d"`
+	Value      json.RawMessage `json:"v"`
+	ID         string          `json:"id"`
+}
+
+// ListFiles devuelve una página de los archivos visibles para el usuario que
+// cumplen filter. cursor es el NextCursor de la página anterior (vacío para la primera).
+func (fs *FileService) ListFiles(userID string, filter *models.FileFilter, cursor string) (*FilePage, error) {
+	if cursor != "" {
+		value, id, err := decodeFileCursor(cursor, filter)
+		if err != nil {
+			return nil, err
+		}
+		filter.AfterValue, filter.AfterID = value, id
+	}
+
+	// Pedir un registro extra para saber si hay una página siguiente
+	limit := filter.Limit
+	filter.Limit = limit + 1
+	files, err := database.SearchFiles(fs.LogRepo.DB, userID, filter)
+	filter.Limit = limit
+	if err != nil {
+		return nil, err
+	}
+
+	page := &FilePage{Files: files}
+	if len(files) > limit {
+		page.Files = files[:limit]
+		if page.NextCursor, err = encodeFileCursor(page.Files[limit-1], filter); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// encodeFileCursor genera el cursor que continúa el listado después de file.
+func encodeFileCursor(file *models.File, filter *models.FileFilter) (string, error) {
+	var value interface{}
+	switch filter.Sort {
+	case "updated_at":
+		value = file.UpdatedAt
+	case "name":
+		value = file.OriginalName
+	case "size":
+		value = file.Size
+	default:
+		value = file.CreatedAt
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(fileCursor{Sort: filter.Sort, Descending: filter.Descending, Value: raw, ID: file.ID})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeFileCursor obtiene el valor de ordenamiento y el ID guardados en el cursor.
+func decodeFileCursor(cursor string, filter *models.FileFilter) (interface{}, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, "", ErrInvalidCursor
+	}
+	var c fileCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" {
+		return nil, "", ErrInvalidCursor
+	}
+	if c.Sort != filter.Sort || c.Descending != filter.Descending {
+		return nil, "", ErrInvalidCursor
+	}
+
+	var value interface{}
+	switch filter.Sort {
+	case "name":
+		var name string
+		err = json.Unmarshal(c.Value, &name)
+		value = name
+	case "size":
+		var size int64
+		err = json.Unmarshal(c.Value, &size)
+		value = size
+	default:
+		var t time.Time
+		err = json.Unmarshal(c.Value, &t)
+		value = t
+	}
+	if err != nil {
+		return nil, "", ErrInvalidCursor
+	}
+	return value, c.ID, nil
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/t-saturn/file-server/database"
+	"github.com/t-saturn/file-server/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Errores devueltos por ShareService.
+var (
+	ErrShareNotFound         = errors.New("enlace no encontrado")
+	ErrShareForbidden        = errors.New("solo el propietario puede gestionar los enlaces del archivo")
+	ErrShareInvalid          = errors.New("datos del enlace inválidos")
+	ErrShareUnavailable      = errors.New("el enlace venció, fue revocado o alcanzó el máximo de descargas")
+	ErrSharePasswordRequired = errors.New("el enlace requiere contraseña")
+	ErrSharePasswordInvalid  = errors.New("contraseña incorrecta")
+)
+
+// ShareService gestiona los enlaces públicos de los archivos. El token solo se
+// devuelve al crear el enlace; después se identifica por su hash.
+type ShareService struct {
+	FileSvc *FileService
+	BaseURL string
+}
+
+// NewShareService crea una instancia de ShareService. baseURL es la URL
+// pública de la ruta /share.
+func NewShareService(fileSvc *FileService, baseURL string) *ShareService {
+	return &ShareService{FileSvc: fileSvc, BaseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// CreateShare crea un enlace público para el archivo y devuelve el enlace y
+// su URL; requiere ser el propietario del archivo.
+func (ss *ShareService) CreateShare(fileID, userID string, req models.ShareLinkRequest) (*models.ShareLink, string, error) {
+	if _, err := ss.ownedFile(fileID, userID); err != nil {
+		return nil, "", err
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, "", fmt.Errorf("%w: expires_at debe ser una fecha futura", ErrShareInvalid)
+	}
+	if req.MaxDownloads != nil && *req.MaxDownloads < 1 {
+		return nil, "", fmt.Errorf("%w: max_downloads debe ser al menos 1", ErrShareInvalid)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	share := &models.ShareLink{
+		FileID:       fileID,
+		TokenHash:    hashShareToken(token),
+		TokenPrefix:  token[:6],
+		ExpiresAt:    req.ExpiresAt,
+		MaxDownloads: req.MaxDownloads,
+		CreatedBy:    userID,
+	}
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: %v", ErrShareInvalid, err)
+		}
+		share.PasswordHash = string(hash)
+		share.HasPassword = true
+	}
+	if err := database.InsertShareLink(ss.FileSvc.LogRepo.DB, share); err != nil {
+		return nil, "", err
+	}
+	return share, ss.BaseURL + "/" + token, nil
+}
+
+// ListShares devuelve los enlaces activos del archivo; requiere ser el propietario.
+func (ss *ShareService) ListShares(fileID, userID string) ([]*models.ShareLink, error) {
+	if _, err := ss.ownedFile(fileID, userID); err != nil {
+		return nil, err
+	}
+	return database.GetActiveShareLinks(ss.FileSvc.LogRepo.DB, fileID, time.Now())
+}
+
+// RevokeShare revoca un enlace del archivo; requiere ser el propietario.
+func (ss *ShareService) RevokeShare(fileID, shareID, userID string) error {
+	if _, err := ss.ownedFile(fileID, userID); err != nil {
+		return err
+	}
+	if _, err := uuid.Parse(shareID); err != nil {
+		return ErrShareNotFound
+	}
+	revoked, err := database.RevokeShareLink(ss.FileSvc.LogRepo.DB, fileID, shareID, time.Now())
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrShareNotFound
+	}
+	return nil
+}
+
+// OpenShare valida el token y la contraseña y devuelve el enlace y su archivo.
+// countDownload recibe el archivo e indica si la petición suma una descarga
+// al enlace; el acceso y la descarga se registran en la misma actualización,
+// que falla si otra petición alcanzó antes el máximo de descargas.
+func (ss *ShareService) OpenShare(token, password string, countDownload func(file *models.File) bool) (*models.ShareLink, *models.File, error) {
+	db := ss.FileSvc.LogRepo.DB
+	share, err := database.GetShareLinkByTokenHash(db, hashShareToken(token))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrShareNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	if share.RevokedAt != nil || (share.ExpiresAt != nil && !share.ExpiresAt.After(now)) ||
+		(share.MaxDownloads != nil && share.DownloadCount >= *share.MaxDownloads) {
+		return nil, nil, ErrShareUnavailable
+	}
+	if share.HasPassword {
+		if password == "" {
+			return nil, nil, ErrSharePasswordRequired
+		}
+		if bcrypt.CompareHashAndPassword([]byte(share.PasswordHash), []byte(password)) != nil {
+			return nil, nil, ErrSharePasswordInvalid
+		}
+	}
+
+	// Los archivos en la papelera no se comparten
+	file, err := ss.FileSvc.GetFileRecordByID(share.FileID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrShareNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	touched, err := database.TouchShareLink(db, share.ID, countDownload(file), now)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !touched {
+		return nil, nil, ErrShareUnavailable
+	}
+	return share, file, nil
+}
+
+// ownedFile obtiene el archivo y verifica que userID sea su propietario.
+func (ss *ShareService) ownedFile(fileID, userID string) (*models.File, error) {
+	file, err := ss.FileSvc.GetFileRecordByID(fileID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("archivo no encontrado: %w", ErrShareNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	role, err := ss.FileSvc.FileRole(file, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role != "owner" {
+		return nil, ErrShareForbidden
+	}
+	return file, nil
+}
+
+// hashShareToken devuelve el SHA-256 en hexadecimal del token de un enlace.
+func hashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/t-saturn/file-server/database"
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/utils"
+)
+
+// Errores devueltos por SignedURLService.
+var (
+	ErrInvalidSignedURL = errors.New("enlace firmado inválido")
+	ErrSignedURLExpired = errors.New("el enlace firmado venció")
+	ErrSignedURLUsed    = errors.New("el enlace firmado ya fue usado")
+)
+
+// defaultSignedURLTTL es la vigencia de un enlace cuando no se indica.
+const defaultSignedURLTTL = time.Hour
+
+// SignedURLService genera y verifica enlaces de descarga firmados con
+// HMAC-SHA256. La firma cubre el archivo, quien generó el enlace, el
+// vencimiento y, si corresponden, el nonce de un solo uso, la IP, la versión y
+// la descarga forzada, por lo que ninguno de esos parámetros puede alterarse.
+type SignedURLService struct {
+	FileSvc *FileService
+	Secret  []byte
+	MaxTTL  time.Duration
+}
+
+// SignedURL son los datos de un enlace firmado ya verificado.
+type SignedURL struct {
+	UserID    string
+	Nonce     string
+	ExpiresAt time.Time
+}
+
+// NewSignedURLService crea una instancia de SignedURLService.
+func NewSignedURLService(fileSvc *FileService, secret string, maxTTL time.Duration) *SignedURLService {
+	return &SignedURLService{FileSvc: fileSvc, Secret: []byte(secret), MaxTTL: maxTTL}
+}
+
+// Sign devuelve los parámetros de consulta de un enlace firmado para el
+// archivo y su vencimiento. clientIP es la IP de quien lo pide, usada si
+// req.BindIP está activo y req.IP no se indica.
+func (ss *SignedURLService) Sign(fileID, userID, clientIP string, req models.SignedURLRequest) (url.Values, time.Time, error) {
+	if len(ss.Secret) == 0 {
+		return nil, time.Time{}, errors.New("no hay clave configurada para firmar enlaces")
+	}
+	ttl := time.Duration(req.ExpiresIn) * time.Second
+	if req.ExpiresIn == 0 {
+		ttl = defaultSignedURLTTL
+	}
+	if ttl < 0 || (ss.MaxTTL > 0 && ttl > ss.MaxTTL) {
+		return nil, time.Time{}, fmt.Errorf("%w: expires_in debe estar entre 1 y %d segundos", ErrInvalidSignedURL, int(ss.MaxTTL.Seconds()))
+	}
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set("user", userID)
+	if req.SingleUse {
+		nonce := make([]byte, 16)
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, time.Time{}, err
+		}
+		query.Set("nonce", hex.EncodeToString(nonce))
+	}
+	boundIP := ""
+	if req.BindIP || req.IP != "" {
+		boundIP = req.IP
+		if boundIP == "" {
+			boundIP = clientIP
+		}
+		query.Set("ip_bound", "true")
+	}
+	if req.Version > 0 {
+		query.Set("version", strconv.Itoa(req.Version))
+	}
+	if req.Download {
+		query.Set("download", "true")
+	}
+	query.Set("signature", ss.signature(fileID, query, boundIP))
+	return query, expiresAt, nil
+}
+
+// Verify comprueba la firma y el vencimiento de un enlace para el archivo
+// pedido desde clientIP. No consume los enlaces de un solo uso (ver Consume).
+func (ss *SignedURLService) Verify(fileID string, query url.Values, clientIP string) (*SignedURL, error) {
+	if len(ss.Secret) == 0 {
+		return nil, ErrInvalidSignedURL
+	}
+	boundIP := ""
+	if query.Get("ip_bound") == "true" {
+		boundIP = clientIP
+	}
+	expected := ss.signature(fileID, query, boundIP)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return nil, ErrInvalidSignedURL
+	}
+
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignedURL
+	}
+	expiresAt := time.Unix(expires, 0)
+	if time.Now().After(expiresAt) {
+		return nil, ErrSignedURLExpired
+	}
+	return &SignedURL{UserID: query.Get("user"), Nonce: query.Get("nonce"), ExpiresAt: expiresAt}, nil
+}
+
+// Consume marca como usado un enlace de un solo uso; los demás enlaces no se
+// registran. Devuelve ErrSignedURLUsed si ya se había usado.
+func (ss *SignedURLService) Consume(fileID string, signed *SignedURL) error {
+	if signed.Nonce == "" {
+		return nil
+	}
+	consumed, err := database.ConsumeSignedURL(ss.FileSvc.LogRepo.DB, signed.Nonce, fileID, signed.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return ErrSignedURLUsed
+	}
+	return nil
+}
+
+// StartCleanup elimina periódicamente los usos registrados de enlaces vencidos.
+func (ss *SignedURLService) StartCleanup(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := database.DeleteExpiredSignedURLUses(ss.FileSvc.LogRepo.DB, time.Now()); err != nil {
+				utils.Logger.WithError(err).Error("Error limpiando los enlaces firmados vencidos")
+			} else if n > 0 {
+				utils.Logger.Infof("Enlaces firmados vencidos eliminados: %d", n)
+			}
+		}
+	}()
+}
+
+// signature calcula la firma de los parámetros del enlace.
+func (ss *SignedURLService) signature(fileID string, query url.Values, boundIP string) string {
+	payload := strings.Join([]string{
+		"signed-url",
+		fileID,
+		query.Get("user"),
+		query.Get("expires"),
+		query.Get("nonce"),
+		boundIP,
+		query.Get("version"),
+		query.Get("download"),
+	}, "\n")
+	mac := hmac.New(sha256.New, ss.Secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/t-saturn/file-server/models"
+)
+
+const testFileID = "85a93bf9-9e83-4c02-af06-d2cf29622a66"
+
+func signTestURL(t *testing.T, ss *SignedURLService, req models.SignedURLRequest) url.Values {
+	t.Helper()
+	query, _, err := ss.Sign(testFileID, "usuario-1", "10.0.0.1", req)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return query
+}
+
+func TestSignedURLRoundTrip(t *testing.T) {
+	ss := NewSignedURLService(nil, "secreto", 24*time.Hour)
+	query := signTestURL(t, ss, models.SignedURLRequest{ExpiresIn: 60, SingleUse: true, Version: 2, Download: true})
+
+	signed, err := ss.Verify(testFileID, query, "192.168.1.5")
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if signed.UserID != "usuario-1" || signed.Nonce == "" || time.Until(signed.ExpiresAt) > time.Minute {
+		t.Errorf("SignedURL = %+v", signed)
+	}
+}
+
+func TestSignedURLRejectsTampering(t *testing.T) {
+	ss := NewSignedURLService(nil, "secreto", 24*time.Hour)
+	original := signTestURL(t, ss, models.SignedURLRequest{ExpiresIn: 60, SingleUse: true, Version: 2})
+
+	tests := map[string]func(query url.Values){
+		"otro usuario":     func(q url.Values) { q.Set("user", "usuario-2") },
+		"otro vencimiento": func(q url.Values) { q.Set("expires", strconv.FormatInt(time.Now().Add(48*time.Hour).Unix(), 10)) },
+		"otro nonce":       func(q url.Values) { q.Set("nonce", "00000000000000000000000000000000") },
+		"sin nonce":        func(q url.Values) { q.Del("nonce") },
+		"otra versión":     func(q url.Values) { q.Set("version", "1") },
+		"descarga forzada": func(q url.Values) { q.Set("download", "true") },
+		"sin firma":        func(q url.Values) { q.Del("signature") },
+		"firma alterada":   func(q url.Values) { q.Set("signature", q.Get("signature")[1:]+"A") },
+	}
+	for name, tamper := range tests {
+		query := url.Values{}
+		for key, values := range original {
+			query[key] = append([]string(nil), values...)
+		}
+		tamper(query)
+		if _, err := ss.Verify(testFileID, query, "10.0.0.1"); !errors.Is(err, ErrInvalidSignedURL) {
+			t.Errorf("%s: Verify = %v, se esperaba ErrInvalidSignedURL", name, err)
+		}
+	}
+
+	if _, err := ss.Verify("otro-archivo", original, "10.0.0.1"); !errors.Is(err, ErrInvalidSignedURL) {
+		t.Errorf("otro archivo: Verify = %v", err)
+	}
+	other := NewSignedURLService(nil, "otro-secreto", 24*time.Hour)
+	if _, err := other.Verify(testFileID, original, "10.0.0.1"); !errors.Is(err, ErrInvalidSignedURL) {
+		t.Errorf("otra clave: Verify = %v", err)
+	}
+}
+
+func TestSignedURLIPBinding(t *testing.T) {
+	ss := NewSignedURLService(nil, "secreto", 24*time.Hour)
+
+	// Sin IP explícita se usa la de quien pidió el enlace
+	query := signTestURL(t, ss, models.SignedURLRequest{ExpiresIn: 60, BindIP: true})
+	if _, err := ss.Verify(testFileID, query, "10.0.0.1"); err != nil {
+		t.Errorf("misma IP: %v", err)
+	}
+	if _, err := ss.Verify(testFileID, query, "10.0.0.2"); !errors.Is(err, ErrInvalidSignedURL) {
+		t.Errorf("otra IP: Verify = %v", err)
+	}
+	query.Del("ip_bound")
+	if _, err := ss.Verify(testFileID, query, "10.0.0.2"); !errors.Is(err, ErrInvalidSignedURL) {
+		t.Errorf("sin ip_bound: Verify = %v", err)
+	}
+
+	query = signTestURL(t, ss, models.SignedURLRequest{ExpiresIn: 60, IP: "203.0.113.7"})
+	if _, err := ss.Verify(testFileID, query, "203.0.113.7"); err != nil {
+		t.Errorf("IP indicada: %v", err)
+	}
+	if _, err := ss.Verify(testFileID, query, "10.0.0.1"); !errors.Is(err, ErrInvalidSignedURL) {
+		t.Errorf("IP de quien firmó en lugar de la indicada: Verify = %v", err)
+	}
+}
+
+func TestSignedURLExpired(t *testing.T) {
+	ss := NewSignedURLService(nil, "secreto", 24*time.Hour)
+	query := signTestURL(t, ss, models.SignedURLRequest{ExpiresIn: 60})
+	query.Set("expires", strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10))
+	query.Set("signature", ss.signature(testFileID, query, ""))
+
+	if _, err := ss.Verify(testFileID, query, "10.0.0.1"); !errors.Is(err, ErrSignedURLExpired) {
+		t.Errorf("Verify = %v, se esperaba ErrSignedURLExpired", err)
+	}
+}
+
+func TestSignedURLSignValidation(t *testing.T) {
+	ss := NewSignedURLService(nil, "secreto", time.Hour)
+	for _, expiresIn := range []int{-1, 3601} {
+		if _, _, err := ss.Sign(testFileID, "usuario-1", "", models.SignedURLRequest{ExpiresIn: expiresIn}); !errors.Is(err, ErrInvalidSignedURL) {
+			t.Errorf("expires_in %d: Sign = %v", expiresIn, err)
+		}
+	}
+	if _, expiresAt, err := ss.Sign(testFileID, "usuario-1", "", models.SignedURLRequest{}); err != nil || time.Until(expiresAt) > defaultSignedURLTTL {
+		t.Errorf("vigencia por defecto: %v, %v", expiresAt, err)
+	}
+
+	unsigned := NewSignedURLService(nil, "", time.Hour)
+	if _, _, err := unsigned.Sign(testFileID, "usuario-1", "", models.SignedURLRequest{}); err == nil {
+		t.Error("Sign sin clave no devolvió error")
+	}
+	query := signTestURL(t, ss, models.SignedURLRequest{ExpiresIn: 60})
+	if _, err := unsigned.Verify(testFileID, query, ""); !errors.Is(err, ErrInvalidSignedURL) {
+		t.Errorf("Verify sin clave = %v", err)
+	}
+}
+
+func TestSignedURLConsumeWithoutNonce(t *testing.T) {
+	// Los enlaces de varios usos no se registran
+	ss := NewSignedURLService(nil, "secreto", time.Hour)
+	if err := ss.Consume(testFileID, &SignedURL{UserID: "usuario-1"}); err != nil {
+		t.Errorf("Consume = %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ContentAddressedStorage implementa la interfaz Storage guardando cada
+// contenido una sola vez, identificado por su resumen SHA-256. Dos subidas
+// idénticas devuelven la misma ruta relativa, por lo que el blob solo debe
+// eliminarse cuando ningún registro de archivo lo referencia.
+// La lectura, consulta y eliminación se delegan en LocalStorage.
+type ContentAddressedStorage struct {
+	*LocalStorage
+}
+
+func NewContentAddressedStorage(basePath string) *ContentAddressedStorage {
+	// Crear el directorio de blobs y el de escrituras temporales si no existen
+	os.MkdirAll(filepath.Join(basePath, "blobs", ".tmp"), os.ModePerm)
+	return &ContentAddressedStorage{
+		LocalStorage: NewLocalStorage(basePath),
+	}
+}
+
+func (cs *ContentAddressedStorage) SaveFile(project, filename string, data io.Reader) (string, error) {
+	// Escribir primero en un archivo temporal mientras se calcula el resumen
+	tmp, err := os.CreateTemp(filepath.Join(cs.BasePath, "blobs", ".tmp"), "upload-*")
+	if err != nil {
+		return "", err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	// Estructura final: blobs/<ab>/<cd>/<sha256>
+	digest := hex.EncodeToString(hash.Sum(nil))
+	relativePath := filepath.Join("blobs", digest[:2], digest[2:4], digest)
+	blobPath := filepath.Join(cs.BasePath, relativePath)
+
+	// Si el contenido ya existe no se vuelve a guardar
+	if _, err := os.Stat(blobPath); err == nil {
+		return relativePath, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(blobPath), os.ModePerm); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmpPath, blobPath); err != nil {
+		return "", err
+	}
+
+	return relativePath, nil
+}
+
+// Put guarda un blob recibido (p.ej. desde otra réplica) verificando que su
+// contenido coincida con el resumen indicado en la ruta, para no reparar una
+// copia con datos dañados.
+func (cs *ContentAddressedStorage) Put(path string, data io.Reader) error {
+	expected := filepath.Base(filepath.FromSlash(path))
+	hash := sha256.New()
+	return cs.LocalStorage.Put(path, &digestReader{Reader: io.TeeReader(data, hash), hash: hash, expected: expected})
+}
+
+// digestReader compara el resumen acumulado al llegar al final del contenido;
+// si no coincide devuelve un error en lugar de io.EOF, de modo que la
+// escritura se aborta antes de reemplazar el blob.
+type digestReader struct {
+	io.Reader
+	hash     hash.Hash
+	expected string
+}
+
+func (dr *digestReader) Read(p []byte) (int, error) {
+	n, err := dr.Reader.Read(p)
+	if err == io.EOF {
+		if digest := hex.EncodeToString(dr.hash.Sum(nil)); digest != dr.expected {
+			return n, fmt.Errorf("el contenido no coincide con el blob %s (sha256 %s)", dr.expected, digest)
+		}
+	}
+	return n, err
+}
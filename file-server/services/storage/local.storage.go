@@ -1,9 +1,13 @@
 package storage
 
 import (
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -25,8 +29,11 @@ func (ls *LocalStorage) SaveFile(project, filename string, data io.Reader) (stri
 	dateFolder := time.Now().Format("2006/01/02")
 
 	// Estructura final: data/<project>/<YYYY>/<MM>/<DD>
-	dirPath := filepath.Join(ls.BasePath, project, dateFolder)
-	err := os.MkdirAll(dirPath, os.ModePerm)
+	dirPath, err := ls.resolve(filepath.Join(project, dateFolder))
+	if err != nil {
+		return "", err
+	}
+	err = os.MkdirAll(dirPath, os.ModePerm)
 	if err != nil {
 		return "", err
 	}
@@ -41,9 +48,12 @@ func (ls *LocalStorage) SaveFile(project, filename string, data io.Reader) (stri
 	}
 	defer out.Close()
 
-	// Copiar los datos al archivo
+	// Copiar los datos al archivo; si la lectura se interrumpe (p.ej. por
+	// exceder la cuota) no se deja un archivo incompleto
 	_, err = io.Copy(out, data)
 	if err != nil {
+		out.Close()
+		os.Remove(filePath)
 		return "", err
 	}
 
@@ -56,3 +66,151 @@ func (ls *LocalStorage) SaveFile(project, filename string, data io.Reader) (stri
 
 	return relativePath, nil
 }
+
+func (ls *LocalStorage) Put(path string, data io.Reader) error {
+	fullPath, err := ls.resolve(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), os.ModePerm); err != nil {
+		return err
+	}
+
+	// Escribir en un temporal oculto del mismo directorio y renombrarlo al final,
+	// para que un lector nunca vea el archivo a medio escribir
+	tmp, err := os.CreateTemp(filepath.Dir(fullPath), ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fullPath)
+}
+
+func (ls *LocalStorage) Open(path string) (io.ReadSeekCloser, error) {
+	fullPath, err := ls.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(fullPath)
+}
+
+func (ls *LocalStorage) OpenRange(path string, offset, length int64) (io.ReadCloser, error) {
+	file, err := ls.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if length < 0 {
+		return file, nil
+	}
+	return &limitedReadCloser{Reader: io.LimitReader(file, length), Closer: file}, nil
+}
+
+func (ls *LocalStorage) Stat(path string) (FileInfo, error) {
+	fullPath, err := ls.resolve(path)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	if info.IsDir() {
+		return FileInfo{}, fmt.Errorf("%s: %w", path, ErrNotExist)
+	}
+	return FileInfo{Path: filepath.ToSlash(path), Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (ls *LocalStorage) Delete(path string) error {
+	fullPath, err := ls.resolve(path)
+	if err != nil {
+		return err
+	}
+	return os.Remove(fullPath)
+}
+
+// resolve convierte una ruta relativa en absoluta, rechazando las que
+// escapan de BasePath (p.ej. "../../etc/passwd").
+func (ls *LocalStorage) resolve(path string) (string, error) {
+	cleanPath := filepath.Clean(filepath.FromSlash(path))
+	if filepath.IsAbs(cleanPath) || cleanPath == ".." || strings.HasPrefix(cleanPath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("ruta de archivo insegura: %s", path)
+	}
+	return filepath.Join(ls.BasePath, cleanPath), nil
+}
+
+func (ls *LocalStorage) List(prefix string) ([]FileInfo, error) {
+	files := []FileInfo{}
+	err := filepath.WalkDir(ls.BasePath, func(fullPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Omitir directorios internos como ".uploads" o "blobs/.tmp"
+		if fullPath != ls.BasePath && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(ls.BasePath, fullPath)
+		if err != nil {
+			return err
+		}
+		relativePath = filepath.ToSlash(relativePath)
+		if !strings.HasPrefix(relativePath, prefix) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, FileInfo{Path: relativePath, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+func (ls *LocalStorage) Move(src, dst string) error {
+	srcPath, err := ls.resolve(src)
+	if err != nil {
+		return err
+	}
+	dstPath, err := ls.resolve(dst)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dstPath), os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(srcPath, dstPath)
+}
+
+// limitedReadCloser combina un lector limitado con el Close del archivo original.
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,471 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// emptyPayloadHash es el SHA-256 de un cuerpo vacío, usado al firmar GET, HEAD y DELETE.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Config agrupa los parámetros de conexión a un servicio compatible con S3.
+type S3Config struct {
+	Endpoint  string // p.ej. "http://localhost:9000" o "https://s3.us-east-1.amazonaws.com"
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool // true para MinIO y la mayoría de servicios compatibles
+}
+
+// S3Storage implementa la interfaz Storage sobre un bucket compatible con S3.
+// Las claves de los objetos siguen la misma estructura que LocalStorage
+// (<project>/<YYYY>/<MM>/<DD>/<archivo>) y las peticiones se firman con AWS
+// Signature Version 4 sin depender de un SDK externo.
+type S3Storage struct {
+	Config     S3Config
+	TempPath   string
+	httpClient *http.Client
+	// now da la hora usada en las firmas (reemplazable en las pruebas)
+	now func() time.Time
+}
+
+func NewS3Storage(cfg S3Config, tempPath string) *S3Storage {
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+	// Crear el directorio de escrituras temporales si no existe
+	os.MkdirAll(tempPath, os.ModePerm)
+	return &S3Storage{
+		Config:   cfg,
+		TempPath: tempPath,
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				MaxIdleConns:          20,
+				MaxIdleConnsPerHost:   10,
+				IdleConnTimeout:       90 * time.Second,
+				ResponseHeaderTimeout: 30 * time.Second,
+			},
+		},
+		now: time.Now,
+	}
+}
+
+func (ss *S3Storage) SaveFile(project, filename string, data io.Reader) (string, error) {
+	// Misma estructura de claves que LocalStorage: <project>/<YYYY>/<MM>/<DD>/<archivo>
+	key := path.Join(project, time.Now().Format("2006/01/02"), filename)
+	if err := ss.Put(key, data); err != nil {
+		return "", err
+	}
+	return cleanKey(key)
+}
+
+func (ss *S3Storage) Put(key string, data io.Reader) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	// S3 exige conocer el tamaño del cuerpo; el contenido se vuelca primero a
+	// un archivo temporal (no a memoria) mientras se calcula su SHA-256.
+	tmp, err := os.CreateTemp(ss.TempPath, "s3-upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), data)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	req, err := ss.newRequest(http.MethodPut, key, nil, nil, tmp, hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+
+	resp, err := ss.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp, key)
+	}
+
+	return nil
+}
+
+func (ss *S3Storage) Open(key string) (io.ReadSeekCloser, error) {
+	info, err := ss.Stat(key)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Object{storage: ss, key: info.Path, size: info.Size}, nil
+}
+
+func (ss *S3Storage) Stat(key string) (FileInfo, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	req, err := ss.newRequest(http.MethodHead, key, nil, nil, nil, emptyPayloadHash)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	resp, err := ss.httpClient.Do(req)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return FileInfo{}, s3Error(resp, key)
+	}
+
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return FileInfo{Path: key, Size: resp.ContentLength, ModTime: modTime}, nil
+}
+
+func (ss *S3Storage) Delete(key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	req, err := ss.newRequest(http.MethodDelete, key, nil, nil, nil, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	resp, err := ss.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return s3Error(resp, key)
+	}
+	return nil
+}
+
+func (ss *S3Storage) OpenRange(key string, offset, length int64) (io.ReadCloser, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if length == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	req, err := ss.newRequest(http.MethodGet, key, nil, nil, nil, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	if length > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	} else if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+	resp, err := ss.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		defer resp.Body.Close()
+		return nil, s3Error(resp, key)
+	}
+	return resp.Body, nil
+}
+
+func (ss *S3Storage) List(prefix string) ([]FileInfo, error) {
+	files := []FileInfo{}
+	continuationToken := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+		req, err := ss.newRequest(http.MethodGet, "", query, nil, nil, emptyPayloadHash)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := ss.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := s3Error(resp, prefix)
+			resp.Body.Close()
+			return nil, err
+		}
+
+		var result struct {
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+			Contents              []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			files = append(files, FileInfo{Path: object.Key, Size: object.Size, ModTime: object.LastModified})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		continuationToken = result.NextContinuationToken
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// Move copia el objeto en el servidor (CopyObject) y luego elimina el original.
+func (ss *S3Storage) Move(src, dst string) error {
+	src, err := cleanKey(src)
+	if err != nil {
+		return err
+	}
+	dst, err = cleanKey(dst)
+	if err != nil {
+		return err
+	}
+	copySource := "/" + ss.Config.Bucket + "/" + uriEncode(src, false)
+	req, err := ss.newRequest(http.MethodPut, dst, nil, map[string]string{"x-amz-copy-source": copySource}, nil, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	resp, err := ss.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp, src)
+	}
+	return ss.Delete(src)
+}
+
+// newRequest construye una petición firmada con AWS Signature Version 4.
+// Las cabeceras x-amz-* adicionales en extraHeaders también se firman.
+func (ss *S3Storage) newRequest(method, key string, query url.Values, extraHeaders map[string]string, body io.Reader, payloadHash string) (*http.Request, error) {
+	endpoint, err := url.Parse(ss.Config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	host := endpoint.Host
+	canonicalURI := "/" + uriEncode(key, false)
+	if ss.Config.PathStyle {
+		canonicalURI = "/" + ss.Config.Bucket
+		if key != "" {
+			canonicalURI += "/" + uriEncode(key, false)
+		}
+	} else {
+		host = ss.Config.Bucket + "." + host
+	}
+	canonicalQuery := canonicalQueryString(query)
+
+	target := endpoint.Scheme + "://" + host + canonicalURI
+	if canonicalQuery != "" {
+		target += "?" + canonicalQuery
+	}
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	// Conservar la ruta codificada tal como se firmó
+	req.URL.RawPath = canonicalURI
+
+	now := ss.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	shortDate := now.Format("20060102")
+
+	headers := map[string]string{
+		"host":                 host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	for name, value := range extraHeaders {
+		headers[strings.ToLower(name)] = value
+	}
+
+	// Cabeceras firmadas, en orden alfabético
+	signedHeaders := make([]string, 0, len(headers))
+	for name := range headers {
+		signedHeaders = append(signedHeaders, name)
+	}
+	sort.Strings(signedHeaders)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range signedHeaders {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+		if name != "host" {
+			req.Header.Set(name, headers[name])
+		}
+	}
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		canonicalURI,
+		canonicalQuery,
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	scope := shortDate + "/" + ss.Config.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+ss.Config.SecretKey), shortDate)
+	signingKey = hmacSHA256(signingKey, ss.Config.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		ss.Config.AccessKey, scope, strings.Join(signedHeaders, ";"), signature,
+	))
+	return req, nil
+}
+
+// s3Object implementa io.ReadSeekCloser sobre un objeto remoto. Cada Seek
+// descarta la descarga en curso y la siguiente lectura pide un rango nuevo,
+// lo que permite a http.ServeContent atender peticiones Range.
+type s3Object struct {
+	storage *S3Storage
+	key     string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+	if o.body == nil {
+		body, err := o.storage.OpenRange(o.key, o.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		o.body = body
+	}
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = o.offset + offset
+	case io.SeekEnd:
+		target = o.size + offset
+	default:
+		return 0, errors.New("s3: whence inválido")
+	}
+	if target < 0 {
+		return 0, errors.New("s3: posición negativa")
+	}
+	if target != o.offset && o.body != nil {
+		o.body.Close()
+		o.body = nil
+	}
+	o.offset = target
+	return target, nil
+}
+
+func (o *s3Object) Close() error {
+	if o.body != nil {
+		return o.body.Close()
+	}
+	return nil
+}
+
+// s3Error convierte una respuesta no exitosa en error; 404 se traduce a ErrNotExist.
+func s3Error(resp *http.Response, key string) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s: %w", key, ErrNotExist)
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("s3: %s %s falló con el código de estado %d: %s", resp.Request.Method, key, resp.StatusCode, string(body))
+}
+
+// cleanKey normaliza la clave y rechaza las que intentan salir de la raíz.
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean(strings.TrimPrefix(strings.ReplaceAll(key, "\\", "/"), "/"))
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("ruta de archivo insegura: %s", key)
+	}
+	return cleaned, nil
+}
+
+// uriEncode codifica según RFC 3986 como exige SigV4: solo se conservan los
+// caracteres no reservados y, si encodeSlash es false, el separador "/".
+func uriEncode(value string, encodeSlash bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			sb.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&sb, "%%%02X", c)
+	}
+	return sb.String()
+}
+
+// canonicalQueryString ordena y codifica los parámetros de consulta para la firma.
+func canonicalQueryString(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := []string{}
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
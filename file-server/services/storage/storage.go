@@ -1,8 +1,38 @@
 package storage
 
-import "io"
+import (
+	"io"
+	"io/fs"
+	"time"
+)
+
+// ErrNotExist indica que la ruta solicitada no existe en el almacenamiento.
+// Es el mismo valor que fs.ErrNotExist, por lo que errors.Is funciona también
+// con los errores del sistema de archivos.
+var ErrNotExist = fs.ErrNotExist
+
+// FileInfo describe un archivo guardado en el almacenamiento.
+type FileInfo struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
 
 // Storage define la interfaz para operaciones de almacenamiento.
+// Las rutas son siempre relativas a la raíz del backend y usan "/" como separador.
 type Storage interface {
 	SaveFile(project, filename string, data io.Reader) (string, error)
-}
\ No newline at end of file
+	// Put guarda el contenido en una ruta exacta, reemplazando el archivo si
+	// existe. Se usa en las réplicas para conservar la misma ruta que el primario.
+	Put(path string, data io.Reader) error
+	// Open abre el contenido completo con soporte de Seek (usado por http.ServeContent).
+	Open(path string) (io.ReadSeekCloser, error)
+	// OpenRange lee length bytes a partir de offset; length < 0 lee hasta el final.
+	OpenRange(path string, offset, length int64) (io.ReadCloser, error)
+	Stat(path string) (FileInfo, error)
+	Delete(path string) error
+	// List devuelve los archivos cuya ruta comienza con prefix, ordenados por ruta.
+	List(prefix string) ([]FileInfo, error)
+	// Move renombra un archivo dentro del mismo backend.
+	Move(src, dst string) error
+}
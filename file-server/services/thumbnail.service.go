@@ -0,0 +1,398 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/t-saturn/file-server/database"
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/utils"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+	"gorm.io/gorm"
+)
+
+// Errores devueltos por ThumbnailService.
+var (
+	ErrThumbnailUnsupported = errors.New("el archivo no es una imagen compatible")
+	ErrThumbnailInvalid     = errors.New("parámetros de miniatura inválidos")
+	ErrThumbnailTooLarge    = errors.New("la imagen supera el máximo de píxeles para generar miniaturas")
+)
+
+// Modos de ajuste de una miniatura: cover recorta para llenar el tamaño,
+// contain encaja la imagen completa y fill la estira.
+const (
+	ThumbnailFitCover   = "cover"
+	ThumbnailFitContain = "contain"
+	ThumbnailFitFill    = "fill"
+)
+
+// ThumbnailSpec describe una miniatura. Un ancho o alto en 0 se calcula para
+// conservar la proporción de la imagen.
+type ThumbnailSpec struct {
+	Width  int
+	Height int
+	Fit    string
+	Format string
+}
+
+// ThumbnailService genera miniaturas y versiones redimensionadas de las
+// imágenes con librerías de Go (sin dependencias nativas) y las guarda en
+// disco en CachePath/<file_id>/<versión>/, por lo que una versión nueva del
+// archivo nunca reutiliza las miniaturas de la anterior.
+type ThumbnailService struct {
+	FileSvc      *FileService
+	CachePath    string
+	MaxDimension int
+	// MaxPixels limita el tamaño de las imágenes de origen (ancho x alto) para
+	// no agotar la memoria al decodificarlas
+	MaxPixels int64
+	Presets   []ThumbnailSpec
+
+	locks sync.Map
+	queue chan *models.File
+}
+
+// thumbnailSources son los tipos de imagen a partir de los que se generan miniaturas.
+var thumbnailSources = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// NewThumbnailService crea una instancia de ThumbnailService. presets son las
+// miniaturas ("256x256", "1024x0"...) que se generan en segundo plano al subir
+// una imagen; workers es la cantidad de generaciones simultáneas.
+func NewThumbnailService(fileSvc *FileService, cachePath string, maxDimension int, maxPixels int64, presets []string, workers int) *ThumbnailService {
+	ts := &ThumbnailService{
+		FileSvc:      fileSvc,
+		CachePath:    cachePath,
+		MaxDimension: maxDimension,
+		MaxPixels:    maxPixels,
+		queue:        make(chan *models.File, 256),
+	}
+	for _, preset := range presets {
+		width, height, found := strings.Cut(strings.ToLower(preset), "x")
+		w, errW := strconv.Atoi(width)
+		h, errH := strconv.Atoi(height)
+		if !found || errW != nil || errH != nil {
+			utils.Logger.Warnf("Miniatura predefinida inválida: %s", preset)
+			continue
+		}
+		ts.Presets = append(ts.Presets, ThumbnailSpec{Width: w, Height: h, Fit: ThumbnailFitCover})
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go ts.worker()
+	}
+	return ts
+}
+
+// Supports indica si se pueden generar miniaturas del archivo.
+func (ts *ThumbnailService) Supports(file *models.File) bool {
+	return thumbnailSources[file.MimeType]
+}
+
+// Enqueue programa la generación de las miniaturas predefinidas del archivo.
+// Si la cola está llena se omite: las miniaturas se generarán al pedirlas.
+func (ts *ThumbnailService) Enqueue(file *models.File) {
+	if len(ts.Presets) == 0 || !ts.Supports(file) {
+		return
+	}
+	select {
+	case ts.queue <- file:
+	default:
+		utils.Logger.WithField("file_id", file.ID).Warn("Cola de miniaturas llena, se generarán al pedirlas")
+	}
+}
+
+// worker genera las miniaturas predefinidas de los archivos encolados.
+func (ts *ThumbnailService) worker() {
+	for file := range ts.queue {
+		for _, spec := range ts.Presets {
+			if _, _, err := ts.Thumbnail(file, spec); err != nil {
+				utils.Logger.WithError(err).WithField("file_id", file.ID).Warn("No se pudo generar la miniatura")
+				break
+			}
+		}
+	}
+}
+
+// Normalize valida la especificación y completa el ajuste y el formato por
+// defecto (el de la imagen original; JPEG para GIF).
+func (ts *ThumbnailService) Normalize(file *models.File, spec ThumbnailSpec) (ThumbnailSpec, error) {
+	if spec.Width < 0 || spec.Height < 0 || (spec.Width == 0 && spec.Height == 0) ||
+		spec.Width > ts.MaxDimension || spec.Height > ts.MaxDimension {
+		return spec, fmt.Errorf("%w: w y h deben estar entre 1 y %d", ErrThumbnailInvalid, ts.MaxDimension)
+	}
+	if spec.Fit == "" {
+		spec.Fit = ThumbnailFitCover
+	}
+	if spec.Fit != ThumbnailFitCover && spec.Fit != ThumbnailFitContain && spec.Fit != ThumbnailFitFill {
+		return spec, fmt.Errorf("%w: fit debe ser cover, contain o fill", ErrThumbnailInvalid)
+	}
+	if spec.Format == "jpg" {
+		spec.Format = "jpeg"
+	}
+	if spec.Format == "" {
+		switch file.MimeType {
+		case "image/png":
+			spec.Format = "png"
+		case "image/webp":
+			spec.Format = "webp"
+		default:
+			spec.Format = "jpeg"
+		}
+	}
+	if spec.Format != "jpeg" && spec.Format != "png" && spec.Format != "webp" {
+		return spec, fmt.Errorf("%w: format debe ser jpeg, png o webp", ErrThumbnailInvalid)
+	}
+	return spec, nil
+}
+
+// Thumbnail devuelve la ruta en disco de la miniatura del archivo (con URL y
+// Version de la versión a usar), generándola si todavía no existe, y la
+// especificación con el ajuste y el formato efectivos.
+func (ts *ThumbnailService) Thumbnail(file *models.File, spec ThumbnailSpec) (string, ThumbnailSpec, error) {
+	if !ts.Supports(file) {
+		return "", spec, ErrThumbnailUnsupported
+	}
+	spec, err := ts.Normalize(file, spec)
+	if err != nil {
+		return "", spec, err
+	}
+	cachePath := filepath.Join(ts.CachePath, file.ID, strconv.Itoa(file.Version),
+		fmt.Sprintf("%dx%d-%s.%s", spec.Width, spec.Height, spec.Fit, spec.Format))
+	if _, err := os.Stat(cachePath); err == nil {
+		return cachePath, spec, nil
+	}
+
+	// Una sola generación por miniatura aunque lleguen varias peticiones a la vez
+	lock, _ := ts.locks.LoadOrStore(cachePath, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer func() {
+		lock.(*sync.Mutex).Unlock()
+		ts.locks.Delete(cachePath)
+	}()
+	if _, err := os.Stat(cachePath); err == nil {
+		return cachePath, spec, nil
+	}
+
+	if err := ts.generate(file, spec, cachePath); err != nil {
+		return "", spec, err
+	}
+	return cachePath, spec, nil
+}
+
+// generate decodifica la imagen original, la redimensiona y guarda la
+// miniatura en cachePath de forma atómica.
+func (ts *ThumbnailService) generate(file *models.File, spec ThumbnailSpec, cachePath string) error {
+	content, err := ts.FileSvc.Storage.Open(file.URL)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	// Revisar las dimensiones antes de decodificar la imagen completa
+	config, err := decodeImageConfig(file.MimeType, content)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrThumbnailUnsupported, err)
+	}
+	if ts.MaxPixels > 0 && int64(config.Width)*int64(config.Height) > ts.MaxPixels {
+		return ErrThumbnailTooLarge
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	src, err := decodeImage(file.MimeType, content)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrThumbnailUnsupported, err)
+	}
+
+	dst := resizeImage(src, spec)
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(cachePath), ".thumb-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	switch spec.Format {
+	case "png":
+		err = png.Encode(tmp, dst)
+	case "webp":
+		err = nativewebp.Encode(tmp, dst, nil)
+	default:
+		err = jpeg.Encode(tmp, flattenImage(dst), &jpeg.Options{Quality: 85})
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), cachePath)
+}
+
+// StartCleanup elimina periódicamente las miniaturas de archivos purgados o
+// en la papelera y las de versiones que ya no son la actual.
+func (ts *ThumbnailService) StartCleanup(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := ts.Cleanup(); err != nil {
+				utils.Logger.WithError(err).Error("Error limpiando la caché de miniaturas")
+			} else if n > 0 {
+				utils.Logger.Infof("Carpetas de miniaturas eliminadas: %d", n)
+			}
+		}
+	}()
+}
+
+// Cleanup elimina de la caché las miniaturas que ya no corresponden a la
+// versión actual de un archivo activo y devuelve cuántas carpetas eliminó.
+func (ts *ThumbnailService) Cleanup() (int, error) {
+	entries, err := os.ReadDir(ts.CachePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		fileDir := filepath.Join(ts.CachePath, entry.Name())
+		file, err := database.GetFileRecordById(ts.FileSvc.LogRepo.DB, entry.Name())
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			// Sin acceso a la base no se puede saber qué sobra: se reintenta en la próxima pasada
+			return removed, err
+		}
+		if err != nil || file.DeletedAt != nil {
+			if os.RemoveAll(fileDir) == nil {
+				removed++
+			}
+			continue
+		}
+		versions, err := os.ReadDir(fileDir)
+		if err != nil {
+			continue
+		}
+		for _, version := range versions {
+			if version.Name() != strconv.Itoa(file.Version) && os.RemoveAll(filepath.Join(fileDir, version.Name())) == nil {
+				removed++
+			}
+		}
+	}
+	return removed, nil
+}
+
+// decodeImageConfig lee solo las dimensiones de la imagen.
+func decodeImageConfig(mimeType string, r io.Reader) (image.Config, error) {
+	switch mimeType {
+	case "image/jpeg":
+		return jpeg.DecodeConfig(r)
+	case "image/png":
+		return png.DecodeConfig(r)
+	case "image/gif":
+		return gif.DecodeConfig(r)
+	case "image/webp":
+		return webp.DecodeConfig(r)
+	}
+	return image.Config{}, ErrThumbnailUnsupported
+}
+
+// decodeImage decodifica la imagen (el primer cuadro en los GIF animados).
+func decodeImage(mimeType string, r io.Reader) (image.Image, error) {
+	switch mimeType {
+	case "image/jpeg":
+		return jpeg.Decode(r)
+	case "image/png":
+		return png.Decode(r)
+	case "image/gif":
+		return gif.Decode(r)
+	case "image/webp":
+		return webp.Decode(r)
+	}
+	return nil, ErrThumbnailUnsupported
+}
+
+// resizeImage redimensiona src según la especificación. Las imágenes nunca se
+// amplían más allá de su tamaño original, salvo con fill.
+func resizeImage(src image.Image, spec ThumbnailSpec) image.Image {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	if srcW == 0 || srcH == 0 {
+		return src
+	}
+	width, height := spec.Width, spec.Height
+	switch {
+	case width == 0:
+		width = max(1, srcW*height/srcH)
+	case height == 0:
+		height = max(1, srcH*width/srcW)
+	}
+
+	srcRect := bounds
+	switch spec.Fit {
+	case ThumbnailFitContain:
+		// Escala que encaja la imagen completa en width x height
+		if srcW*height > srcH*width {
+			height = max(1, srcH*width/srcW)
+		} else {
+			width = max(1, srcW*height/srcH)
+		}
+		if width > srcW || height > srcH {
+			width, height = srcW, srcH
+		}
+	case ThumbnailFitCover:
+		// Recortar el centro con la proporción pedida
+		if srcW*height > srcH*width {
+			cropW := srcH * width / height
+			x0 := bounds.Min.X + (srcW-cropW)/2
+			srcRect = image.Rect(x0, bounds.Min.Y, x0+cropW, bounds.Max.Y)
+		} else {
+			cropH := srcW * height / width
+			y0 := bounds.Min.Y + (srcH-cropH)/2
+			srcRect = image.Rect(bounds.Min.X, y0, bounds.Max.X, y0+cropH)
+		}
+		if width > srcRect.Dx() || height > srcRect.Dy() {
+			width, height = max(1, srcRect.Dx()), max(1, srcRect.Dy())
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, srcRect, xdraw.Src, nil)
+	return dst
+}
+
+// flattenImage compone la imagen sobre fondo blanco, ya que JPEG no admite
+// transparencia.
+func flattenImage(src image.Image) image.Image {
+	dst := image.NewRGBA(src.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Over)
+	return dst
+}
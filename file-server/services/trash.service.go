@@ -0,0 +1,137 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/t-saturn/file-server/database"
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/utils"
+	"gorm.io/gorm"
+)
+
+// ErrTrashedFileNotFound indica que el archivo no está en la papelera.
+var ErrTrashedFileNotFound = errors.New("archivo no encontrado en la papelera")
+
+// ListTrash obtiene los archivos del usuario que están en la papelera.
+func (fs *FileService) ListTrash(ownerID string, limit, offset int) ([]*models.File, int64, error) {
+	return database.GetTrashedFiles(fs.LogRepo.DB, ownerID, limit, offset)
+}
+
+// getTrashedFile obtiene un archivo de la papelera verificando que pertenezca al solicitante.
+func (fs *FileService) getTrashedFile(fileID, requestorID string) (*models.File, error) {
+	file, err := database.GetTrashedFileById(fs.LogRepo.DB, fileID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTrashedFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if file.OwnerID != requestorID {
+		return nil, errors.New("solo el propietario puede gestionar el archivo en la papelera")
+	}
+	return file, nil
+}
+
+// RestoreFile saca un archivo de la papelera.
+func (fs *FileService) RestoreFile(fileID, requestorID string) (*models.File, error) {
+	file, err := fs.getTrashedFile(fileID, requestorID)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.RestoreFileRecord(fs.LogRepo.DB, fileID); err != nil {
+		return nil, err
+	}
+	file.DeletedAt = nil
+	fs.SyncFileRecord(file)
+	return file, nil
+}
+
+// PurgeTrashedFile elimina definitivamente un archivo de la papelera a pedido del propietario.
+func (fs *FileService) PurgeTrashedFile(fileID, requestorID string) error {
+	file, err := fs.getTrashedFile(fileID, requestorID)
+	if err != nil {
+		return err
+	}
+	return fs.PurgeFile(file)
+}
+
+// PurgeFile elimina definitivamente un archivo: su registro, permisos y
+// versiones, y los blobs que ningún otro archivo o versión usa. Las réplicas
+// se eliminan primero; si no se alcanza el quórum el archivo se mantiene en la
+// papelera y se devuelve ErrReplicationQuorum, para reintentarlo luego.
+func (fs *FileService) PurgeFile(file *models.File) error {
+	versions, err := database.GetFileVersions(fs.LogRepo.DB, file.ID)
+	if err != nil {
+		return err
+	}
+	paths := map[string]bool{file.URL: true}
+	var versionBytes int64
+	for _, version := range versions {
+		paths[version.URL] = true
+		versionBytes += version.Size
+	}
+
+	// Determinar qué contenidos quedan sin referencias al purgar este archivo
+	released := []string{}
+	for path := range paths {
+		references, err := database.CountBlobReferences(fs.LogRepo.DB, path, file.ID)
+		if err != nil {
+			return err
+		}
+		if references == 0 {
+			released = append(released, path)
+		}
+	}
+	for _, path := range released {
+		if err := fs.Replication.ReplicateDelete(path); err != nil {
+			return err
+		}
+	}
+
+	if err := database.PurgeFileRecord(fs.LogRepo.DB, file.ID); err != nil {
+		return err
+	}
+	fs.addQuotaUsage(file, -versionBytes, -1)
+	// Sin registro en el primario, la réplica elimina también el suyo
+	fs.SyncFileRecord(file)
+
+	for _, path := range released {
+		if err := fs.Storage.Delete(path); err != nil {
+			utils.Logger.WithError(err).WithField("path", path).Warn("No se pudo eliminar el contenido local")
+		}
+	}
+	return nil
+}
+
+// PurgeExpiredTrash elimina definitivamente los archivos que llevan en la
+// papelera más que retention.
+func (fs *FileService) PurgeExpiredTrash(retention time.Duration) {
+	files, err := database.GetExpiredTrashedFiles(fs.LogRepo.DB, time.Now().Add(-retention), 100)
+	if err != nil {
+		utils.Logger.WithError(err).Error("Error obteniendo los archivos vencidos de la papelera")
+		return
+	}
+	for _, file := range files {
+		fields := logrus.Fields{"event": "purge", "file_id": file.ID, "path": file.URL}
+		if err := fs.PurgeFile(file); err != nil {
+			utils.Logger.WithError(err).WithFields(fields).Error("No se pudo purgar el archivo")
+			_ = fs.LogRepo.LogEvent("purge", FileProject(file), file.URL, "", "failure", err.Error())
+			continue
+		}
+		utils.Logger.WithFields(fields).Info("Archivo purgado de la papelera")
+		_ = fs.LogRepo.LogEvent("purge", FileProject(file), file.URL, "", "success", "Archivo purgado de la papelera")
+	}
+}
+
+// StartTrashPurger ejecuta PurgeExpiredTrash periódicamente en segundo plano.
+func (fs *FileService) StartTrashPurger(retention, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			fs.PurgeExpiredTrash(retention)
+		}
+	}()
+}
@@ -0,0 +1,332 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/t-saturn/file-server/database"
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/utils"
+	"gorm.io/gorm"
+)
+
+// Errores devueltos por UploadService.
+var (
+	ErrUploadSessionNotFound  = errors.New("sesión de subida no encontrada")
+	ErrUploadSessionForbidden = errors.New("la sesión de subida pertenece a otro usuario")
+	ErrUploadSessionClosed    = errors.New("la sesión de subida ya no admite cambios")
+	ErrUploadChunkOutOfRange  = errors.New("el fragmento excede el tamaño declarado")
+	ErrUploadIncomplete       = errors.New("la subida aún no está completa")
+)
+
+// UploadService gestiona las sesiones de subida reanudable. Los fragmentos se
+// escriben en un archivo parcial en disco y cada rango recibido se registra en
+// Postgres, de modo que una sesión sobrevive a un reinicio del servidor.
+type UploadService struct {
+	FileSvc    *FileService
+	PolicySvc  *UploadPolicyService
+	QuotaSvc   *QuotaService
+	ProjectSvc *ProjectService
+	TempPath   string
+	SessionTTL time.Duration
+}
+
+// NewUploadService crea una instancia de UploadService.
+func NewUploadService(fileSvc *FileService, policySvc *UploadPolicyService, quotaSvc *QuotaService, projectSvc *ProjectService, tempPath string, sessionTTL time.Duration) *UploadService {
+	// Crear el directorio de archivos parciales si no existe
+	os.MkdirAll(tempPath, os.ModePerm)
+	return &UploadService{
+		FileSvc:    fileSvc,
+		PolicySvc:  policySvc,
+		QuotaSvc:   quotaSvc,
+		ProjectSvc: projectSvc,
+		TempPath:   tempPath,
+		SessionTTL: sessionTTL,
+	}
+}
+
+// CreateSession abre una nueva sesión de subida para un archivo de tamaño conocido.
+func (us *UploadService) CreateSession(ownerID, project, originalName string, totalSize int64, isPublic bool) (*models.UploadSession, error) {
+	if totalSize < 0 {
+		return nil, errors.New("el tamaño del archivo no puede ser negativo")
+	}
+	return database.InsertUploadSession(us.FileSvc.LogRepo.DB, ownerID, project, originalName, totalSize, isPublic, time.Now().Add(us.SessionTTL))
+}
+
+// GetSession devuelve la sesión y los rangos recibidos hasta el momento.
+func (us *UploadService) GetSession(sessionID, ownerID string) (*models.UploadSession, []models.ByteRange, error) {
+	session, err := us.ownedSession(sessionID, ownerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	ranges, err := us.receivedRanges(sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return session, ranges, nil
+}
+
+// WriteChunk escribe un fragmento a partir del offset indicado y lo registra.
+// Devuelve la cantidad de bytes escritos.
+func (us *UploadService) WriteChunk(sessionID, ownerID string, offset int64, data io.Reader) (int64, error) {
+	session, err := us.ownedSession(sessionID, ownerID)
+	if err != nil {
+		return 0, err
+	}
+	if session.Status != "pending" || time.Now().After(session.ExpiresAt) {
+		return 0, ErrUploadSessionClosed
+	}
+	if offset < 0 || offset >= session.TotalSize {
+		return 0, ErrUploadChunkOutOfRange
+	}
+
+	part, err := os.OpenFile(us.partPath(sessionID), os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer part.Close()
+
+	// Se permite leer un byte más de lo disponible para detectar fragmentos
+	// que sobrepasan el tamaño declarado.
+	remaining := session.TotalSize - offset
+	written, err := io.Copy(io.NewOffsetWriter(part, offset), io.LimitReader(data, remaining+1))
+	if err != nil {
+		return 0, err
+	}
+	if written > remaining {
+		return 0, ErrUploadChunkOutOfRange
+	}
+
+	// Asegurar que los datos están en disco antes de registrar el rango
+	if err := part.Sync(); err != nil {
+		return 0, err
+	}
+	if written > 0 {
+		if err := database.InsertUploadChunk(us.FileSvc.LogRepo.DB, sessionID, offset, written); err != nil {
+			return 0, err
+		}
+	}
+	return written, nil
+}
+
+// Complete verifica que se recibieron todos los bytes y registra el archivo
+// final siguiendo el mismo camino que una subida directa: almacenamiento,
+// réplica, registro en base de datos y permiso de propietario.
+func (us *UploadService) Complete(sessionID, ownerID string) (*models.File, error) {
+	db := us.FileSvc.LogRepo.DB
+	session, err := us.ownedSession(sessionID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status == "completed" && session.FileID != nil {
+		return us.FileSvc.GetFileRecordByID(*session.FileID)
+	}
+
+	// El rol se verifica de nuevo, como en una subida directa: el usuario pudo
+	// dejar de ser administrador o editor del proyecto desde que abrió la sesión
+	if err := us.ProjectSvc.RequireRole(session.Project, session.OwnerID, models.ProjectRoleAdmin, models.ProjectRoleEditor); err != nil {
+		return nil, err
+	}
+
+	ranges, err := us.receivedRanges(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if !coversWhole(ranges, session.TotalSize) {
+		return nil, ErrUploadIncomplete
+	}
+
+	claimed, err := database.ClaimUploadSession(db, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, ErrUploadSessionClosed
+	}
+
+	file, err := us.finalize(session)
+	if errors.Is(err, ErrFileTooLarge) || errors.Is(err, ErrMimeTypeNotAllowed) {
+		// El contenido no cumple la política del proyecto: reintentar no sirve
+		_ = database.UpdateUploadSessionStatus(db, sessionID, "aborted", nil)
+		us.discardParts(sessionID)
+		return nil, err
+	}
+	if err != nil {
+		// Devolver la sesión a "pending" para que el cliente pueda reintentar
+		_ = database.UpdateUploadSessionStatus(db, sessionID, "pending", nil)
+		return nil, err
+	}
+
+	if err := database.UpdateUploadSessionStatus(db, sessionID, "completed", &file.ID); err != nil {
+		return nil, err
+	}
+	us.discardParts(sessionID)
+	return file, nil
+}
+
+// Abort cancela una sesión pendiente y elimina los datos parciales.
+func (us *UploadService) Abort(sessionID, ownerID string) error {
+	session, err := us.ownedSession(sessionID, ownerID)
+	if err != nil {
+		return err
+	}
+	if session.Status != "pending" {
+		return ErrUploadSessionClosed
+	}
+	if err := database.UpdateUploadSessionStatus(us.FileSvc.LogRepo.DB, sessionID, "aborted", nil); err != nil {
+		return err
+	}
+	us.discardParts(sessionID)
+	return nil
+}
+
+// CleanupExpired marca como expiradas las sesiones vencidas y libera su espacio.
+func (us *UploadService) CleanupExpired() (int, error) {
+	db := us.FileSvc.LogRepo.DB
+	sessions, err := database.GetExpiredUploadSessions(db, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	for _, session := range sessions {
+		if err := database.UpdateUploadSessionStatus(db, session.ID, "expired", nil); err != nil {
+			return 0, err
+		}
+		us.discardParts(session.ID)
+	}
+	return len(sessions), nil
+}
+
+// StartCleanup ejecuta CleanupExpired periódicamente en segundo plano.
+func (us *UploadService) StartCleanup(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := us.CleanupExpired(); err != nil {
+				utils.Logger.WithError(err).Error("Error limpiando sesiones de subida expiradas")
+			} else if n > 0 {
+				utils.Logger.Infof("Sesiones de subida expiradas eliminadas: %d", n)
+			}
+		}
+	}()
+}
+
+// finalize envía el archivo parcial completo por el flujo normal de subida.
+func (us *UploadService) finalize(session *models.UploadSession) (*models.File, error) {
+	part, err := os.OpenFile(us.partPath(session.ID), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer part.Close()
+
+	// Descartar cualquier byte escrito más allá del tamaño declarado
+	if err := part.Truncate(session.TotalSize); err != nil {
+		return nil, err
+	}
+
+	// Las cuotas se verifican de nuevo: otras subidas pueden haberlas
+	// consumido desde que se abrió la sesión
+	remaining, err := us.QuotaSvc.Allowance(session.OwnerID, session.Project, 1)
+	if err != nil {
+		return nil, err
+	}
+	if remaining >= 0 && session.TotalSize > remaining {
+		return nil, fmt.Errorf("%w: el archivo (%d bytes) supera los %d bytes disponibles", ErrQuotaExceeded, session.TotalSize, remaining)
+	}
+
+	// Verificar la política del proyecto antes de copiar el contenido
+	policy, err := us.PolicySvc.Policy(session.Project)
+	if err != nil {
+		return nil, err
+	}
+	data, err := us.PolicySvc.Enforce(policy, session.OriginalName, part)
+	if err != nil {
+		return nil, err
+	}
+
+	newFileName := uuid.New().String() + filepath.Ext(session.OriginalName)
+	relativePath, metadata, err := us.FileSvc.UploadFile(session.Project, newFileName, LimitReader(data, remaining))
+	if err != nil {
+		return nil, fmt.Errorf("error al guardar el archivo: %w", err)
+	}
+	file, err := us.FileSvc.CreateOwnedFileRecord(session.OriginalName, filepath.ToSlash(relativePath), session.OwnerID, session.IsPublic, metadata)
+	if err != nil {
+		us.FileSvc.DiscardBlob(filepath.ToSlash(relativePath))
+		return nil, err
+	}
+	return file, nil
+}
+
+// ownedSession obtiene la sesión y verifica que pertenece al usuario.
+func (us *UploadService) ownedSession(sessionID, ownerID string) (*models.UploadSession, error) {
+	session, err := database.GetUploadSessionById(us.FileSvc.LogRepo.DB, sessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUploadSessionNotFound
+		}
+		return nil, err
+	}
+	if session.OwnerID != ownerID {
+		return nil, ErrUploadSessionForbidden
+	}
+	return session, nil
+}
+
+// receivedRanges combina los fragmentos registrados en rangos contiguos.
+func (us *UploadService) receivedRanges(sessionID string) ([]models.ByteRange, error) {
+	chunks, err := database.GetUploadChunks(us.FileSvc.LogRepo.DB, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return mergeChunkRanges(chunks), nil
+}
+
+// mergeChunkRanges combina fragmentos (posiblemente repetidos o solapados) en
+// rangos [Start, End) ordenados y sin solapamientos; los rangos adyacentes se
+// unen en uno solo.
+func mergeChunkRanges(chunks []*models.UploadChunk) []models.ByteRange {
+	chunks = append([]*models.UploadChunk(nil), chunks...)
+	sort.SliceStable(chunks, func(i, j int) bool { return chunks[i].Offset < chunks[j].Offset })
+
+	ranges := []models.ByteRange{}
+	for _, chunk := range chunks {
+		end := chunk.Offset + chunk.Size
+		last := len(ranges) - 1
+		if last >= 0 && chunk.Offset <= ranges[last].End {
+			if end > ranges[last].End {
+				ranges[last].End = end
+			}
+			continue
+		}
+		ranges = append(ranges, models.ByteRange{Start: chunk.Offset, End: end})
+	}
+	return ranges
+}
+
+// discardParts elimina el archivo parcial y los fragmentos registrados.
+func (us *UploadService) discardParts(sessionID string) {
+	if err := os.Remove(us.partPath(sessionID)); err != nil && !os.IsNotExist(err) {
+		utils.Logger.WithError(err).Warn("No se pudo eliminar el archivo parcial de la sesión " + sessionID)
+	}
+	if err := database.DeleteUploadChunks(us.FileSvc.LogRepo.DB, sessionID); err != nil {
+		utils.Logger.WithError(err).Warn("No se pudieron eliminar los fragmentos de la sesión " + sessionID)
+	}
+}
+
+func (us *UploadService) partPath(sessionID string) string {
+	return filepath.Join(us.TempPath, sessionID+".part")
+}
+
+// coversWhole indica si los rangos cubren exactamente [0, size).
+func coversWhole(ranges []models.ByteRange, size int64) bool {
+	if size == 0 {
+		return true
+	}
+	return len(ranges) == 1 && ranges[0].Start == 0 && ranges[0].End >= size
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/t-saturn/file-server/models"
+)
+
+func chunks(pairs ...int64) []*models.UploadChunk {
+	result := []*models.UploadChunk{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		result = append(result, &models.UploadChunk{Offset: pairs[i], Size: pairs[i+1]})
+	}
+	return result
+}
+
+func TestMergeChunkRanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []*models.UploadChunk
+		want   []models.ByteRange
+	}{
+		{"sin fragmentos", nil, []models.ByteRange{}},
+		{"un fragmento", chunks(0, 10), []models.ByteRange{{Start: 0, End: 10}}},
+		{"adyacentes", chunks(0, 10, 10, 5), []models.ByteRange{{Start: 0, End: 15}}},
+		{"con hueco", chunks(0, 10, 20, 5), []models.ByteRange{{Start: 0, End: 10}, {Start: 20, End: 25}}},
+		{"solapados", chunks(0, 10, 5, 10), []models.ByteRange{{Start: 0, End: 15}}},
+		{"contenido en otro", chunks(0, 20, 5, 5), []models.ByteRange{{Start: 0, End: 20}}},
+		{"repetido al reintentar", chunks(0, 10, 0, 10, 10, 10), []models.ByteRange{{Start: 0, End: 20}}},
+		{"desordenados", chunks(20, 5, 0, 10, 10, 10), []models.ByteRange{{Start: 0, End: 25}}},
+		{"sin el inicio", chunks(5, 10), []models.ByteRange{{Start: 5, End: 15}}},
+	}
+	for _, tt := range tests {
+		if got := mergeChunkRanges(tt.chunks); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: mergeChunkRanges = %v, se esperaba %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCoversWhole(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges []models.ByteRange
+		size   int64
+		want   bool
+	}{
+		{"archivo vacío", []models.ByteRange{}, 0, true},
+		{"completo", []models.ByteRange{{Start: 0, End: 100}}, 100, true},
+		{"falta el final", []models.ByteRange{{Start: 0, End: 99}}, 100, false},
+		{"falta el inicio", []models.ByteRange{{Start: 1, End: 100}}, 100, false},
+		{"con hueco", []models.ByteRange{{Start: 0, End: 50}, {Start: 60, End: 100}}, 100, false},
+		{"sin fragmentos", []models.ByteRange{}, 100, false},
+		{"bytes de más", []models.ByteRange{{Start: 0, End: 120}}, 100, true},
+	}
+	for _, tt := range tests {
+		if got := coversWhole(tt.ranges, tt.size); got != tt.want {
+			t.Errorf("%s: coversWhole = %v, se esperaba %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCoversWholeAfterMerge(t *testing.T) {
+	// Fragmentos enviados fuera de orden y con un reintento cubren el archivo
+	ranges := mergeChunkRanges(chunks(50, 50, 0, 30, 20, 40, 50, 50))
+	if !coversWhole(ranges, 100) {
+		t.Errorf("rangos %v no cubren 100 bytes", ranges)
+	}
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/sirupsen/logrus"
+	"github.com/t-saturn/file-server/database"
+	"github.com/t-saturn/file-server/models"
+	"github.com/t-saturn/file-server/utils"
+	"gorm.io/gorm"
+)
+
+// ErrFileVersionNotFound indica que la versión solicitada no existe.
+var ErrFileVersionNotFound = errors.New("versión de archivo no encontrada")
+
+// VersionRetention define cuántas versiones se conservan por archivo: Default
+// se aplica a todos los proyectos salvo los indicados en ByProject. Un archivo
+// puede definir su propio límite con File.MaxVersions.
+type VersionRetention struct {
+	Default   int
+	ByProject map[string]int
+}
+
+// MaxVersionsFor devuelve cuántas versiones (incluida la vigente) se conservan del archivo.
+func (fs *FileService) MaxVersionsFor(file *models.File) int {
+	keep := fs.Retention.Default
+	if projectKeep, ok := fs.Retention.ByProject[FileProject(file)]; ok {
+		keep = projectKeep
+	}
+	if file.MaxVersions > 0 {
+		keep = file.MaxVersions
+	}
+	if keep < 1 {
+		keep = 1
+	}
+	return keep
+}
+
+// GetFileVersions obtiene el historial de versiones del archivo.
+func (fs *FileService) GetFileVersions(fileID string) ([]*models.FileVersion, error) {
+	return database.GetFileVersions(fs.LogRepo.DB, fileID)
+}
+
+// GetFileVersion obtiene una versión concreta del archivo.
+func (fs *FileService) GetFileVersion(fileID string, version int) (*models.FileVersion, error) {
+	fv, err := database.GetFileVersion(fs.LogRepo.DB, fileID, version)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrFileVersionNotFound
+	}
+	return fv, err
+}
+
+// AddFileVersion registra un contenido ya guardado como la nueva versión
+// vigente del archivo y aplica la retención de versiones.
+func (fs *FileService) AddFileVersion(fileID, originalName, url, userID string, metadata models.FileMetadata) (*models.File, error) {
+	file, _, err := database.AddFileVersion(fs.LogRepo.DB, fileID, originalName, url, userID, metadata)
+	if err != nil {
+		return nil, err
+	}
+	fs.addQuotaUsage(file, metadata.Size, 0)
+	fs.ApplyRetention(file)
+	fs.SyncFileRecord(file)
+	return file, nil
+}
+
+// RestoreFileVersion vuelve a publicar el contenido de una versión anterior
+// como una versión nueva; el historial no se reescribe y el blob se reutiliza.
+func (fs *FileService) RestoreFileVersion(fileID string, version int, userID string) (*models.File, error) {
+	fv, err := fs.GetFileVersion(fileID, version)
+	if err != nil {
+		return nil, err
+	}
+	metadata := models.FileMetadata{Size: fv.Size, MimeType: fv.MimeType, Checksum: fv.Checksum}
+	if fv.Checksum == "" {
+		// Versión anterior a los metadatos: leerlos del contenido guardado
+		if metadata, err = fs.blobMetadata(fv.URL, fv.OriginalName); err != nil {
+			return nil, err
+		}
+	}
+	return fs.AddFileVersion(fileID, fv.OriginalName, fv.URL, userID, metadata)
+}
+
+// UpdateVersionRetention cambia cuántas versiones conserva el archivo
+// (0 vuelve a la retención del proyecto) y elimina las que sobran.
+func (fs *FileService) UpdateVersionRetention(fileID, requestorID string, maxVersions int) (*models.File, error) {
+	file, err := fs.GetFileRecordByID(fileID)
+	if err != nil {
+		return nil, err
+	}
+	if file.OwnerID != requestorID {
+		return nil, errors.New("solo el propietario puede cambiar la retención de versiones")
+	}
+	if maxVersions < 0 {
+		return nil, errors.New("max_versions no puede ser negativo")
+	}
+	if err := database.UpdateFileMaxVersions(fs.LogRepo.DB, fileID, maxVersions); err != nil {
+		return nil, err
+	}
+	file.MaxVersions = maxVersions
+	fs.ApplyRetention(file)
+	fs.SyncFileRecord(file)
+	return file, nil
+}
+
+// ApplyRetention elimina las versiones más antiguas que exceden la retención
+// del archivo y libera sus blobs si ningún otro archivo o versión los usa.
+func (fs *FileService) ApplyRetention(file *models.File) {
+	versions, err := database.GetPrunableFileVersions(fs.LogRepo.DB, file.ID, file.Version, fs.MaxVersionsFor(file))
+	if err != nil {
+		utils.Logger.WithError(err).WithField("file_id", file.ID).Error("No se pudo aplicar la retención de versiones")
+		return
+	}
+	for _, version := range versions {
+		if err := database.DeleteFileVersion(fs.LogRepo.DB, version.ID); err != nil {
+			utils.Logger.WithError(err).WithField("file_id", file.ID).Error("No se pudo eliminar la versión")
+			continue
+		}
+		fs.addQuotaUsage(file, -version.Size, 0)
+		fs.releaseBlob(version.URL)
+		utils.Logger.WithFields(logrus.Fields{"event": "version_pruned", "file_id": file.ID, "version": version.Version}).Info("Versión eliminada por retención")
+	}
+}
+
+// releaseBlob elimina un contenido (local y en las réplicas) cuando ya no lo
+// referencia ningún archivo ni versión. Si las réplicas no alcanzan el quórum
+// el contenido se conserva y se registra el error.
+func (fs *FileService) releaseBlob(relativePath string) {
+	references, err := database.CountBlobReferences(fs.LogRepo.DB, relativePath, "")
+	if err != nil || references > 0 {
+		return
+	}
+	if err := fs.Replication.ReplicateDelete(relativePath); err != nil {
+		utils.Logger.WithError(err).WithField("path", relativePath).Error("No se pudo eliminar el contenido de las réplicas")
+		return
+	}
+	if err := fs.Storage.Delete(relativePath); err != nil {
+		utils.Logger.WithError(err).WithField("path", relativePath).Warn("No se pudo eliminar el contenido local")
+	}
+}
@@ -0,0 +1,27 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/t-saturn/file-server/models"
+)
+
+func TestMaxVersionsFor(t *testing.T) {
+	fs := &FileService{Retention: VersionRetention{Default: 10, ByProject: map[string]int{"fotos": 3, "blobs": 99}}}
+
+	tests := []struct {
+		name string
+		file models.File
+		want int
+	}{
+		{"blob CAS del proyecto", models.File{Project: "fotos", URL: "blobs/ab/cd/abcd"}, 3},
+		{"registro anterior a la columna project", models.File{URL: "fotos/2025/03/05/a.jpg"}, 3},
+		{"proyecto sin retención propia", models.File{Project: "otros", URL: "blobs/ab/cd/abcd"}, 10},
+		{"límite propio del archivo", models.File{Project: "fotos", URL: "blobs/ab/cd/abcd", MaxVersions: 5}, 5},
+	}
+	for _, tt := range tests {
+		if got := fs.MaxVersionsFor(&tt.file); got != tt.want {
+			t.Errorf("%s: MaxVersionsFor = %d, se esperaba %d", tt.name, got, tt.want)
+		}
+	}
+}